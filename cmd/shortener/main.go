@@ -4,13 +4,18 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	_ "net/http/pprof"
+	"os"
 
 	_ "github.com/golang/mock/mockgen/model"
 
 	"github.com/Alena-Kurushkina/shortener/internal/api"
+	"github.com/Alena-Kurushkina/shortener/internal/authenticator"
 	"github.com/Alena-Kurushkina/shortener/internal/config"
+	"github.com/Alena-Kurushkina/shortener/internal/generator"
 	"github.com/Alena-Kurushkina/shortener/internal/logger"
 	"github.com/Alena-Kurushkina/shortener/internal/repository"
 	"github.com/Alena-Kurushkina/shortener/internal/shortener"
@@ -34,17 +39,59 @@ func main() {
 	}
 	defer logger.Log.Sync()
 
+	if err = cfg.Validate(); err != nil {
+		logger.Log.Fatalf("Invalid configuration: %v", err)
+	}
+
 	ctx := context.Background()
 
+	// shortener migrate up|down|status
+	if args := flag.Args(); len(args) > 0 && args[0] == "migrate" {
+		if err = migrate(ctx, cfg, args[1:]); err != nil {
+			logger.Log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+
+	if err = authenticator.Initialize(cfg); err != nil {
+		logger.Log.Fatalf("Failed to initialize JWT keys: %v", err)
+	}
+
 	repo, err := repository.NewRepository(ctx, cfg)
 	if err != nil {
 		panic(err)
 	}
 	defer repo.Close()
 
-	sh := api.NewShortener(repo, cfg)
+	gen, err := generator.New(cfg.GeneratorStrategy, cfg.GeneratorAlphabet, cfg.ShortLength)
+	if err != nil {
+		panic(err)
+	}
+
+	if err = api.CheckRedirectCode(cfg.RedirectCode); err != nil {
+		panic(err)
+	}
+
+	authenticator.UseAPIKeys(repo)
+	authenticator.UseAccounts(repo)
+	if err = authenticator.UseSessions(ctx, repo); err != nil {
+		panic(err)
+	}
+
+	sh := api.NewShortener(repo, gen, cfg)
 
 	server := shortener.NewServer(sh, cfg)
 
 	server.Run()
 }
+
+// migrate runs database migration command passed in args.
+func migrate(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: shortener [flags] migrate up|down|status")
+	}
+	if cfg.ConnectionStr == "" {
+		return errors.New("database connection string is not set")
+	}
+	return repository.Migrate(ctx, cfg.ConnectionStr, args[0], os.Stdout)
+}
@@ -8,6 +8,7 @@ require (
 	github.com/satori/go.uuid v1.2.0
 	github.com/stretchr/testify v1.9.0
 	go.uber.org/zap v1.27.0
+	golang.org/x/crypto v0.33.0
 )
 
 require (
@@ -19,7 +20,6 @@ require (
 	github.com/mibk/dupl v1.0.0 // indirect
 	github.com/rogpeppe/go-internal v1.13.1 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
-	golang.org/x/crypto v0.33.0 // indirect
 	golang.org/x/exp/typeparams v0.0.0-20231108232855-2478ac86f678 // indirect
 	golang.org/x/mod v0.23.0 // indirect
 	golang.org/x/net v0.34.0 // indirect
@@ -41,6 +41,7 @@ require (
 	github.com/jackc/pgx/v5 v5.7.1
 	github.com/kyoh86/exportloopref v0.1.11
 	github.com/leighmcculloch/gochecknoinits v0.0.0-20210416043744-25bb07f6e4e3
+	github.com/mattn/go-sqlite3 v1.14.33
 	github.com/mvdan/unindent v0.0.0-20170829200357-ff6a34147cea
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	golang.org/x/tools v0.29.0
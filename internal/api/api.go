@@ -6,15 +6,19 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	uuid "github.com/satori/go.uuid"
 
+	"github.com/Alena-Kurushkina/shortener/internal/authenticator"
 	"github.com/Alena-Kurushkina/shortener/internal/config"
 	"github.com/Alena-Kurushkina/shortener/internal/generator"
 	"github.com/Alena-Kurushkina/shortener/internal/logger"
@@ -24,86 +28,490 @@ import (
 
 const timeoutPing time.Duration = 30
 
-// Storager defines operations with data storage.
-type Storager interface {
-	Insert(ctx context.Context, userID uuid.UUID, key, value string) error
+// maxGenerateAttempts limits number of shortenings generated for one URL
+// while they collide with existing shortenings.
+const maxGenerateAttempts = 5
+
+// A LinkStore keeps shortenings of users.
+type LinkStore interface {
+	// Insert saves shortening. It returns AlreadyExistError if original URL is shortened already
+	// and CollisionError if shortening is already used.
+	Insert(ctx context.Context, userID uuid.UUID, key, value string, opts LinkOptions) error
+	// InsertBatch saves shortenings of batch, elements which original URL is shortened already get existing shortening.
+	// It returns CollisionError if shortening of some element is already used.
 	InsertBatch(_ context.Context, userID uuid.UUID, batch []BatchElement) error
-	Select(ctx context.Context, key string) (string, error)
+	// Select returns redirect of shortening.
+	// It returns ErrNotFound if shortening is unknown, ErrDBRecordDeleted if it was deleted and ErrLinkExpired if it is expired.
+	Select(ctx context.Context, key string) (Redirect, error)
+	// SelectUserAll returns all user's shortenings.
 	SelectUserAll(ctx context.Context, userID uuid.UUID) ([]BatchElement, error)
-	DeleteRecords(ctx context.Context, deleteItems []DeleteItem) error
+	// SelectUserPage returns page of user's shortenings ordered by creation time
+	// and cursor of the next page if it exists.
+	SelectUserPage(ctx context.Context, userID uuid.UUID, query ListQuery) ([]BatchElement, *ListCursor, error)
+	// UpdateOriginalURL makes user's shortening lead to another original URL and saves change to history.
+	// It returns ErrNotFound if shortening doesn't belong to user and ErrDBRecordDeleted if it was deleted.
+	UpdateOriginalURL(ctx context.Context, userID uuid.UUID, key, originalURL string) error
+	// DeleteRecords marks user's records as deleted, records which don't belong to user are skipped.
+	// For every passed item it returns item with ids of records that are deleted.
+	DeleteRecords(ctx context.Context, deleteItems []DeleteItem) ([]DeleteItem, error)
+	// DeleteExpired marks records which expiration time has passed by now as deleted and returns their shortenings.
+	DeleteExpired(ctx context.Context, now time.Time) ([]string, error)
+	// RestoreRecords brings user's deleted records back.
+	// For every passed item it returns item with ids of records that are restored.
+	RestoreRecords(ctx context.Context, restoreItems []DeleteItem) ([]DeleteItem, error)
+	// PurgeDeleted permanently removes records deleted before passed time together with their history and statistics.
+	// It returns shortenings of removed records.
+	PurgeDeleted(ctx context.Context, before time.Time) ([]string, error)
+}
+
+// A HistoryStore keeps changes of original URLs which UpdateOriginalURL records.
+type HistoryStore interface {
+	// SelectHistory returns changes of original URL of user's shortening ordered by time.
+	// It returns ErrNotFound if shortening doesn't belong to user.
+	SelectHistory(ctx context.Context, userID uuid.UUID, key string) ([]URLEdit, error)
+}
+
+// A JobStore keeps queue of deletion requests until they are processed, so that they survive restart.
+type JobStore interface {
+	// QueueDeletion saves deletion request to queue.
+	QueueDeletion(ctx context.Context, item DeleteItem) error
+	// SelectQueuedDeletions returns deletion requests from queue in order of queueing.
+	SelectQueuedDeletions(ctx context.Context) ([]DeleteItem, error)
+	// DequeueDeletions removes processed deletion requests from queue.
+	DequeueDeletions(ctx context.Context, jobIDs []string) error
+}
+
+// A StatsStore keeps aggregated clicks of shortenings.
+type StatsStore interface {
+	// SaveClicks adds clicks to counters of shortenings.
+	SaveClicks(ctx context.Context, clicks []Click) error
+	// SelectStats returns aggregated clicks by user's shortening.
+	// It returns ErrNotFound if shortening doesn't belong to user.
+	SelectStats(ctx context.Context, userID uuid.UUID, key string) (ClickStats, error)
+}
+
+// An APIKeyStore keeps API keys of users by hashes of their secrets.
+type APIKeyStore interface {
+	authenticator.APIKeyFinder
+	// InsertAPIKey saves API key with hash of its secret.
+	InsertAPIKey(ctx context.Context, key authenticator.APIKey, hash string) error
+	// SelectUserAPIKeys returns user's active API keys ordered by time of issuance.
+	SelectUserAPIKeys(ctx context.Context, userID uuid.UUID) ([]authenticator.APIKey, error)
+	// RevokeAPIKey revokes user's API key by its id.
+	// It returns ErrNotFound if user has no such active key.
+	RevokeAPIKey(ctx context.Context, userID uuid.UUID, id string) error
+}
+
+// A SessionStore keeps sessions of authenticator and removes outdated ones.
+type SessionStore interface {
+	authenticator.SessionStore
+	// PurgeSessions removes sessions which expired or were revoked before passed time.
+	PurgeSessions(ctx context.Context, before time.Time) error
+}
+
+// A Conn is connection to data storage.
+type Conn interface {
+	// Ping checks that data storage is available.
 	Ping(ctx context.Context) error
+	// Close releases data storage.
 	Close()
 }
 
+// Storager defines operations with data storage, every data storage implements all of them.
+// Consumers depend on the focused interfaces it consists of.
+type Storager interface {
+	LinkStore
+	HistoryStore
+	JobStore
+	StatsStore
+	APIKeyStore
+	SessionStore
+	authenticator.AccountStore
+	Conn
+}
+
+// LinkOptions defines optional settings of shortening.
+type LinkOptions struct {
+	// ExpiresAt is expiration time of shortening, nil means that shortening never expires
+	ExpiresAt *time.Time
+	// RedirectCode is HTTP status of redirect, zero means status defined by config
+	RedirectCode int
+	// Passthrough makes query parameters of redirect request added to original URL
+	Passthrough bool
+}
+
+// A Redirect defines where and how shortening redirects.
+type Redirect struct {
+	OriginalURL  string
+	RedirectCode int
+	Passthrough  bool
+	// ExpiresAt is time after which shortening stops working, nil means it never expires
+	ExpiresAt *time.Time
+}
+
 // A Shortener aggregates data storage, configurations and helpful objects.
 type Shortener struct {
-	repo       Storager
-	config     *config.Config
-	deleteChan chan DeleteItem
-	done       chan struct{}
+	links       LinkStore
+	history     HistoryStore
+	queue       JobStore
+	stats       StatsStore
+	apiKeys     APIKeyStore
+	sessions    SessionStore
+	conn        Conn
+	config      *config.Config
+	generator   generator.Generator
+	aliasRe     *regexp.Regexp
+	deleteChan  chan DeleteItem
+	restoreChan chan DeleteItem
+	jobs        *deleteJobs
+	retryDelay  time.Duration
+	clickChan   chan Click
+	ipSalt      []byte
+	done        chan struct{}
+	wg          sync.WaitGroup
 }
 
-func newShortenerObject(storage Storager, cfg *config.Config) *Shortener {
+func newShortenerObject(storage Storager, gen generator.Generator, cfg *config.Config) *Shortener {
 	return &Shortener{
-		repo:       storage,
-		config:     cfg,
-		deleteChan: make(chan DeleteItem, 1024),
-		done:       make(chan struct{}),
+		links:       storage,
+		history:     storage,
+		queue:       storage,
+		stats:       storage,
+		apiKeys:     storage,
+		sessions:    storage,
+		conn:        storage,
+		config:      cfg,
+		generator:   gen,
+		aliasRe:     regexp.MustCompile(cfg.AliasPattern),
+		deleteChan:  make(chan DeleteItem, 1024),
+		restoreChan: make(chan DeleteItem, 1024),
+		jobs:        newDeleteJobs(),
+		retryDelay:  deleteRetryDelay,
+		clickChan:   make(chan Click, 1024),
+		ipSalt:      newIPSalt(),
+		done:        make(chan struct{}),
 	}
 }
 
-// NewShortener returns new Shortener pointer initialized by repository and config.
-func NewShortener(storage Storager, cfg *config.Config) shortener.Handler {
-	shortener := newShortenerObject(storage, cfg)
+// NewShortener returns new Shortener pointer initialized by repository, generator of shortenings and config.
+func NewShortener(storage Storager, gen generator.Generator, cfg *config.Config) shortener.Handler {
+	shortener := newShortenerObject(storage, gen, cfg)
 
+	shortener.wg.Add(4)
 	go shortener.flushDeleteItems()
+	go shortener.flushItems(shortener.restoreChan, shortener.restoreRecords)
+	go shortener.reapExpired()
+	go shortener.flushClicks()
 
 	return shortener
 }
 
-// DeleteItem represents pair of ids which identify unique record to delete.
+// DeleteItem represents pair of ids which identify unique record to delete or restore.
+// It is also used to report which of requested records were deleted or restored.
 type DeleteItem struct {
 	IDs    []string
 	UserID uuid.UUID
+	// JobID identifies deletion job which requested the item,
+	// it is empty in items returned by storage
+	JobID string
 }
 
-func (sh *Shortener) flushDeleteItems() {
+// flushItems collects items from channel and passes them to process function once a second.
+// Items left in buffer are processed on shutdown.
+func (sh *Shortener) flushItems(ch <-chan DeleteItem, process func([]DeleteItem)) {
+	defer sh.wg.Done()
+
 	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
 
 	items := make([]DeleteItem, 0, 1024)
 
 	for {
 		select {
-		case msg := <-sh.deleteChan:
+		case msg := <-ch:
 			items = append(items, msg)
 		case <-ticker.C:
-			sh.deleteRecords(items)
+			process(items)
 
 			items = make([]DeleteItem, 0, 1024)
 		case <-sh.done:
-			sh.deleteRecords(items)
+			process(items)
 			return
 		}
 	}
 }
 
+// flushDeleteItems replays deletion requests left in durable queue by previous run
+// and then deletes records sent to deleteChan.
+func (sh *Shortener) flushDeleteItems() {
+	sh.deleteRecords(sh.queuedDeletions())
+	sh.flushItems(sh.deleteChan, sh.deleteRecords)
+}
+
+// queuedDeletions returns deletion requests from durable queue and restores their pending jobs.
+func (sh *Shortener) queuedDeletions() []DeleteItem {
+	items, err := sh.queue.SelectQueuedDeletions(context.TODO())
+	if err != nil {
+		logger.Log.Infof("Can't read deletion queue: %s", err.Error())
+		return nil
+	}
+	for _, item := range items {
+		sh.jobs.put(item.JobID, item.UserID, item.IDs)
+	}
+	if len(items) > 0 {
+		logger.Log.Infof("Deletion requests are replayed from queue: %d", len(items))
+	}
+
+	return items
+}
+
+// deleteRecords deletes records, reports outcome to deletion jobs and removes requests from durable queue.
+// Failed batch is retried with growing delay up to maxDeleteAttempts times,
+// on shutdown it is failed without waiting. Requests of failed batch stay in durable queue
+// and are replayed on the next start.
 func (sh *Shortener) deleteRecords(items []DeleteItem) {
 	if len(items) == 0 {
 		return
 	}
-	err := sh.repo.DeleteRecords(context.TODO(), items)
+
+	delay := sh.retryDelay
+	for attempt := 1; ; attempt++ {
+		sh.jobs.attempt(items)
+
+		deleted, err := sh.links.DeleteRecords(context.TODO(), items)
+		if err == nil {
+			sh.jobs.finish(items, deleted)
+			sh.dequeueDeletions(items)
+
+			requested, done := countItems(items, deleted)
+			logger.Log.Info("Patch of shortenings was deleted, deleted " + strconv.Itoa(done) + " of " + strconv.Itoa(requested))
+			return
+		}
+		logger.Log.Infof("Can't delete records, attempt %d: %s", attempt, err.Error())
+
+		if attempt == maxDeleteAttempts {
+			sh.jobs.fail(items, err)
+			return
+		}
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-sh.done:
+			sh.jobs.fail(items, err)
+			return
+		}
+	}
+}
+
+// dequeueDeletions removes processed deletion requests from durable queue.
+// Requests which are not removed are replayed on the next start, that is harmless as deletion is idempotent.
+func (sh *Shortener) dequeueDeletions(items []DeleteItem) {
+	jobIDs := make([]string, 0, len(items))
+	for _, item := range items {
+		if item.JobID != "" {
+			jobIDs = append(jobIDs, item.JobID)
+		}
+	}
+	if err := sh.queue.DequeueDeletions(context.TODO(), jobIDs); err != nil {
+		logger.Log.Infof("Can't remove requests from deletion queue: %s", err.Error())
+	}
+}
+
+// restoreRecords brings user's deleted records back.
+func (sh *Shortener) restoreRecords(items []DeleteItem) {
+	if len(items) == 0 {
+		return
+	}
+	restored, err := sh.links.RestoreRecords(context.TODO(), items)
 	if err != nil {
-		logger.Log.Infof("Can't delete records", err.Error())
+		logger.Log.Infof("Can't restore records: %s", err.Error())
 		return
 	}
-	logger.Log.Info("Patch of shortenings was deleted, patch length: " + strconv.Itoa(len(items)))
+
+	requested, done := countItems(items, restored)
+	logger.Log.Infof("Patch of shortenings was restored, restored %d of %d", done, requested)
+}
+
+// countItems returns number of requested ids and number of ids processed by storage.
+func countItems(requested, processed []DeleteItem) (int, int) {
+	nRequested, nProcessed := 0, 0
+	for k := range requested {
+		nRequested += len(requested[k].IDs)
+		nProcessed += len(processed[k].IDs)
+	}
+	return nRequested, nProcessed
+}
+
+// reapExpired periodically marks records with expired time to live as deleted,
+// purges records which were deleted longer than retention period ago and ended sessions.
+func (sh *Shortener) reapExpired() {
+	defer sh.wg.Done()
+
+	ticker := time.NewTicker(sh.config.ReaperInterval.Duration)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			now := time.Now()
+
+			expired, err := sh.links.DeleteExpired(context.TODO(), now)
+			if err != nil {
+				logger.Log.Infof("Can't delete expired records: %s", err.Error())
+			} else if len(expired) > 0 {
+				logger.Log.Infof("Expired shortenings were deleted: %d", len(expired))
+			}
+
+			sh.purgeDeleted(now)
+
+			// revoked sessions are kept while their access tokens can be valid, see authenticator.UseSessions
+			err = sh.sessions.PurgeSessions(context.TODO(), now.Add(-sh.config.AccessTokenTTL.Duration))
+			if err != nil {
+				logger.Log.Infof("Can't purge sessions: %s", err.Error())
+			}
+		case <-sh.done:
+			return
+		}
+	}
+}
+
+// purgeDeleted permanently removes records deleted before retention period.
+// Zero retention period keeps deleted records forever.
+func (sh *Shortener) purgeDeleted(now time.Time) {
+	retention := sh.config.DeletedRetention.Duration
+	if retention <= 0 {
+		return
+	}
+
+	purged, err := sh.links.PurgeDeleted(context.TODO(), now.Add(-retention))
+	if err != nil {
+		logger.Log.Infof("Can't purge deleted records: %s", err.Error())
+		return
+	}
+	if len(purged) > 0 {
+		logger.Log.Infof("Deleted shortenings were purged: %d", len(purged))
+	}
+}
+
+// expiration returns expiration time of shortening defined by exact time or time to live.
+// Nil result means that shortening never expires.
+func expiration(expiresAt *time.Time, ttl string) (*time.Time, error) {
+	if ttl == "" {
+		if expiresAt != nil && !expiresAt.After(time.Now()) {
+			return nil, fmt.Errorf("%w: %s is in the past", sherr.ErrInvalidExpiration, expiresAt.Format(time.RFC3339))
+		}
+		return expiresAt, nil
+	}
+	if expiresAt != nil {
+		return nil, fmt.Errorf("%w: expires_at and ttl can't be set together", sherr.ErrInvalidExpiration)
+	}
+
+	d, err := time.ParseDuration(ttl)
+	if err != nil || d <= 0 {
+		return nil, fmt.Errorf("%w: ttl must be positive duration like 24h", sherr.ErrInvalidExpiration)
+	}
+	t := time.Now().Add(d)
+
+	return &t, nil
+}
+
+// checkAlias returns ErrInvalidAlias if custom alias doesn't match configured pattern or is reserved word.
+func (sh *Shortener) checkAlias(alias string) error {
+	if !sh.aliasRe.MatchString(alias) {
+		return fmt.Errorf("%w: %s doesn't match %s", sherr.ErrInvalidAlias, alias, sh.aliasRe.String())
+	}
+	for _, reserved := range sh.config.ReservedAliases {
+		if strings.EqualFold(alias, reserved) {
+			return fmt.Errorf("%w: %s is reserved", sherr.ErrInvalidAlias, alias)
+		}
+	}
+	return nil
+}
+
+// insertShortening saves shortening of URL with its options to data storage.
+// If alias is passed it is used as shortening, otherwise shortening is generated.
+// Generated shortening is generated again if it collides with existing one,
+// for alias ErrAliasTaken is returned.
+func (sh *Shortener) insertShortening(ctx context.Context, userID uuid.UUID, url, alias string, opts LinkOptions) (string, error) {
+	if alias != "" {
+		if err := sh.checkAlias(alias); err != nil {
+			return "", err
+		}
+		err := sh.links.Insert(ctx, userID, alias, url, opts)
+
+		var collision *sherr.CollisionError
+		if errors.As(err, &collision) {
+			return "", fmt.Errorf("%w: %s", sherr.ErrAliasTaken, alias)
+		}
+		return alias, err
+	}
+
+	for attempt := 0; attempt < maxGenerateAttempts; attempt++ {
+		shortStr := sh.generator.Generate(url, attempt)
+
+		err := sh.links.Insert(ctx, userID, shortStr, url, opts)
+
+		var collision *sherr.CollisionError
+		if errors.As(err, &collision) {
+			logger.Log.Infof("Shortening %s collides with existing one, attempt %d", shortStr, attempt+1)
+			continue
+		}
+		return shortStr, err
+	}
+	return "", sherr.ErrNoFreeShortening
+}
+
+// insertBatch saves shortenings of batch elements to data storage.
+// Elements with alias get it as shortening, shortenings of other elements are generated.
+// Generated shortening which collides with existing one is generated again and the whole batch is saved again,
+// collision of alias makes ErrAliasTaken, as well as alias repeated for different original URLs.
+func (sh *Shortener) insertBatch(ctx context.Context, userID uuid.UUID, batch []BatchElement) error {
+	aliases := make(map[string]string)
+	for k := range batch {
+		if batch[k].Alias != "" {
+			if err := sh.checkAlias(batch[k].Alias); err != nil {
+				return err
+			}
+			if url, ok := aliases[batch[k].Alias]; ok && url != batch[k].OriginalURL {
+				return fmt.Errorf("%w: %s", sherr.ErrAliasTaken, batch[k].Alias)
+			}
+			aliases[batch[k].Alias] = batch[k].OriginalURL
+			batch[k].ShortURL = batch[k].Alias
+			continue
+		}
+		batch[k].ShortURL = sh.generator.Generate(batch[k].OriginalURL, 0)
+	}
+
+	for attempt := 0; attempt < maxGenerateAttempts; attempt++ {
+		err := sh.links.InsertBatch(ctx, userID, batch)
+
+		var collision *sherr.CollisionError
+		if !errors.As(err, &collision) {
+			return err
+		}
+		logger.Log.Infof("Shortening %s collides with existing one, attempt %d", collision.ShortURL, attempt+1)
+
+		regenerated := false
+		for k := range batch {
+			if batch[k].ShortURL == collision.ShortURL && batch[k].Alias == "" {
+				batch[k].ShortURL = sh.generator.Generate(batch[k].OriginalURL, attempt+1)
+				regenerated = true
+			}
+		}
+		if !regenerated {
+			return fmt.Errorf("%w: %s", sherr.ErrAliasTaken, collision.ShortURL)
+		}
+	}
+	return sherr.ErrNoFreeShortening
 }
 
-// Shutdown finishes work gracefully
+// Shutdown finishes work gracefully.
+// Data storage is closed after background workers have written collected data.
 func (sh *Shortener) Shutdown() {
 	logger.Log.Info("Start shortener shutdown")
 	close(sh.done)
-	sh.repo.Close()
+	sh.wg.Wait()
+	sh.conn.Close()
 }
 
 // CreateShortening habdle POST HTTP request with long URL in body and retrieves base URL with shortening.
@@ -116,10 +524,37 @@ func (sh *Shortener) CreateShortening(res http.ResponseWriter, req *http.Request
 	// parse request body
 	contentType := req.Header.Get("Content-Type")
 
-	var url string
+	var url, alias, ttl string
+	var opts LinkOptions
 	if contentType == "application/x-www-form-urlencoded" {
 		req.ParseForm()
 		url = req.FormValue("url")
+		alias = req.FormValue("alias")
+		ttl = req.FormValue("ttl")
+		if v := req.FormValue("expires_at"); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(res, "Invalid expires_at", http.StatusBadRequest)
+				return
+			}
+			opts.ExpiresAt = &t
+		}
+		if v := req.FormValue("redirect_code"); v != "" {
+			code, err := strconv.Atoi(v)
+			if err != nil {
+				http.Error(res, "Invalid redirect_code", http.StatusBadRequest)
+				return
+			}
+			opts.RedirectCode = code
+		}
+		if v := req.FormValue("query_passthrough"); v != "" {
+			passthrough, err := strconv.ParseBool(v)
+			if err != nil {
+				http.Error(res, "Invalid query_passthrough", http.StatusBadRequest)
+				return
+			}
+			opts.Passthrough = passthrough
+		}
 	} else if strings.Contains(contentType, "text/plain") || strings.Contains(contentType, "application/x-gzip") {
 		body, err := io.ReadAll(req.Body)
 
@@ -139,17 +574,25 @@ func (sh *Shortener) CreateShortening(res http.ResponseWriter, req *http.Request
 
 	logger.Log.Infof("Handle route /, method POST, body: %s", url)
 
-	// generate shortening
-	shortStr := generator.GenerateRandomString(15)
+	id, ok := authenticator.UserFromContext(req.Context())
+	if !ok {
+		http.Error(res, "User is not authenticated", http.StatusUnauthorized)
+		return
+	}
 
-	q := req.URL.Query()
-	id, err := uuid.FromString(q.Get("userUUID"))
+	var err error
+	opts.ExpiresAt, err = expiration(opts.ExpiresAt, ttl)
 	if err != nil {
-		http.Error(res, err.Error(), http.StatusInternalServerError)
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = checkLinkRedirectCode(opts.RedirectCode); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	insertErr := sh.repo.Insert(req.Context(), id, shortStr, url)
+	// generate and save shortening
+	shortStr, insertErr := sh.insertShortening(req.Context(), id, url, alias, opts)
 
 	var existError *sherr.AlreadyExistError
 	if errors.As(insertErr, &existError) {
@@ -157,6 +600,12 @@ func (sh *Shortener) CreateShortening(res http.ResponseWriter, req *http.Request
 		res.WriteHeader(http.StatusConflict)
 		res.Write([]byte(sh.config.BaseURL + existError.ExistShortStr))
 
+		return
+	} else if errors.Is(insertErr, sherr.ErrAliasTaken) {
+		http.Error(res, insertErr.Error(), http.StatusConflict)
+		return
+	} else if errors.Is(insertErr, sherr.ErrNoFreeShortening) {
+		http.Error(res, insertErr.Error(), http.StatusInternalServerError)
 		return
 	} else if insertErr != nil {
 		http.Error(res, insertErr.Error(), http.StatusBadRequest)
@@ -169,8 +618,17 @@ func (sh *Shortener) CreateShortening(res http.ResponseWriter, req *http.Request
 }
 
 // A URLRequest is for request decoding from json.
+// Alias is optional shortening chosen by user.
+// Shortening stops working at ExpiresAt or after TTL like "24h" if one of them is set.
 type URLRequest struct {
-	URL string `json:"url"`
+	URL       string     `json:"url"`
+	Alias     string     `json:"alias,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	TTL       string     `json:"ttl,omitempty"`
+	// RedirectCode is HTTP status of redirect by shortening, config defines it by default
+	RedirectCode int `json:"redirect_code,omitempty"`
+	// Passthrough makes query parameters of redirect request added to original URL
+	Passthrough bool `json:"query_passthrough,omitempty"`
 }
 
 // A ResultResponse is for response encoding in json.
@@ -204,18 +662,30 @@ func (sh *Shortener) CreateShorteningJSON(res http.ResponseWriter, req *http.Req
 		return
 	}
 
-	q := req.URL.Query()
-	id, err := uuid.FromString(q.Get("userUUID"))
-	if err != nil {
-		http.Error(res, err.Error(), http.StatusInternalServerError)
+	id, ok := authenticator.UserFromContext(req.Context())
+	if !ok {
+		http.Error(res, "User is not authenticated", http.StatusUnauthorized)
 		return
 	}
 
 	logger.Log.Infof("Handle route /api/shorten, method POST, body: %s", url.URL)
 
-	// generate shortening
-	shortStr := generator.GenerateRandomString(15)
-	insertErr := sh.repo.Insert(req.Context(), id, shortStr, url.URL)
+	expiresAt, err := expiration(url.ExpiresAt, url.TTL)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = checkLinkRedirectCode(url.RedirectCode); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// generate and save shortening
+	shortStr, insertErr := sh.insertShortening(req.Context(), id, url.URL, url.Alias, LinkOptions{
+		ExpiresAt:    expiresAt,
+		RedirectCode: url.RedirectCode,
+		Passthrough:  url.Passthrough,
+	})
 
 	var existError *sherr.AlreadyExistError
 	if errors.As(insertErr, &existError) {
@@ -232,6 +702,12 @@ func (sh *Shortener) CreateShorteningJSON(res http.ResponseWriter, req *http.Req
 		res.Write(responseData)
 		//res.Write([]byte(sh.config.BaseURL + existError.ExistShortStr))
 
+		return
+	} else if errors.Is(insertErr, sherr.ErrAliasTaken) {
+		http.Error(res, insertErr.Error(), http.StatusConflict)
+		return
+	} else if errors.Is(insertErr, sherr.ErrNoFreeShortening) {
+		http.Error(res, insertErr.Error(), http.StatusInternalServerError)
 		return
 	} else if insertErr != nil {
 		http.Error(res, insertErr.Error(), http.StatusBadRequest)
@@ -251,10 +727,18 @@ func (sh *Shortener) CreateShorteningJSON(res http.ResponseWriter, req *http.Req
 }
 
 // A BatchElement represent structure to marshal element of request`s json array.
+// Expiration and redirect of shortening are set as in URLRequest.
 type BatchElement struct {
-	CorrelarionID string `json:"correlation_id"`
-	OriginalURL   string `json:"original_url"`
-	ShortURL      string `json:"short_url,omitempty"`
+	CorrelarionID string     `json:"correlation_id"`
+	OriginalURL   string     `json:"original_url"`
+	ShortURL      string     `json:"short_url,omitempty"`
+	Alias         string     `json:"alias,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	TTL           string     `json:"ttl,omitempty"`
+	RedirectCode  int        `json:"redirect_code,omitempty"`
+	Passthrough   bool       `json:"query_passthrough,omitempty"`
+	CreatedAt     *time.Time `json:"created_at,omitempty"`
+	Deleted       bool       `json:"is_deleted,omitempty"`
 }
 
 // CreateShorteningJSONBatch handle POST HTTP request with set of long URLs in body and retrieves set of shortenings.
@@ -282,20 +766,33 @@ func (sh *Shortener) CreateShorteningJSONBatch(res http.ResponseWriter, req *htt
 		http.Error(res, "Body is empty", http.StatusBadRequest)
 		return
 	}
-	// generate shortening
+	id, ok := authenticator.UserFromContext(req.Context())
+	if !ok {
+		http.Error(res, "User is not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var err error
 	for k := range batch {
-		batch[k].ShortURL = generator.GenerateRandomString(15)
+		if batch[k].ExpiresAt, err = expiration(batch[k].ExpiresAt, batch[k].TTL); err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		batch[k].TTL = ""
+		if err = checkLinkRedirectCode(batch[k].RedirectCode); err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
 	}
 
-	q := req.URL.Query()
-	id, err := uuid.FromString(q.Get("userUUID"))
-	if err != nil {
+	// generate shortenings and write to data storage
+	if err = sh.insertBatch(req.Context(), id, batch); errors.Is(err, sherr.ErrAliasTaken) {
+		http.Error(res, err.Error(), http.StatusConflict)
+		return
+	} else if errors.Is(err, sherr.ErrNoFreeShortening) {
 		http.Error(res, err.Error(), http.StatusInternalServerError)
 		return
-	}
-
-	// write to data storage
-	if err = sh.repo.InsertBatch(req.Context(), id, batch); err != nil {
+	} else if err != nil {
 		http.Error(res, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -315,6 +812,8 @@ func (sh *Shortener) CreateShorteningJSONBatch(res http.ResponseWriter, req *htt
 
 // GetFullString handle GET request with shortening in URL parameter named id
 // and makes response with long URL in header's location value.
+// Status of response is redirect code of shortening or the one defined by config,
+// query parameters of request are passed to long URL if shortening allows it.
 // Response content type is text/plain.
 // get /{id}
 func (sh *Shortener) GetFullString(res http.ResponseWriter, req *http.Request) {
@@ -326,99 +825,184 @@ func (sh *Shortener) GetFullString(res http.ResponseWriter, req *http.Request) {
 	}
 
 	// get long URL from repository
-	repoOutput, err := sh.repo.Select(req.Context(), param)
+	redirect, err := sh.links.Select(req.Context(), param)
 	if err != nil {
-		if errors.Is(err, sherr.ErrDBRecordDeleted) {
+		if errors.Is(err, sherr.ErrDBRecordDeleted) || errors.Is(err, sherr.ErrLinkExpired) {
 			http.Error(res, err.Error(), http.StatusGone)
+			return
 		}
 		http.Error(res, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	sh.recordClick(req, param)
+
 	// make responce
 	res.Header().Set("Content-Type", "text/plain")
-	res.Header().Set("Location", repoOutput)
-	res.WriteHeader(http.StatusTemporaryRedirect)
+	res.Header().Set("Location", redirectURL(redirect, req.URL.Query()))
+	res.WriteHeader(sh.redirectCode(redirect))
 }
 
-// GetUserAllShortenings handle GET request with no parameters and makes response with
-// all user's shortenings in body in json format.
+// GetUserAllShortenings handle GET request and makes response with
+// page of user's shortenings in body in json format.
+// Query parameters limit, cursor, order (asc or desc by creation time), search (substring of original URL)
+// and deleted (true or false) define page. Link header refers to the next page if it exists.
 // get /api/user/urls
 func (sh *Shortener) GetUserAllShortenings(res http.ResponseWriter, req *http.Request) {
 	res.Header().Set("Content-Type", "application/json")
 
+	id, ok := authenticator.UserFromContext(req.Context())
+	if !ok {
+		http.Error(res, "User is not authenticated", http.StatusUnauthorized)
+		return
+	}
+
 	q := req.URL.Query()
-	id, err := uuid.FromString(q.Get("userUUID"))
+	query, err := parseListQuery(q)
 	if err != nil {
-		http.Error(res, err.Error(), http.StatusInternalServerError)
+		http.Error(res, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	//get all user's long URL from repository
-	allRecords, err := sh.repo.SelectUserAll(req.Context(), id)
+	// get page of user's long URL from repository
+	records, next, err := sh.links.SelectUserPage(req.Context(), id, query)
 	if err != nil {
 		http.Error(res, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if len(allRecords) == 0 {
+	if len(records) == 0 {
 		res.WriteHeader(http.StatusNoContent)
 		return
 	}
 
-	for k, v := range allRecords {
-		allRecords[k].ShortURL = sh.config.BaseURL + v.ShortURL
+	for k, v := range records {
+		records[k].ShortURL = sh.config.BaseURL + v.ShortURL
 	}
 
-	responseData, err := json.Marshal(allRecords)
+	responseData, err := json.Marshal(records)
 	if err != nil {
 		http.Error(res, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	res.Write(responseData)
+
+	if next != nil {
+		cursor, err := encodeCursor(next)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		q.Set("cursor", cursor)
+		res.Header().Set("Link", "<"+sh.config.BaseURL+"api/user/urls?"+q.Encode()+`>; rel="next"`)
+	}
 
 	// make responce
 	res.WriteHeader(http.StatusOK)
+	res.Write(responseData)
 }
 
-// DeleteRecordJSON saves record's id for future deletion. It returns status Accepted on seccuss saving.
+// DeleteRecordJSON saves record's id to durable queue for future deletion. It returns status Accepted on seccuss saving
+// with id of deletion job in body and address of job status in Location header.
+// If queue is full, it returns status Service Unavailable with Retry-After header instead of waiting.
 // Deletion itself is performed periodically.
 // It handle only requests with content type application/json.
 // delete /api/user/urls
 func (sh *Shortener) DeleteRecordJSON(res http.ResponseWriter, req *http.Request) {
-	res.Header().Set("Content-Type", "application/json")
+	item, ok := readUserItems(res, req)
+	if !ok {
+		return
+	}
 
-	q := req.URL.Query()
-	id, err := uuid.FromString(q.Get("userUUID"))
+	item.JobID = sh.jobs.add(item.UserID, item.IDs)
+	responseData, err := json.Marshal(DeleteJobResponse{JobID: item.JobID})
 	if err != nil {
+		sh.jobs.remove(item.JobID)
 		http.Error(res, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	if err = sh.queue.QueueDeletion(req.Context(), item); err != nil {
+		sh.jobs.remove(item.JobID)
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	select {
+	case sh.deleteChan <- item:
+	default:
+		if err = sh.queue.DequeueDeletions(req.Context(), []string{item.JobID}); err != nil {
+			logger.Log.Infof("Can't remove rejected request from deletion queue: %s", err.Error())
+		}
+		sh.jobs.remove(item.JobID)
+
+		res.Header().Set("Retry-After", strconv.Itoa(int(deleteQueueRetryAfter.Seconds())))
+		http.Error(res, "Deletion queue is full", http.StatusServiceUnavailable)
+		return
+	}
+
+	logger.Log.Info("Shortenings' ids were send to chan for deletion")
+
+	// make responce
+	res.Header().Set("Location", sh.config.BaseURL+"api/user/urls/delete-jobs/"+item.JobID)
+	res.WriteHeader(http.StatusAccepted)
+	res.Write(responseData)
+}
+
+// RestoreRecordJSON saves ids of user's deleted records for future restoring.
+// It returns status Accepted on success saving, restoring itself is performed periodically.
+// If queue is full, it returns status Service Unavailable with Retry-After header instead of waiting.
+// It handle only requests with content type application/json.
+// post /api/user/urls/restore
+func (sh *Shortener) RestoreRecordJSON(res http.ResponseWriter, req *http.Request) {
+	item, ok := readUserItems(res, req)
+	if !ok {
+		return
+	}
+
+	select {
+	case sh.restoreChan <- item:
+	default:
+		res.Header().Set("Retry-After", strconv.Itoa(int(restoreQueueRetryAfter.Seconds())))
+		http.Error(res, "Restoring queue is full", http.StatusServiceUnavailable)
+		return
+	}
+
+	logger.Log.Info("Shortenings' ids were send to chan for restoring")
+
+	// make responce
+	res.WriteHeader(http.StatusAccepted)
+}
+
+// readUserItems reads list of shortenings from request body.
+// It writes error response and returns false if request is invalid.
+func readUserItems(res http.ResponseWriter, req *http.Request) (DeleteItem, bool) {
+	res.Header().Set("Content-Type", "application/json")
+
+	id, ok := authenticator.UserFromContext(req.Context())
+	if !ok {
+		http.Error(res, "User is not authenticated", http.StatusUnauthorized)
+		return DeleteItem{}, false
+	}
+
 	// check content type
 	contentType := req.Header.Get("Content-Type")
 	if contentType != "application/json" && contentType != "application/x-gzip" {
 		http.Error(res, "Invalid content type", http.StatusBadRequest)
-		return
+		return DeleteItem{}, false
 	}
 
 	// decode request body
 	recordIDs := make([]string, 10)
 	if err := json.NewDecoder(req.Body).Decode(&recordIDs); err != nil {
 		http.Error(res, "Can't read body", http.StatusBadRequest)
-		return
+		return DeleteItem{}, false
 	}
 	if len(recordIDs) == 0 {
 		http.Error(res, "Body is empty", http.StatusBadRequest)
-		return
+		return DeleteItem{}, false
 	}
 
-	sh.deleteChan <- DeleteItem{IDs: recordIDs, UserID: id}
-
-	logger.Log.Info("Shortenings' ids were send to chan for deletion")
-
-	// make responce
-	res.WriteHeader(http.StatusAccepted)
+	return DeleteItem{IDs: recordIDs, UserID: id}, true
 }
 
 // PingDB check connection to data storage.
@@ -426,7 +1010,7 @@ func (sh *Shortener) PingDB(res http.ResponseWriter, req *http.Request) {
 
 	ctx, cancel := context.WithTimeout(req.Context(), timeoutPing*time.Second)
 	defer cancel()
-	if err := sh.repo.Ping(ctx); err != nil {
+	if err := sh.conn.Ping(ctx); err != nil {
 		http.Error(res, err.Error(), http.StatusInternalServerError)
 		return
 	}
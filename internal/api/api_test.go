@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
@@ -8,15 +9,19 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/chi/v5"
 	"github.com/golang/mock/gomock"
+	uuid "github.com/satori/go.uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/Alena-Kurushkina/shortener/internal/authenticator"
 	"github.com/Alena-Kurushkina/shortener/internal/config"
+	"github.com/Alena-Kurushkina/shortener/internal/generator"
+	"github.com/Alena-Kurushkina/shortener/internal/sherr"
 )
 
 var cfg *config.Config
@@ -86,10 +91,14 @@ func TestRouter(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	m := NewMockStorager(ctrl)
 
-	m.EXPECT().Insert(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+	m.EXPECT().Insert(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+	// redirects are counted in background
+	m.EXPECT().SaveClicks(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	// deletion queue is replayed on start
+	m.EXPECT().SelectQueuedDeletions(gomock.Any()).Return(nil, nil).AnyTimes()
 
 	cfg = config.InitConfig()
-	sh := NewShortener(m, cfg)
+	sh := NewShortener(m, generator.NewRandomGenerator(generator.Base62, 15), cfg)
 
 	r := chi.NewRouter()
 
@@ -148,7 +157,7 @@ func TestRouter(t *testing.T) {
 		}
 		_ = testDataExpand.name
 
-		m.EXPECT().Select(gomock.Any(), shortening).Return("http://site.ru/somelongurl", nil)
+		m.EXPECT().Select(gomock.Any(), shortening).Return(Redirect{OriginalURL: "http://site.ru/somelongurl"}, nil)
 
 		rpGet := testRequest(t, ts, testDataExpand.method, testDataExpand.path, testDataExpand.contentType, testDataExpand.body)
 		assert.Equal(t, testDataExpand.want.code, rpGet.statusCode, "Expand URL: Код статуса ответа не совпадает с ожидаемым")
@@ -157,7 +166,7 @@ func TestRouter(t *testing.T) {
 		assert.Equal(t, testDataExpand.want.location, rpGet.location, "Expand URL: Location не совпадает с ожидаемым")
 	})
 
-	m.EXPECT().Select(gomock.Any(), "jfhdgt").Return("", errors.New("can't find value of key"))
+	m.EXPECT().Select(gomock.Any(), "jfhdgt").Return(Redirect{}, errors.New("can't find value of key"))
 
 	tests := []testData{
 		{http.MethodPost, "negative create shortening test", "/", "text/plain", "", want{http.StatusBadRequest, "Body is empty", "text/plain", ""}},
@@ -182,10 +191,13 @@ func TestRouterJSON(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	m := NewMockStorager(ctrl)
 
-	m.EXPECT().Insert(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+	m.EXPECT().Insert(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
 	//m.EXPECT().InsertBatch(gomock.Any(),gomock.Any(),gomock.Any()).Return(nil)
+	m.EXPECT().SaveClicks(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	// deletion queue is replayed on start
+	m.EXPECT().SelectQueuedDeletions(gomock.Any()).Return(nil, nil).AnyTimes()
 
-	sh := NewShortener(m, cfg)
+	sh := NewShortener(m, generator.NewRandomGenerator(generator.Base62, 15), cfg)
 
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
@@ -233,7 +245,7 @@ func TestRouterJSON(t *testing.T) {
 		assert.Contains(t, rp.contentType, testDataShort.want.contentType, "Short URL: Content-Type не совпадает с ожидаемым")
 		assert.Equal(t, testDataShort.want.location, rp.location, "Short URL: Location не совпадает с ожидаемым")
 
-		m.EXPECT().Select(gomock.Any(), shortening).Return("http://site.ru/somelongurl", nil)
+		m.EXPECT().Select(gomock.Any(), shortening).Return(Redirect{OriginalURL: "http://site.ru/somelongurl"}, nil)
 
 		testDataExpand := testData{
 			method:      http.MethodGet,
@@ -302,8 +314,9 @@ func TestRouterJSONBatch(t *testing.T) {
 	m := NewMockStorager(ctrl)
 
 	m.EXPECT().InsertBatch(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+	m.EXPECT().SelectQueuedDeletions(gomock.Any()).Return(nil, nil).AnyTimes()
 
-	sh := NewShortener(m, cfg)
+	sh := NewShortener(m, generator.NewRandomGenerator(generator.Base62, 15), cfg)
 
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
@@ -374,3 +387,236 @@ func TestRouterJSONBatch(t *testing.T) {
 	})
 
 }
+
+// A sequenceGenerator gives passed shortenings one by one.
+type sequenceGenerator struct {
+	shortenings []string
+	next        int
+}
+
+func sequence(shortenings ...string) *sequenceGenerator {
+	return &sequenceGenerator{shortenings: shortenings}
+}
+
+func (g *sequenceGenerator) Generate(_ string, _ int) string {
+	v := g.shortenings[g.next%len(g.shortenings)]
+	g.next++
+	return v
+}
+
+func TestCreateShorteningCollision(t *testing.T) {
+	cfg = config.InitConfig()
+	userID := uuid.NewV4()
+
+	t.Run("collision is retried with new shortening", func(t *testing.T) {
+		m := NewMockStorager(gomock.NewController(t))
+		gomock.InOrder(
+			m.EXPECT().Insert(gomock.Any(), userID, "aaa", "http://site.ru", gomock.Any()).Return(sherr.NewCollisionError("aaa")),
+			m.EXPECT().Insert(gomock.Any(), userID, "bbb", "http://site.ru", gomock.Any()).Return(nil),
+		)
+
+		sh := newShortenerObject(m, sequence("aaa", "bbb"), cfg)
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("http://site.ru"))
+		req = withUser(req, userID)
+		req.Header.Set("Content-Type", "text/plain")
+		rec := httptest.NewRecorder()
+		sh.CreateShortening(rec, req)
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, cfg.BaseURL+"bbb", rec.Body.String())
+	})
+
+	t.Run("attempts are limited", func(t *testing.T) {
+		m := NewMockStorager(gomock.NewController(t))
+		m.EXPECT().Insert(gomock.Any(), userID, "aaa", "http://site.ru", gomock.Any()).Return(sherr.NewCollisionError("aaa")).Times(maxGenerateAttempts)
+
+		sh := newShortenerObject(m, sequence("aaa"), cfg)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url":"http://site.ru"}`))
+		req = withUser(req, userID)
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		sh.CreateShorteningJSON(rec, req)
+
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+
+	t.Run("colliding batch element gets new shortening", func(t *testing.T) {
+		m := NewMockStorager(gomock.NewController(t))
+		gomock.InOrder(
+			m.EXPECT().InsertBatch(gomock.Any(), userID, gomock.Any()).Return(sherr.NewCollisionError("a2")),
+			m.EXPECT().InsertBatch(gomock.Any(), userID, gomock.Any()).DoAndReturn(
+				func(_ context.Context, _ uuid.UUID, batch []BatchElement) error {
+					assert.Equal(t, "a1", batch[0].ShortURL)
+					assert.Equal(t, "a3", batch[1].ShortURL)
+					return nil
+				}),
+		)
+
+		sh := newShortenerObject(m, sequence("a1", "a2", "a3"), cfg)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten/batch",
+			strings.NewReader(`[{"correlation_id":"1","original_url":"http://site.ru/1"},{"correlation_id":"2","original_url":"http://site.ru/2"}]`))
+		req = withUser(req, userID)
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		sh.CreateShorteningJSONBatch(rec, req)
+
+		require.Equal(t, http.StatusCreated, rec.Code)
+		result := make([]batchElement, 0, 2)
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+		assert.Equal(t, cfg.BaseURL+"a1", result[0].ShortURL)
+		assert.Equal(t, cfg.BaseURL+"a3", result[1].ShortURL)
+	})
+}
+
+func TestCreateShorteningAlias(t *testing.T) {
+	cfg = config.InitConfig()
+	userID := uuid.NewV4()
+
+	tests := []struct {
+		name     string
+		body     string
+		prepare  func(m *MockStorager)
+		wantCode int
+		wantBody string
+	}{
+		{
+			name: "alias is used as shortening",
+			body: `{"url":"http://site.ru","alias":"spring-sale"}`,
+			prepare: func(m *MockStorager) {
+				m.EXPECT().Insert(gomock.Any(), userID, "spring-sale", "http://site.ru", gomock.Any()).Return(nil)
+			},
+			wantCode: http.StatusCreated,
+			wantBody: `{"result":"` + cfg.BaseURL + `spring-sale"}`,
+		},
+		{
+			name: "taken alias",
+			body: `{"url":"http://site.ru","alias":"spring-sale"}`,
+			prepare: func(m *MockStorager) {
+				m.EXPECT().Insert(gomock.Any(), userID, "spring-sale", "http://site.ru", gomock.Any()).Return(sherr.NewCollisionError("spring-sale"))
+			},
+			wantCode: http.StatusConflict,
+		},
+		{
+			name:     "reserved alias",
+			body:     `{"url":"http://site.ru","alias":"Ping"}`,
+			prepare:  func(m *MockStorager) {},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "alias doesn't match pattern",
+			body:     `{"url":"http://site.ru","alias":"spring/sale"}`,
+			prepare:  func(m *MockStorager) {},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMockStorager(gomock.NewController(t))
+			tt.prepare(m)
+
+			sh := newShortenerObject(m, sequence("generated"), cfg)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(tt.body))
+			req = withUser(req, userID)
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			sh.CreateShorteningJSON(rec, req)
+
+			assert.Equal(t, tt.wantCode, rec.Code)
+			if tt.wantBody != "" {
+				assert.JSONEq(t, tt.wantBody, rec.Body.String())
+			}
+		})
+	}
+
+	t.Run("taken alias in batch", func(t *testing.T) {
+		m := NewMockStorager(gomock.NewController(t))
+		m.EXPECT().InsertBatch(gomock.Any(), userID, gomock.Any()).Return(sherr.NewCollisionError("spring-sale"))
+
+		sh := newShortenerObject(m, sequence("generated"), cfg)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten/batch",
+			strings.NewReader(`[{"correlation_id":"1","original_url":"http://site.ru/1","alias":"spring-sale"},{"correlation_id":"2","original_url":"http://site.ru/2"}]`))
+		req = withUser(req, userID)
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		sh.CreateShorteningJSONBatch(rec, req)
+
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("repeated alias in batch", func(t *testing.T) {
+		m := NewMockStorager(gomock.NewController(t))
+
+		sh := newShortenerObject(m, sequence("generated"), cfg)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten/batch",
+			strings.NewReader(`[{"correlation_id":"1","original_url":"http://site.ru/1","alias":"spring-sale"},{"correlation_id":"2","original_url":"http://site.ru/2","alias":"spring-sale"}]`))
+		req = withUser(req, userID)
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		sh.CreateShorteningJSONBatch(rec, req)
+
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+}
+
+func TestCreateShorteningExpiration(t *testing.T) {
+	cfg = config.InitConfig()
+	userID := uuid.NewV4()
+
+	t.Run("ttl sets expiration time", func(t *testing.T) {
+		m := NewMockStorager(gomock.NewController(t))
+		m.EXPECT().Insert(gomock.Any(), userID, "short", "http://site.ru", gomock.Any()).DoAndReturn(
+			func(_ context.Context, _ uuid.UUID, _, _ string, opts LinkOptions) error {
+				require.NotNil(t, opts.ExpiresAt)
+				assert.WithinDuration(t, time.Now().Add(24*time.Hour), *opts.ExpiresAt, time.Minute)
+				return nil
+			})
+
+		sh := newShortenerObject(m, sequence("short"), cfg)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url":"http://site.ru","ttl":"24h"}`))
+		req = withUser(req, userID)
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		sh.CreateShorteningJSON(rec, req)
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+	})
+
+	for name, body := range map[string]string{
+		"invalid ttl":            `{"url":"http://site.ru","ttl":"-1h"}`,
+		"expiration in the past": `{"url":"http://site.ru","expires_at":"2020-01-01T00:00:00Z"}`,
+		"ttl and expiration":     `{"url":"http://site.ru","ttl":"1h","expires_at":"2100-01-01T00:00:00Z"}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			m := NewMockStorager(gomock.NewController(t))
+			sh := newShortenerObject(m, sequence("short"), cfg)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body))
+			req = withUser(req, userID)
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			sh.CreateShorteningJSON(rec, req)
+
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+		})
+	}
+
+	t.Run("expired shortening is gone", func(t *testing.T) {
+		m := NewMockStorager(gomock.NewController(t))
+		m.EXPECT().Select(gomock.Any(), "short").Return(Redirect{}, sherr.ErrLinkExpired)
+
+		sh := newShortenerObject(m, sequence("short"), cfg)
+
+		req := httptest.NewRequest(http.MethodGet, "/short", nil)
+		rec := httptest.NewRecorder()
+		sh.GetFullString(rec, withURLParam(req, "id", "short"))
+
+		assert.Equal(t, http.StatusGone, rec.Code)
+	})
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/Alena-Kurushkina/shortener/internal/authenticator"
+	"github.com/Alena-Kurushkina/shortener/internal/logger"
+	"github.com/Alena-Kurushkina/shortener/internal/sherr"
+)
+
+// An APIKeyRequest is for decoding request of API key issuance.
+type APIKeyRequest struct {
+	Name   string   `json:"name,omitempty"`
+	Scopes []string `json:"scopes"`
+}
+
+// An APIKeyResponse is for encoding issued API key with its secret in json.
+type APIKeyResponse struct {
+	authenticator.APIKey
+	Key string `json:"key"`
+}
+
+// CreateAPIKey handle POST request with name and scopes of API key in json body
+// and makes response with issued key. Secret of key is returned only in this response.
+// It handle only requests with content type application/json.
+// post /api/user/keys
+func (sh *Shortener) CreateAPIKey(res http.ResponseWriter, req *http.Request) {
+	res.Header().Set("Content-Type", "application/json")
+
+	id, ok := authenticator.UserFromContext(req.Context())
+	if !ok {
+		http.Error(res, "User is not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	// check content type
+	contentType := req.Header.Get("Content-Type")
+	if contentType != "application/json" && contentType != "application/x-gzip" {
+		http.Error(res, "Invalid content type", http.StatusBadRequest)
+		return
+	}
+
+	// decode request body
+	var keyReq APIKeyRequest
+	if err := json.NewDecoder(req.Body).Decode(&keyReq); err != nil {
+		http.Error(res, "Can't read body", http.StatusBadRequest)
+		return
+	}
+	if err := authenticator.CheckScopes(keyReq.Scopes); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	secret, err := authenticator.GenerateAPIKey()
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	key := authenticator.APIKey{
+		ID:        uuid.NewV4().String(),
+		Name:      keyReq.Name,
+		Scopes:    keyReq.Scopes,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+		UserID:    id,
+	}
+	if err = sh.apiKeys.InsertAPIKey(req.Context(), key, authenticator.HashAPIKey(secret)); err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Log.Infof("API key %s was issued to user %s", key.ID, id)
+
+	responseData, err := json.Marshal(APIKeyResponse{APIKey: key, Key: secret})
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	res.WriteHeader(http.StatusCreated)
+	res.Write(responseData)
+}
+
+// GetUserAPIKeys handle GET request and makes response with user's active API keys
+// without their secrets in json format.
+// get /api/user/keys
+func (sh *Shortener) GetUserAPIKeys(res http.ResponseWriter, req *http.Request) {
+	res.Header().Set("Content-Type", "application/json")
+
+	id, ok := authenticator.UserFromContext(req.Context())
+	if !ok {
+		http.Error(res, "User is not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	keys, err := sh.apiKeys.SelectUserAPIKeys(req.Context(), id)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(keys) == 0 {
+		res.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	responseData, err := json.Marshal(keys)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	res.WriteHeader(http.StatusOK)
+	res.Write(responseData)
+}
+
+// RevokeAPIKey handle DELETE request with id of API key in URL parameter named id
+// and revokes the key. Requests with revoked key are rejected at once.
+// Only owner of key can revoke it.
+// delete /api/user/keys/{id}
+func (sh *Shortener) RevokeAPIKey(res http.ResponseWriter, req *http.Request) {
+	keyID := chi.URLParam(req, "id")
+	if keyID == "" {
+		http.Error(res, "Bad parameters", http.StatusBadRequest)
+		return
+	}
+
+	id, ok := authenticator.UserFromContext(req.Context())
+	if !ok {
+		http.Error(res, "User is not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	err := sh.apiKeys.RevokeAPIKey(req.Context(), id, keyID)
+	if errors.Is(err, sherr.ErrNotFound) {
+		http.Error(res, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Log.Infof("API key %s of user %s was revoked", keyID, id)
+
+	res.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Alena-Kurushkina/shortener/internal/authenticator"
+	"github.com/Alena-Kurushkina/shortener/internal/config"
+	"github.com/Alena-Kurushkina/shortener/internal/sherr"
+)
+
+func TestCreateAPIKey(t *testing.T) {
+	cfg = config.InitConfig()
+	userID := uuid.NewV4()
+
+	t.Run("key is issued", func(t *testing.T) {
+		var (
+			saved     authenticator.APIKey
+			savedHash string
+		)
+		m := NewMockStorager(gomock.NewController(t))
+		m.EXPECT().InsertAPIKey(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, key authenticator.APIKey, hash string) error {
+				saved, savedHash = key, hash
+				return nil
+			})
+
+		sh := newShortenerObject(m, sequence("short"), cfg)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/user/keys", strings.NewReader(`{"name":"backend","scopes":["create","read"]}`))
+		req = withUser(req, userID)
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		sh.CreateAPIKey(rec, req)
+
+		require.Equal(t, http.StatusCreated, rec.Code)
+		var resp APIKeyResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, "backend", resp.Name)
+		assert.Equal(t, []string{"create", "read"}, resp.Scopes)
+		assert.Equal(t, saved.ID, resp.ID)
+		assert.Equal(t, userID, saved.UserID)
+
+		// only hash of secret is stored
+		require.NotEmpty(t, resp.Key)
+		assert.Equal(t, authenticator.HashAPIKey(resp.Key), savedHash)
+		assert.NotContains(t, savedHash, resp.Key)
+	})
+
+	for name, body := range map[string]string{
+		"no scopes":     `{"name":"backend"}`,
+		"unknown scope": `{"scopes":["read","admin"]}`,
+		"invalid body":  `scopes`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			sh := newShortenerObject(NewMockStorager(gomock.NewController(t)), sequence("short"), cfg)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/user/keys", strings.NewReader(body))
+			req = withUser(req, userID)
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			sh.CreateAPIKey(rec, req)
+
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+		})
+	}
+}
+
+func TestGetUserAPIKeys(t *testing.T) {
+	cfg = config.InitConfig()
+	userID := uuid.NewV4()
+
+	m := NewMockStorager(gomock.NewController(t))
+	gomock.InOrder(
+		m.EXPECT().SelectUserAPIKeys(gomock.Any(), userID).Return([]authenticator.APIKey{{ID: "key", Scopes: []string{"read"}, UserID: userID}}, nil),
+		m.EXPECT().SelectUserAPIKeys(gomock.Any(), userID).Return([]authenticator.APIKey{}, nil),
+	)
+
+	sh := newShortenerObject(m, sequence("short"), cfg)
+
+	rec := httptest.NewRecorder()
+	sh.GetUserAPIKeys(rec, withUser(httptest.NewRequest(http.MethodGet, "/api/user/keys", nil), userID))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `[{"id":"key","scopes":["read"],"created_at":"0001-01-01T00:00:00Z"}]`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	sh.GetUserAPIKeys(rec, withUser(httptest.NewRequest(http.MethodGet, "/api/user/keys", nil), userID))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	cfg = config.InitConfig()
+	userID := uuid.NewV4()
+
+	m := NewMockStorager(gomock.NewController(t))
+	m.EXPECT().RevokeAPIKey(gomock.Any(), userID, "key").Return(nil)
+	m.EXPECT().RevokeAPIKey(gomock.Any(), userID, "unknown").Return(sherr.ErrNotFound)
+
+	sh := newShortenerObject(m, sequence("short"), cfg)
+
+	for id, wantCode := range map[string]int{"key": http.StatusNoContent, "unknown": http.StatusNotFound} {
+		req := withUser(httptest.NewRequest(http.MethodDelete, "/api/user/keys/"+id, nil), userID)
+		rec := httptest.NewRecorder()
+		sh.RevokeAPIKey(rec, withURLParam(req, "id", id))
+		assert.Equal(t, wantCode, rec.Code)
+	}
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/Alena-Kurushkina/shortener/internal/authenticator"
+	"github.com/Alena-Kurushkina/shortener/internal/logger"
+	"github.com/Alena-Kurushkina/shortener/internal/sherr"
+)
+
+// A URLEdit is one change of original URL of shortening.
+type URLEdit struct {
+	OldURL    string    `json:"old_url"`
+	NewURL    string    `json:"new_url"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// UpdateShortening handle PATCH request with new long URL in json body
+// and makes shortening from URL parameter named id lead to it.
+// Only owner of shortening can change it.
+// It handle only requests with content type application/json.
+// patch /api/user/urls/{id}
+func (sh *Shortener) UpdateShortening(res http.ResponseWriter, req *http.Request) {
+	res.Header().Set("Content-Type", "application/json")
+
+	key := chi.URLParam(req, "id")
+	if key == "" {
+		http.Error(res, "Bad parameters", http.StatusBadRequest)
+		return
+	}
+
+	id, ok := authenticator.UserFromContext(req.Context())
+	if !ok {
+		http.Error(res, "User is not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	// check content type
+	contentType := req.Header.Get("Content-Type")
+	if contentType != "application/json" && contentType != "application/x-gzip" {
+		http.Error(res, "Invalid content type", http.StatusBadRequest)
+		return
+	}
+
+	// decode request body
+	var url URLRequest
+	if err := json.NewDecoder(req.Body).Decode(&url); err != nil {
+		http.Error(res, "Can't read body", http.StatusBadRequest)
+		return
+	}
+	if len(url.URL) == 0 {
+		http.Error(res, "Body is empty", http.StatusBadRequest)
+		return
+	}
+
+	logger.Log.Infof("Handle route /api/user/urls/%s, method PATCH, body: %s", key, url.URL)
+
+	err := sh.links.UpdateOriginalURL(req.Context(), id, key, url.URL)
+
+	var existError *sherr.AlreadyExistError
+	if errors.As(err, &existError) {
+		responseData, err := json.Marshal(ResultResponse{
+			Result: sh.config.BaseURL + existError.ExistShortStr,
+		})
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		res.WriteHeader(http.StatusConflict)
+		res.Write(responseData)
+		return
+	} else if errors.Is(err, sherr.ErrNotFound) {
+		http.Error(res, err.Error(), http.StatusNotFound)
+		return
+	} else if errors.Is(err, sherr.ErrDBRecordDeleted) {
+		http.Error(res, err.Error(), http.StatusGone)
+		return
+	} else if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	responseData, err := json.Marshal(ResultResponse{
+		Result: sh.config.BaseURL + key,
+	})
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	res.WriteHeader(http.StatusOK)
+	res.Write(responseData)
+}
+
+// GetShorteningHistory handle GET request with shortening in URL parameter named id
+// and makes response with changes of its original URL ordered by time in json format.
+// Only owner of shortening gets history.
+// get /api/user/urls/{id}/history
+func (sh *Shortener) GetShorteningHistory(res http.ResponseWriter, req *http.Request) {
+	res.Header().Set("Content-Type", "application/json")
+
+	key := chi.URLParam(req, "id")
+	if key == "" {
+		http.Error(res, "Bad parameters", http.StatusBadRequest)
+		return
+	}
+
+	id, ok := authenticator.UserFromContext(req.Context())
+	if !ok {
+		http.Error(res, "User is not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	history, err := sh.history.SelectHistory(req.Context(), id, key)
+	if errors.Is(err, sherr.ErrNotFound) {
+		http.Error(res, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	responseData, err := json.Marshal(history)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	res.WriteHeader(http.StatusOK)
+	res.Write(responseData)
+}
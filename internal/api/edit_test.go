@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Alena-Kurushkina/shortener/internal/config"
+	"github.com/Alena-Kurushkina/shortener/internal/sherr"
+)
+
+func TestUpdateShortening(t *testing.T) {
+	cfg = config.InitConfig()
+	userID := uuid.NewV4()
+
+	tests := []struct {
+		name     string
+		body     string
+		repoErr  error
+		wantCode int
+		wantBody string
+	}{
+		{name: "original URL is changed", body: `{"url":"http://site.ru/new"}`, wantCode: http.StatusOK, wantBody: `{"result":"` + cfg.BaseURL + `short"}`},
+		{name: "URL has another shortening", body: `{"url":"http://site.ru/new"}`, repoErr: sherr.NewAlreadyExistError("http://site.ru/new", "other"), wantCode: http.StatusConflict, wantBody: `{"result":"` + cfg.BaseURL + `other"}`},
+		{name: "shortening of another user", body: `{"url":"http://site.ru/new"}`, repoErr: sherr.ErrNotFound, wantCode: http.StatusNotFound},
+		{name: "deleted shortening", body: `{"url":"http://site.ru/new"}`, repoErr: sherr.ErrDBRecordDeleted, wantCode: http.StatusGone},
+		{name: "empty URL", body: `{"url":""}`, wantCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMockStorager(gomock.NewController(t))
+			if tt.wantCode != http.StatusBadRequest {
+				m.EXPECT().UpdateOriginalURL(gomock.Any(), userID, "short", "http://site.ru/new").Return(tt.repoErr)
+			}
+
+			sh := newShortenerObject(m, sequence("short"), cfg)
+
+			req := httptest.NewRequest(http.MethodPatch, "/api/user/urls/short", strings.NewReader(tt.body))
+			req = withUser(req, userID)
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			sh.UpdateShortening(rec, withURLParam(req, "id", "short"))
+
+			assert.Equal(t, tt.wantCode, rec.Code)
+			if tt.wantBody != "" {
+				assert.JSONEq(t, tt.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetShorteningHistory(t *testing.T) {
+	cfg = config.InitConfig()
+	userID := uuid.NewV4()
+	changedAt := time.Date(2024, time.March, 1, 10, 0, 0, 0, time.UTC)
+
+	m := NewMockStorager(gomock.NewController(t))
+	m.EXPECT().SelectHistory(gomock.Any(), userID, "short").Return([]URLEdit{
+		{OldURL: "http://site.ru/1", NewURL: "http://site.ru/2", ChangedAt: changedAt},
+	}, nil)
+
+	sh := newShortenerObject(m, sequence("short"), cfg)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/user/urls/short/history", nil)
+	req = withUser(req, userID)
+	rec := httptest.NewRecorder()
+	sh.GetShorteningHistory(rec, withURLParam(req, "id", "short"))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `[{"old_url":"http://site.ru/1","new_url":"http://site.ru/2","changed_at":"2024-03-01T10:00:00Z"}]`, rec.Body.String())
+}
@@ -0,0 +1,226 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/Alena-Kurushkina/shortener/internal/authenticator"
+)
+
+// Statuses of deletion job.
+const (
+	JobPending = "pending"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// Outcomes of deletion of one shortening.
+const (
+	CodeDeleted  = "deleted"
+	CodeNotFound = "not_found"
+	CodeFailed   = "failed"
+)
+
+// maxDeleteAttempts limits number of attempts to delete batch of records.
+const maxDeleteAttempts = 4
+
+// deleteRetryDelay is delay before the second attempt to delete batch of records,
+// every next delay is twice longer.
+const deleteRetryDelay = time.Second
+
+// deleteQueueRetryAfter is delay suggested to client when deletion queue is full.
+const deleteQueueRetryAfter = 5 * time.Second
+
+// restoreQueueRetryAfter is delay suggested to client when restoring queue is full.
+const restoreQueueRetryAfter = 5 * time.Second
+
+// deleteJobTTL defines how long finished deletion jobs are kept.
+const deleteJobTTL = 24 * time.Hour
+
+// A CodeResult reports outcome of deletion of one shortening.
+type CodeResult struct {
+	ShortURL string `json:"short_url"`
+	Status   string `json:"status"`
+}
+
+// A DeleteJob represents user's deletion request which is performed in background.
+type DeleteJob struct {
+	ID       string       `json:"id"`
+	Status   string       `json:"status"`
+	Attempts int          `json:"attempts"`
+	Error    string       `json:"error,omitempty"`
+	Results  []CodeResult `json:"results"`
+
+	userID     uuid.UUID
+	finishedAt time.Time
+}
+
+// A DeleteJobResponse is for encoding id of accepted deletion job in json.
+type DeleteJobResponse struct {
+	JobID string `json:"job_id"`
+}
+
+// A deleteJobs keeps deletion jobs by their ids.
+type deleteJobs struct {
+	mu   sync.Mutex
+	jobs map[string]*DeleteJob
+}
+
+func newDeleteJobs() *deleteJobs {
+	return &deleteJobs{jobs: make(map[string]*DeleteJob)}
+}
+
+// add creates pending job of deletion of user's shortenings and returns its id.
+func (j *deleteJobs) add(userID uuid.UUID, ids []string) string {
+	id := uuid.NewV4().String()
+	j.put(id, userID, ids)
+	return id
+}
+
+// put saves pending job of deletion of user's shortenings by its id.
+// Jobs finished longer than deleteJobTTL ago are dropped.
+func (j *deleteJobs) put(id string, userID uuid.UUID, ids []string) {
+	job := &DeleteJob{
+		ID:      id,
+		Status:  JobPending,
+		Results: make([]CodeResult, 0, len(ids)),
+		userID:  userID,
+	}
+	for _, id := range ids {
+		job.Results = append(job.Results, CodeResult{ShortURL: id, Status: JobPending})
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	for k, v := range j.jobs {
+		if v.Status != JobPending && now.Sub(v.finishedAt) > deleteJobTTL {
+			delete(j.jobs, k)
+		}
+	}
+	j.jobs[job.ID] = job
+}
+
+// remove drops job which was not accepted.
+func (j *deleteJobs) remove(id string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	delete(j.jobs, id)
+}
+
+// get returns copy of user's job.
+func (j *deleteJobs) get(userID uuid.UUID, id string) (DeleteJob, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	job, ok := j.jobs[id]
+	if !ok || !uuid.Equal(job.userID, userID) {
+		return DeleteJob{}, false
+	}
+
+	res := *job
+	res.Results = append(make([]CodeResult, 0, len(job.Results)), job.Results...)
+	return res, true
+}
+
+// attempt counts new attempt to perform jobs of items.
+func (j *deleteJobs) attempt(items []DeleteItem) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, item := range items {
+		if job, ok := j.jobs[item.JobID]; ok {
+			job.Attempts++
+		}
+	}
+}
+
+// finish marks jobs of items as done. Requested shortenings which are absent
+// in corresponding deleted item are reported as not found.
+func (j *deleteJobs) finish(items, deleted []DeleteItem) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	for k, item := range items {
+		job, ok := j.jobs[item.JobID]
+		if !ok {
+			continue
+		}
+		done := make(map[string]struct{}, len(deleted[k].IDs))
+		for _, id := range deleted[k].IDs {
+			done[id] = struct{}{}
+		}
+		for i, v := range job.Results {
+			if _, ok := done[v.ShortURL]; ok {
+				job.Results[i].Status = CodeDeleted
+			} else {
+				job.Results[i].Status = CodeNotFound
+			}
+		}
+		job.Status = JobDone
+		job.Error = ""
+		job.finishedAt = now
+	}
+}
+
+// fail marks jobs of items as failed with error.
+func (j *deleteJobs) fail(items []DeleteItem, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	for _, item := range items {
+		job, ok := j.jobs[item.JobID]
+		if !ok {
+			continue
+		}
+		for i := range job.Results {
+			job.Results[i].Status = CodeFailed
+		}
+		job.Status = JobFailed
+		job.Error = err.Error()
+		job.finishedAt = now
+	}
+}
+
+// GetDeleteJob handle GET request with id of deletion job in URL parameter named id
+// and makes response with status of job and outcomes of deletion of every shortening in json format.
+// Only user who made deletion request gets its status.
+// get /api/user/urls/delete-jobs/{id}
+func (sh *Shortener) GetDeleteJob(res http.ResponseWriter, req *http.Request) {
+	res.Header().Set("Content-Type", "application/json")
+
+	jobID := chi.URLParam(req, "id")
+	if jobID == "" {
+		http.Error(res, "Bad parameters", http.StatusBadRequest)
+		return
+	}
+
+	id, ok := authenticator.UserFromContext(req.Context())
+	if !ok {
+		http.Error(res, "User is not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	job, ok := sh.jobs.get(id, jobID)
+	if !ok {
+		http.Error(res, "Deletion job not found", http.StatusNotFound)
+		return
+	}
+
+	responseData, err := json.Marshal(job)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	res.WriteHeader(http.StatusOK)
+	res.Write(responseData)
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Alena-Kurushkina/shortener/internal/config"
+)
+
+// requestDeletion makes deletion request of user's shortenings and returns id of deletion job.
+func requestDeletion(t *testing.T, sh *Shortener, userID uuid.UUID, body string) string {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/user/urls", strings.NewReader(body))
+	req = withUser(req, userID)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	sh.DeleteRecordJSON(rec, req)
+
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	var resp DeleteJobResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.NotEmpty(t, resp.JobID)
+	assert.Equal(t, cfg.BaseURL+"api/user/urls/delete-jobs/"+resp.JobID, rec.Header().Get("Location"))
+
+	return resp.JobID
+}
+
+// getDeleteJob requests status of deletion job.
+func getDeleteJob(sh *Shortener, userID uuid.UUID, jobID string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/user/urls/delete-jobs/"+jobID, nil)
+	req = withUser(req, userID)
+	rec := httptest.NewRecorder()
+	sh.GetDeleteJob(rec, withURLParam(req, "id", jobID))
+	return rec
+}
+
+func TestDeleteJob(t *testing.T) {
+	cfg = config.InitConfig()
+	userID := uuid.NewV4()
+
+	t.Run("job is done after retry", func(t *testing.T) {
+		m := NewMockStorager(gomock.NewController(t))
+		m.EXPECT().QueueDeletion(gomock.Any(), gomock.Any()).Return(nil)
+		gomock.InOrder(
+			m.EXPECT().DeleteRecords(gomock.Any(), gomock.Any()).Return(nil, errors.New("connection lost")),
+			m.EXPECT().DeleteRecords(gomock.Any(), gomock.Any()).Return([]DeleteItem{{UserID: userID, IDs: []string{"short1"}}}, nil),
+		)
+		m.EXPECT().DequeueDeletions(gomock.Any(), gomock.Len(1)).Return(nil)
+
+		sh := newShortenerObject(m, sequence("short"), cfg)
+		sh.retryDelay = time.Millisecond
+
+		jobID := requestDeletion(t, sh, userID, `["short1","short2"]`)
+
+		rec := getDeleteJob(sh, userID, jobID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"id":"`+jobID+`","status":"pending","attempts":0,"results":[
+			{"short_url":"short1","status":"pending"},{"short_url":"short2","status":"pending"}]}`, rec.Body.String())
+
+		sh.deleteRecords([]DeleteItem{<-sh.deleteChan})
+
+		rec = getDeleteJob(sh, userID, jobID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"id":"`+jobID+`","status":"done","attempts":2,"results":[
+			{"short_url":"short1","status":"deleted"},{"short_url":"short2","status":"not_found"}]}`, rec.Body.String())
+
+		// job is visible only to its owner
+		assert.Equal(t, http.StatusNotFound, getDeleteJob(sh, uuid.NewV4(), jobID).Code)
+		assert.Equal(t, http.StatusNotFound, getDeleteJob(sh, userID, "unknown").Code)
+	})
+
+	t.Run("job fails after all attempts", func(t *testing.T) {
+		m := NewMockStorager(gomock.NewController(t))
+		m.EXPECT().QueueDeletion(gomock.Any(), gomock.Any()).Return(nil)
+		// failed request stays in queue
+		m.EXPECT().DeleteRecords(gomock.Any(), gomock.Any()).Return(nil, errors.New("connection lost")).Times(maxDeleteAttempts)
+
+		sh := newShortenerObject(m, sequence("short"), cfg)
+		sh.retryDelay = time.Millisecond
+
+		jobID := requestDeletion(t, sh, userID, `["short1"]`)
+		sh.deleteRecords([]DeleteItem{<-sh.deleteChan})
+
+		rec := getDeleteJob(sh, userID, jobID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"id":"`+jobID+`","status":"failed","attempts":4,"error":"connection lost","results":[
+			{"short_url":"short1","status":"failed"}]}`, rec.Body.String())
+	})
+}
+
+func TestDeleteQueue(t *testing.T) {
+	cfg = config.InitConfig()
+	userID := uuid.NewV4()
+
+	t.Run("full queue rejects request", func(t *testing.T) {
+		m := NewMockStorager(gomock.NewController(t))
+		m.EXPECT().QueueDeletion(gomock.Any(), gomock.Any()).Return(nil)
+		m.EXPECT().DequeueDeletions(gomock.Any(), gomock.Len(1)).Return(nil)
+
+		sh := newShortenerObject(m, sequence("short"), cfg)
+		sh.deleteChan = make(chan DeleteItem)
+
+		req := httptest.NewRequest(http.MethodDelete, "/api/user/urls", strings.NewReader(`["short1"]`))
+		req = withUser(req, userID)
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		sh.DeleteRecordJSON(rec, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.Equal(t, "5", rec.Header().Get("Retry-After"))
+		assert.Empty(t, sh.jobs.jobs)
+	})
+
+	t.Run("queued requests are replayed", func(t *testing.T) {
+		queued := DeleteItem{JobID: "job", UserID: userID, IDs: []string{"short1"}}
+
+		m := NewMockStorager(gomock.NewController(t))
+		m.EXPECT().SelectQueuedDeletions(gomock.Any()).Return([]DeleteItem{queued}, nil)
+		m.EXPECT().DeleteRecords(gomock.Any(), []DeleteItem{queued}).Return([]DeleteItem{{UserID: userID, IDs: []string{"short1"}}}, nil)
+		m.EXPECT().DequeueDeletions(gomock.Any(), []string{"job"}).Return(nil)
+
+		sh := newShortenerObject(m, sequence("short"), cfg)
+		sh.deleteRecords(sh.queuedDeletions())
+
+		rec := getDeleteJob(sh, userID, "job")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"id":"job","status":"done","attempts":1,"results":[{"short_url":"short1","status":"deleted"}]}`, rec.Body.String())
+	})
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Limits of number of shortenings on one page of user's list.
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+// A ListCursor points to the last shortening of previous page of user's list.
+// Shortenings are ordered by creation time, shortening breaks ties.
+type ListCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ShortURL  string    `json:"s"`
+}
+
+// A ListQuery defines page of user's shortenings.
+// Search selects shortenings which original URL contains it ignoring case.
+// Deleted selects deleted or not deleted shortenings if it is set.
+type ListQuery struct {
+	Limit   int
+	After   *ListCursor
+	Desc    bool
+	Search  string
+	Deleted *bool
+}
+
+// encodeCursor makes opaque string representation of cursor for URL.
+func encodeCursor(cursor *ListCursor) (string, error) {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor parses cursor made by encodeCursor.
+func decodeCursor(s string) (*ListCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	cursor := &ListCursor{}
+	if err = json.Unmarshal(data, cursor); err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	return cursor, nil
+}
+
+// parseListQuery reads page parameters limit, cursor, order, search and deleted from URL query.
+func parseListQuery(q url.Values) (ListQuery, error) {
+	query := ListQuery{Limit: defaultPageLimit, Search: q.Get("search")}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > maxPageLimit {
+			return query, errors.New("limit must be number from 1 to " + strconv.Itoa(maxPageLimit))
+		}
+		query.Limit = limit
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		cursor, err := decodeCursor(v)
+		if err != nil {
+			return query, err
+		}
+		query.After = cursor
+	}
+
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		query.Desc = true
+	default:
+		return query, errors.New("order must be asc or desc")
+	}
+
+	if v := q.Get("deleted"); v != "" {
+		deleted, err := strconv.ParseBool(v)
+		if err != nil {
+			return query, errors.New("deleted must be true or false")
+		}
+		query.Deleted = &deleted
+	}
+
+	return query, nil
+}
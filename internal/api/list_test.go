@@ -0,0 +1,105 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Alena-Kurushkina/shortener/internal/config"
+)
+
+func TestParseListQuery(t *testing.T) {
+	cursor := &ListCursor{CreatedAt: time.Date(2024, time.March, 1, 10, 0, 0, 0, time.UTC), ShortURL: "short"}
+	encoded, err := encodeCursor(cursor)
+	require.NoError(t, err)
+
+	deleted := true
+	tests := []struct {
+		name    string
+		query   string
+		want    ListQuery
+		wantErr bool
+	}{
+		{name: "defaults", query: "", want: ListQuery{Limit: defaultPageLimit}},
+		{
+			name:  "all parameters",
+			query: "limit=10&cursor=" + encoded + "&order=desc&search=site&deleted=true",
+			want:  ListQuery{Limit: 10, After: cursor, Desc: true, Search: "site", Deleted: &deleted},
+		},
+		{name: "zero limit", query: "limit=0", wantErr: true},
+		{name: "too big limit", query: "limit=100000", wantErr: true},
+		{name: "invalid cursor", query: "cursor=abc", wantErr: true},
+		{name: "invalid order", query: "order=random", wantErr: true},
+		{name: "invalid deleted", query: "deleted=maybe", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := url.ParseQuery(tt.query)
+			require.NoError(t, err)
+
+			got, err := parseListQuery(q)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestGetUserAllShorteningsPage(t *testing.T) {
+	cfg = config.InitConfig()
+	userID := uuid.NewV4()
+	next := &ListCursor{CreatedAt: time.Date(2024, time.March, 1, 10, 0, 0, 0, time.UTC), ShortURL: "short2"}
+
+	m := NewMockStorager(gomock.NewController(t))
+	m.EXPECT().SelectUserPage(gomock.Any(), userID, ListQuery{Limit: 2, Search: "site"}).Return([]BatchElement{
+		{OriginalURL: "http://site.ru/1", ShortURL: "short1"},
+		{OriginalURL: "http://site.ru/2", ShortURL: "short2"},
+	}, next, nil)
+
+	sh := newShortenerObject(m, sequence("short"), cfg)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/user/urls?limit=2&search=site", nil)
+	req = withUser(req, userID)
+	rec := httptest.NewRecorder()
+	sh.GetUserAllShortenings(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `[
+		{"correlation_id": "", "original_url": "http://site.ru/1", "short_url": "`+cfg.BaseURL+`short1"},
+		{"correlation_id": "", "original_url": "http://site.ru/2", "short_url": "`+cfg.BaseURL+`short2"}
+	]`, rec.Body.String())
+
+	link := rec.Header().Get("Link")
+	require.True(t, strings.HasPrefix(link, "<"+cfg.BaseURL+"api/user/urls?"), link)
+	require.True(t, strings.HasSuffix(link, `>; rel="next"`), link)
+	assert.NotContains(t, link, userID.String())
+
+	linkURL, err := url.Parse(strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`))
+	require.NoError(t, err)
+	got, err := parseListQuery(linkURL.Query())
+	require.NoError(t, err)
+	assert.Equal(t, ListQuery{Limit: 2, Search: "site", After: next}, got)
+}
+
+func TestGetUserAllShorteningsUnauthenticated(t *testing.T) {
+	cfg = config.InitConfig()
+	sh := newShortenerObject(NewMockStorager(gomock.NewController(t)), sequence("short"), cfg)
+
+	// user id in query doesn't authenticate request
+	req := httptest.NewRequest(http.MethodGet, "/api/user/urls?userUUID="+uuid.NewV4().String(), nil)
+	rec := httptest.NewRecorder()
+	sh.GetUserAllShortenings(rec, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
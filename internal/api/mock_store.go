@@ -7,11 +7,579 @@ package api
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
+	authenticator "github.com/Alena-Kurushkina/shortener/internal/authenticator"
 	gomock "github.com/golang/mock/gomock"
 	go_uuid "github.com/satori/go.uuid"
 )
 
+// MockLinkStore is a mock of LinkStore interface.
+type MockLinkStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockLinkStoreMockRecorder
+}
+
+// MockLinkStoreMockRecorder is the mock recorder for MockLinkStore.
+type MockLinkStoreMockRecorder struct {
+	mock *MockLinkStore
+}
+
+// NewMockLinkStore creates a new mock instance.
+func NewMockLinkStore(ctrl *gomock.Controller) *MockLinkStore {
+	mock := &MockLinkStore{ctrl: ctrl}
+	mock.recorder = &MockLinkStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLinkStore) EXPECT() *MockLinkStoreMockRecorder {
+	return m.recorder
+}
+
+// DeleteExpired mocks base method.
+func (m *MockLinkStore) DeleteExpired(ctx context.Context, now time.Time) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteExpired", ctx, now)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteExpired indicates an expected call of DeleteExpired.
+func (mr *MockLinkStoreMockRecorder) DeleteExpired(ctx, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteExpired", reflect.TypeOf((*MockLinkStore)(nil).DeleteExpired), ctx, now)
+}
+
+// DeleteRecords mocks base method.
+func (m *MockLinkStore) DeleteRecords(ctx context.Context, deleteItems []DeleteItem) ([]DeleteItem, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteRecords", ctx, deleteItems)
+	ret0, _ := ret[0].([]DeleteItem)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteRecords indicates an expected call of DeleteRecords.
+func (mr *MockLinkStoreMockRecorder) DeleteRecords(ctx, deleteItems interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteRecords", reflect.TypeOf((*MockLinkStore)(nil).DeleteRecords), ctx, deleteItems)
+}
+
+// Insert mocks base method.
+func (m *MockLinkStore) Insert(ctx context.Context, userID go_uuid.UUID, key, value string, opts LinkOptions) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Insert", ctx, userID, key, value, opts)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Insert indicates an expected call of Insert.
+func (mr *MockLinkStoreMockRecorder) Insert(ctx, userID, key, value, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Insert", reflect.TypeOf((*MockLinkStore)(nil).Insert), ctx, userID, key, value, opts)
+}
+
+// InsertBatch mocks base method.
+func (m *MockLinkStore) InsertBatch(arg0 context.Context, userID go_uuid.UUID, batch []BatchElement) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertBatch", arg0, userID, batch)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertBatch indicates an expected call of InsertBatch.
+func (mr *MockLinkStoreMockRecorder) InsertBatch(arg0, userID, batch interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertBatch", reflect.TypeOf((*MockLinkStore)(nil).InsertBatch), arg0, userID, batch)
+}
+
+// PurgeDeleted mocks base method.
+func (m *MockLinkStore) PurgeDeleted(ctx context.Context, before time.Time) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeDeleted", ctx, before)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeDeleted indicates an expected call of PurgeDeleted.
+func (mr *MockLinkStoreMockRecorder) PurgeDeleted(ctx, before interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeDeleted", reflect.TypeOf((*MockLinkStore)(nil).PurgeDeleted), ctx, before)
+}
+
+// RestoreRecords mocks base method.
+func (m *MockLinkStore) RestoreRecords(ctx context.Context, restoreItems []DeleteItem) ([]DeleteItem, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreRecords", ctx, restoreItems)
+	ret0, _ := ret[0].([]DeleteItem)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RestoreRecords indicates an expected call of RestoreRecords.
+func (mr *MockLinkStoreMockRecorder) RestoreRecords(ctx, restoreItems interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreRecords", reflect.TypeOf((*MockLinkStore)(nil).RestoreRecords), ctx, restoreItems)
+}
+
+// Select mocks base method.
+func (m *MockLinkStore) Select(ctx context.Context, key string) (Redirect, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Select", ctx, key)
+	ret0, _ := ret[0].(Redirect)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Select indicates an expected call of Select.
+func (mr *MockLinkStoreMockRecorder) Select(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Select", reflect.TypeOf((*MockLinkStore)(nil).Select), ctx, key)
+}
+
+// SelectUserAll mocks base method.
+func (m *MockLinkStore) SelectUserAll(ctx context.Context, userID go_uuid.UUID) ([]BatchElement, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectUserAll", ctx, userID)
+	ret0, _ := ret[0].([]BatchElement)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectUserAll indicates an expected call of SelectUserAll.
+func (mr *MockLinkStoreMockRecorder) SelectUserAll(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectUserAll", reflect.TypeOf((*MockLinkStore)(nil).SelectUserAll), ctx, userID)
+}
+
+// SelectUserPage mocks base method.
+func (m *MockLinkStore) SelectUserPage(ctx context.Context, userID go_uuid.UUID, query ListQuery) ([]BatchElement, *ListCursor, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectUserPage", ctx, userID, query)
+	ret0, _ := ret[0].([]BatchElement)
+	ret1, _ := ret[1].(*ListCursor)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// SelectUserPage indicates an expected call of SelectUserPage.
+func (mr *MockLinkStoreMockRecorder) SelectUserPage(ctx, userID, query interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectUserPage", reflect.TypeOf((*MockLinkStore)(nil).SelectUserPage), ctx, userID, query)
+}
+
+// UpdateOriginalURL mocks base method.
+func (m *MockLinkStore) UpdateOriginalURL(ctx context.Context, userID go_uuid.UUID, key, originalURL string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateOriginalURL", ctx, userID, key, originalURL)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateOriginalURL indicates an expected call of UpdateOriginalURL.
+func (mr *MockLinkStoreMockRecorder) UpdateOriginalURL(ctx, userID, key, originalURL interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOriginalURL", reflect.TypeOf((*MockLinkStore)(nil).UpdateOriginalURL), ctx, userID, key, originalURL)
+}
+
+// MockHistoryStore is a mock of HistoryStore interface.
+type MockHistoryStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockHistoryStoreMockRecorder
+}
+
+// MockHistoryStoreMockRecorder is the mock recorder for MockHistoryStore.
+type MockHistoryStoreMockRecorder struct {
+	mock *MockHistoryStore
+}
+
+// NewMockHistoryStore creates a new mock instance.
+func NewMockHistoryStore(ctrl *gomock.Controller) *MockHistoryStore {
+	mock := &MockHistoryStore{ctrl: ctrl}
+	mock.recorder = &MockHistoryStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockHistoryStore) EXPECT() *MockHistoryStoreMockRecorder {
+	return m.recorder
+}
+
+// SelectHistory mocks base method.
+func (m *MockHistoryStore) SelectHistory(ctx context.Context, userID go_uuid.UUID, key string) ([]URLEdit, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectHistory", ctx, userID, key)
+	ret0, _ := ret[0].([]URLEdit)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectHistory indicates an expected call of SelectHistory.
+func (mr *MockHistoryStoreMockRecorder) SelectHistory(ctx, userID, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectHistory", reflect.TypeOf((*MockHistoryStore)(nil).SelectHistory), ctx, userID, key)
+}
+
+// MockJobStore is a mock of JobStore interface.
+type MockJobStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockJobStoreMockRecorder
+}
+
+// MockJobStoreMockRecorder is the mock recorder for MockJobStore.
+type MockJobStoreMockRecorder struct {
+	mock *MockJobStore
+}
+
+// NewMockJobStore creates a new mock instance.
+func NewMockJobStore(ctrl *gomock.Controller) *MockJobStore {
+	mock := &MockJobStore{ctrl: ctrl}
+	mock.recorder = &MockJobStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockJobStore) EXPECT() *MockJobStoreMockRecorder {
+	return m.recorder
+}
+
+// DequeueDeletions mocks base method.
+func (m *MockJobStore) DequeueDeletions(ctx context.Context, jobIDs []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DequeueDeletions", ctx, jobIDs)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DequeueDeletions indicates an expected call of DequeueDeletions.
+func (mr *MockJobStoreMockRecorder) DequeueDeletions(ctx, jobIDs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DequeueDeletions", reflect.TypeOf((*MockJobStore)(nil).DequeueDeletions), ctx, jobIDs)
+}
+
+// QueueDeletion mocks base method.
+func (m *MockJobStore) QueueDeletion(ctx context.Context, item DeleteItem) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "QueueDeletion", ctx, item)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// QueueDeletion indicates an expected call of QueueDeletion.
+func (mr *MockJobStoreMockRecorder) QueueDeletion(ctx, item interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueueDeletion", reflect.TypeOf((*MockJobStore)(nil).QueueDeletion), ctx, item)
+}
+
+// SelectQueuedDeletions mocks base method.
+func (m *MockJobStore) SelectQueuedDeletions(ctx context.Context) ([]DeleteItem, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectQueuedDeletions", ctx)
+	ret0, _ := ret[0].([]DeleteItem)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectQueuedDeletions indicates an expected call of SelectQueuedDeletions.
+func (mr *MockJobStoreMockRecorder) SelectQueuedDeletions(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectQueuedDeletions", reflect.TypeOf((*MockJobStore)(nil).SelectQueuedDeletions), ctx)
+}
+
+// MockStatsStore is a mock of StatsStore interface.
+type MockStatsStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockStatsStoreMockRecorder
+}
+
+// MockStatsStoreMockRecorder is the mock recorder for MockStatsStore.
+type MockStatsStoreMockRecorder struct {
+	mock *MockStatsStore
+}
+
+// NewMockStatsStore creates a new mock instance.
+func NewMockStatsStore(ctrl *gomock.Controller) *MockStatsStore {
+	mock := &MockStatsStore{ctrl: ctrl}
+	mock.recorder = &MockStatsStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockStatsStore) EXPECT() *MockStatsStoreMockRecorder {
+	return m.recorder
+}
+
+// SaveClicks mocks base method.
+func (m *MockStatsStore) SaveClicks(ctx context.Context, clicks []Click) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveClicks", ctx, clicks)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveClicks indicates an expected call of SaveClicks.
+func (mr *MockStatsStoreMockRecorder) SaveClicks(ctx, clicks interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveClicks", reflect.TypeOf((*MockStatsStore)(nil).SaveClicks), ctx, clicks)
+}
+
+// SelectStats mocks base method.
+func (m *MockStatsStore) SelectStats(ctx context.Context, userID go_uuid.UUID, key string) (ClickStats, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectStats", ctx, userID, key)
+	ret0, _ := ret[0].(ClickStats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectStats indicates an expected call of SelectStats.
+func (mr *MockStatsStoreMockRecorder) SelectStats(ctx, userID, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectStats", reflect.TypeOf((*MockStatsStore)(nil).SelectStats), ctx, userID, key)
+}
+
+// MockAPIKeyStore is a mock of APIKeyStore interface.
+type MockAPIKeyStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockAPIKeyStoreMockRecorder
+}
+
+// MockAPIKeyStoreMockRecorder is the mock recorder for MockAPIKeyStore.
+type MockAPIKeyStoreMockRecorder struct {
+	mock *MockAPIKeyStore
+}
+
+// NewMockAPIKeyStore creates a new mock instance.
+func NewMockAPIKeyStore(ctrl *gomock.Controller) *MockAPIKeyStore {
+	mock := &MockAPIKeyStore{ctrl: ctrl}
+	mock.recorder = &MockAPIKeyStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAPIKeyStore) EXPECT() *MockAPIKeyStoreMockRecorder {
+	return m.recorder
+}
+
+// InsertAPIKey mocks base method.
+func (m *MockAPIKeyStore) InsertAPIKey(ctx context.Context, key authenticator.APIKey, hash string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertAPIKey", ctx, key, hash)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertAPIKey indicates an expected call of InsertAPIKey.
+func (mr *MockAPIKeyStoreMockRecorder) InsertAPIKey(ctx, key, hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertAPIKey", reflect.TypeOf((*MockAPIKeyStore)(nil).InsertAPIKey), ctx, key, hash)
+}
+
+// RevokeAPIKey mocks base method.
+func (m *MockAPIKeyStore) RevokeAPIKey(ctx context.Context, userID go_uuid.UUID, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeAPIKey", ctx, userID, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeAPIKey indicates an expected call of RevokeAPIKey.
+func (mr *MockAPIKeyStoreMockRecorder) RevokeAPIKey(ctx, userID, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeAPIKey", reflect.TypeOf((*MockAPIKeyStore)(nil).RevokeAPIKey), ctx, userID, id)
+}
+
+// SelectAPIKey mocks base method.
+func (m *MockAPIKeyStore) SelectAPIKey(ctx context.Context, hash string) (authenticator.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectAPIKey", ctx, hash)
+	ret0, _ := ret[0].(authenticator.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectAPIKey indicates an expected call of SelectAPIKey.
+func (mr *MockAPIKeyStoreMockRecorder) SelectAPIKey(ctx, hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectAPIKey", reflect.TypeOf((*MockAPIKeyStore)(nil).SelectAPIKey), ctx, hash)
+}
+
+// SelectUserAPIKeys mocks base method.
+func (m *MockAPIKeyStore) SelectUserAPIKeys(ctx context.Context, userID go_uuid.UUID) ([]authenticator.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectUserAPIKeys", ctx, userID)
+	ret0, _ := ret[0].([]authenticator.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectUserAPIKeys indicates an expected call of SelectUserAPIKeys.
+func (mr *MockAPIKeyStoreMockRecorder) SelectUserAPIKeys(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectUserAPIKeys", reflect.TypeOf((*MockAPIKeyStore)(nil).SelectUserAPIKeys), ctx, userID)
+}
+
+// MockSessionStore is a mock of SessionStore interface.
+type MockSessionStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockSessionStoreMockRecorder
+}
+
+// MockSessionStoreMockRecorder is the mock recorder for MockSessionStore.
+type MockSessionStoreMockRecorder struct {
+	mock *MockSessionStore
+}
+
+// NewMockSessionStore creates a new mock instance.
+func NewMockSessionStore(ctrl *gomock.Controller) *MockSessionStore {
+	mock := &MockSessionStore{ctrl: ctrl}
+	mock.recorder = &MockSessionStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSessionStore) EXPECT() *MockSessionStoreMockRecorder {
+	return m.recorder
+}
+
+// InsertSession mocks base method.
+func (m *MockSessionStore) InsertSession(ctx context.Context, session authenticator.Session, hash string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertSession", ctx, session, hash)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertSession indicates an expected call of InsertSession.
+func (mr *MockSessionStoreMockRecorder) InsertSession(ctx, session, hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertSession", reflect.TypeOf((*MockSessionStore)(nil).InsertSession), ctx, session, hash)
+}
+
+// PurgeSessions mocks base method.
+func (m *MockSessionStore) PurgeSessions(ctx context.Context, before time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeSessions", ctx, before)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PurgeSessions indicates an expected call of PurgeSessions.
+func (mr *MockSessionStoreMockRecorder) PurgeSessions(ctx, before interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeSessions", reflect.TypeOf((*MockSessionStore)(nil).PurgeSessions), ctx, before)
+}
+
+// RevokeSession mocks base method.
+func (m *MockSessionStore) RevokeSession(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeSession", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeSession indicates an expected call of RevokeSession.
+func (mr *MockSessionStoreMockRecorder) RevokeSession(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeSession", reflect.TypeOf((*MockSessionStore)(nil).RevokeSession), ctx, id)
+}
+
+// RotateSession mocks base method.
+func (m *MockSessionStore) RotateSession(ctx context.Context, id, oldHash, newHash string, expiresAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RotateSession", ctx, id, oldHash, newHash, expiresAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RotateSession indicates an expected call of RotateSession.
+func (mr *MockSessionStoreMockRecorder) RotateSession(ctx, id, oldHash, newHash, expiresAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RotateSession", reflect.TypeOf((*MockSessionStore)(nil).RotateSession), ctx, id, oldHash, newHash, expiresAt)
+}
+
+// SelectRevokedSessions mocks base method.
+func (m *MockSessionStore) SelectRevokedSessions(ctx context.Context, since time.Time) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectRevokedSessions", ctx, since)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectRevokedSessions indicates an expected call of SelectRevokedSessions.
+func (mr *MockSessionStoreMockRecorder) SelectRevokedSessions(ctx, since interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectRevokedSessions", reflect.TypeOf((*MockSessionStore)(nil).SelectRevokedSessions), ctx, since)
+}
+
+// SelectSession mocks base method.
+func (m *MockSessionStore) SelectSession(ctx context.Context, hash string) (authenticator.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectSession", ctx, hash)
+	ret0, _ := ret[0].(authenticator.Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectSession indicates an expected call of SelectSession.
+func (mr *MockSessionStoreMockRecorder) SelectSession(ctx, hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectSession", reflect.TypeOf((*MockSessionStore)(nil).SelectSession), ctx, hash)
+}
+
+// MockConn is a mock of Conn interface.
+type MockConn struct {
+	ctrl     *gomock.Controller
+	recorder *MockConnMockRecorder
+}
+
+// MockConnMockRecorder is the mock recorder for MockConn.
+type MockConnMockRecorder struct {
+	mock *MockConn
+}
+
+// NewMockConn creates a new mock instance.
+func NewMockConn(ctrl *gomock.Controller) *MockConn {
+	mock := &MockConn{ctrl: ctrl}
+	mock.recorder = &MockConnMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockConn) EXPECT() *MockConnMockRecorder {
+	return m.recorder
+}
+
+// Close mocks base method.
+func (m *MockConn) Close() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Close")
+}
+
+// Close indicates an expected call of Close.
+func (mr *MockConnMockRecorder) Close() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockConn)(nil).Close))
+}
+
+// Ping mocks base method.
+func (m *MockConn) Ping(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Ping", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Ping indicates an expected call of Ping.
+func (mr *MockConnMockRecorder) Ping(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockConn)(nil).Ping), ctx)
+}
+
 // MockStorager is a mock of Storager interface.
 type MockStorager struct {
 	ctrl     *gomock.Controller
@@ -47,12 +615,28 @@ func (mr *MockStoragerMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockStorager)(nil).Close))
 }
 
+// DeleteExpired mocks base method.
+func (m *MockStorager) DeleteExpired(ctx context.Context, now time.Time) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteExpired", ctx, now)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteExpired indicates an expected call of DeleteExpired.
+func (mr *MockStoragerMockRecorder) DeleteExpired(ctx, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteExpired", reflect.TypeOf((*MockStorager)(nil).DeleteExpired), ctx, now)
+}
+
 // DeleteRecords mocks base method.
-func (m *MockStorager) DeleteRecords(ctx context.Context, deleteItems []DeleteItem) error {
+func (m *MockStorager) DeleteRecords(ctx context.Context, deleteItems []DeleteItem) ([]DeleteItem, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "DeleteRecords", ctx, deleteItems)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret0, _ := ret[0].([]DeleteItem)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // DeleteRecords indicates an expected call of DeleteRecords.
@@ -61,18 +645,60 @@ func (mr *MockStoragerMockRecorder) DeleteRecords(ctx, deleteItems interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteRecords", reflect.TypeOf((*MockStorager)(nil).DeleteRecords), ctx, deleteItems)
 }
 
+// DequeueDeletions mocks base method.
+func (m *MockStorager) DequeueDeletions(ctx context.Context, jobIDs []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DequeueDeletions", ctx, jobIDs)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DequeueDeletions indicates an expected call of DequeueDeletions.
+func (mr *MockStoragerMockRecorder) DequeueDeletions(ctx, jobIDs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DequeueDeletions", reflect.TypeOf((*MockStorager)(nil).DequeueDeletions), ctx, jobIDs)
+}
+
 // Insert mocks base method.
-func (m *MockStorager) Insert(ctx context.Context, userID go_uuid.UUID, key, value string) error {
+func (m *MockStorager) Insert(ctx context.Context, userID go_uuid.UUID, key, value string, opts LinkOptions) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Insert", ctx, userID, key, value)
+	ret := m.ctrl.Call(m, "Insert", ctx, userID, key, value, opts)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Insert indicates an expected call of Insert.
-func (mr *MockStoragerMockRecorder) Insert(ctx, userID, key, value interface{}) *gomock.Call {
+func (mr *MockStoragerMockRecorder) Insert(ctx, userID, key, value, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Insert", reflect.TypeOf((*MockStorager)(nil).Insert), ctx, userID, key, value, opts)
+}
+
+// InsertAPIKey mocks base method.
+func (m *MockStorager) InsertAPIKey(ctx context.Context, key authenticator.APIKey, hash string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertAPIKey", ctx, key, hash)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertAPIKey indicates an expected call of InsertAPIKey.
+func (mr *MockStoragerMockRecorder) InsertAPIKey(ctx, key, hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertAPIKey", reflect.TypeOf((*MockStorager)(nil).InsertAPIKey), ctx, key, hash)
+}
+
+// InsertAccount mocks base method.
+func (m *MockStorager) InsertAccount(ctx context.Context, account authenticator.Account, passwordHash string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertAccount", ctx, account, passwordHash)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertAccount indicates an expected call of InsertAccount.
+func (mr *MockStoragerMockRecorder) InsertAccount(ctx, account, passwordHash interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Insert", reflect.TypeOf((*MockStorager)(nil).Insert), ctx, userID, key, value)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertAccount", reflect.TypeOf((*MockStorager)(nil).InsertAccount), ctx, account, passwordHash)
 }
 
 // InsertBatch mocks base method.
@@ -89,6 +715,35 @@ func (mr *MockStoragerMockRecorder) InsertBatch(arg0, userID, batch interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertBatch", reflect.TypeOf((*MockStorager)(nil).InsertBatch), arg0, userID, batch)
 }
 
+// InsertSession mocks base method.
+func (m *MockStorager) InsertSession(ctx context.Context, session authenticator.Session, hash string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertSession", ctx, session, hash)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertSession indicates an expected call of InsertSession.
+func (mr *MockStoragerMockRecorder) InsertSession(ctx, session, hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertSession", reflect.TypeOf((*MockStorager)(nil).InsertSession), ctx, session, hash)
+}
+
+// MergeUsers mocks base method.
+func (m *MockStorager) MergeUsers(ctx context.Context, from, to go_uuid.UUID) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MergeUsers", ctx, from, to)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MergeUsers indicates an expected call of MergeUsers.
+func (mr *MockStoragerMockRecorder) MergeUsers(ctx, from, to interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MergeUsers", reflect.TypeOf((*MockStorager)(nil).MergeUsers), ctx, from, to)
+}
+
 // Ping mocks base method.
 func (m *MockStorager) Ping(ctx context.Context) error {
 	m.ctrl.T.Helper()
@@ -103,11 +758,125 @@ func (mr *MockStoragerMockRecorder) Ping(ctx interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockStorager)(nil).Ping), ctx)
 }
 
+// PurgeDeleted mocks base method.
+func (m *MockStorager) PurgeDeleted(ctx context.Context, before time.Time) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeDeleted", ctx, before)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeDeleted indicates an expected call of PurgeDeleted.
+func (mr *MockStoragerMockRecorder) PurgeDeleted(ctx, before interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeDeleted", reflect.TypeOf((*MockStorager)(nil).PurgeDeleted), ctx, before)
+}
+
+// PurgeSessions mocks base method.
+func (m *MockStorager) PurgeSessions(ctx context.Context, before time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeSessions", ctx, before)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PurgeSessions indicates an expected call of PurgeSessions.
+func (mr *MockStoragerMockRecorder) PurgeSessions(ctx, before interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeSessions", reflect.TypeOf((*MockStorager)(nil).PurgeSessions), ctx, before)
+}
+
+// QueueDeletion mocks base method.
+func (m *MockStorager) QueueDeletion(ctx context.Context, item DeleteItem) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "QueueDeletion", ctx, item)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// QueueDeletion indicates an expected call of QueueDeletion.
+func (mr *MockStoragerMockRecorder) QueueDeletion(ctx, item interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueueDeletion", reflect.TypeOf((*MockStorager)(nil).QueueDeletion), ctx, item)
+}
+
+// RestoreRecords mocks base method.
+func (m *MockStorager) RestoreRecords(ctx context.Context, restoreItems []DeleteItem) ([]DeleteItem, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreRecords", ctx, restoreItems)
+	ret0, _ := ret[0].([]DeleteItem)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RestoreRecords indicates an expected call of RestoreRecords.
+func (mr *MockStoragerMockRecorder) RestoreRecords(ctx, restoreItems interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreRecords", reflect.TypeOf((*MockStorager)(nil).RestoreRecords), ctx, restoreItems)
+}
+
+// RevokeAPIKey mocks base method.
+func (m *MockStorager) RevokeAPIKey(ctx context.Context, userID go_uuid.UUID, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeAPIKey", ctx, userID, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeAPIKey indicates an expected call of RevokeAPIKey.
+func (mr *MockStoragerMockRecorder) RevokeAPIKey(ctx, userID, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeAPIKey", reflect.TypeOf((*MockStorager)(nil).RevokeAPIKey), ctx, userID, id)
+}
+
+// RevokeSession mocks base method.
+func (m *MockStorager) RevokeSession(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeSession", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeSession indicates an expected call of RevokeSession.
+func (mr *MockStoragerMockRecorder) RevokeSession(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeSession", reflect.TypeOf((*MockStorager)(nil).RevokeSession), ctx, id)
+}
+
+// RotateSession mocks base method.
+func (m *MockStorager) RotateSession(ctx context.Context, id, oldHash, newHash string, expiresAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RotateSession", ctx, id, oldHash, newHash, expiresAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RotateSession indicates an expected call of RotateSession.
+func (mr *MockStoragerMockRecorder) RotateSession(ctx, id, oldHash, newHash, expiresAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RotateSession", reflect.TypeOf((*MockStorager)(nil).RotateSession), ctx, id, oldHash, newHash, expiresAt)
+}
+
+// SaveClicks mocks base method.
+func (m *MockStorager) SaveClicks(ctx context.Context, clicks []Click) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveClicks", ctx, clicks)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveClicks indicates an expected call of SaveClicks.
+func (mr *MockStoragerMockRecorder) SaveClicks(ctx, clicks interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveClicks", reflect.TypeOf((*MockStorager)(nil).SaveClicks), ctx, clicks)
+}
+
 // Select mocks base method.
-func (m *MockStorager) Select(ctx context.Context, key string) (string, error) {
+func (m *MockStorager) Select(ctx context.Context, key string) (Redirect, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Select", ctx, key)
-	ret0, _ := ret[0].(string)
+	ret0, _ := ret[0].(Redirect)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
@@ -118,6 +887,142 @@ func (mr *MockStoragerMockRecorder) Select(ctx, key interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Select", reflect.TypeOf((*MockStorager)(nil).Select), ctx, key)
 }
 
+// SelectAPIKey mocks base method.
+func (m *MockStorager) SelectAPIKey(ctx context.Context, hash string) (authenticator.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectAPIKey", ctx, hash)
+	ret0, _ := ret[0].(authenticator.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectAPIKey indicates an expected call of SelectAPIKey.
+func (mr *MockStoragerMockRecorder) SelectAPIKey(ctx, hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectAPIKey", reflect.TypeOf((*MockStorager)(nil).SelectAPIKey), ctx, hash)
+}
+
+// SelectAccount mocks base method.
+func (m *MockStorager) SelectAccount(ctx context.Context, username string) (authenticator.Account, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectAccount", ctx, username)
+	ret0, _ := ret[0].(authenticator.Account)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// SelectAccount indicates an expected call of SelectAccount.
+func (mr *MockStoragerMockRecorder) SelectAccount(ctx, username interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectAccount", reflect.TypeOf((*MockStorager)(nil).SelectAccount), ctx, username)
+}
+
+// SelectHistory mocks base method.
+func (m *MockStorager) SelectHistory(ctx context.Context, userID go_uuid.UUID, key string) ([]URLEdit, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectHistory", ctx, userID, key)
+	ret0, _ := ret[0].([]URLEdit)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectHistory indicates an expected call of SelectHistory.
+func (mr *MockStoragerMockRecorder) SelectHistory(ctx, userID, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectHistory", reflect.TypeOf((*MockStorager)(nil).SelectHistory), ctx, userID, key)
+}
+
+// SelectQueuedDeletions mocks base method.
+func (m *MockStorager) SelectQueuedDeletions(ctx context.Context) ([]DeleteItem, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectQueuedDeletions", ctx)
+	ret0, _ := ret[0].([]DeleteItem)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectQueuedDeletions indicates an expected call of SelectQueuedDeletions.
+func (mr *MockStoragerMockRecorder) SelectQueuedDeletions(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectQueuedDeletions", reflect.TypeOf((*MockStorager)(nil).SelectQueuedDeletions), ctx)
+}
+
+// SelectRevokedSessions mocks base method.
+func (m *MockStorager) SelectRevokedSessions(ctx context.Context, since time.Time) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectRevokedSessions", ctx, since)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectRevokedSessions indicates an expected call of SelectRevokedSessions.
+func (mr *MockStoragerMockRecorder) SelectRevokedSessions(ctx, since interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectRevokedSessions", reflect.TypeOf((*MockStorager)(nil).SelectRevokedSessions), ctx, since)
+}
+
+// SelectSession mocks base method.
+func (m *MockStorager) SelectSession(ctx context.Context, hash string) (authenticator.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectSession", ctx, hash)
+	ret0, _ := ret[0].(authenticator.Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectSession indicates an expected call of SelectSession.
+func (mr *MockStoragerMockRecorder) SelectSession(ctx, hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectSession", reflect.TypeOf((*MockStorager)(nil).SelectSession), ctx, hash)
+}
+
+// SelectStats mocks base method.
+func (m *MockStorager) SelectStats(ctx context.Context, userID go_uuid.UUID, key string) (ClickStats, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectStats", ctx, userID, key)
+	ret0, _ := ret[0].(ClickStats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectStats indicates an expected call of SelectStats.
+func (mr *MockStoragerMockRecorder) SelectStats(ctx, userID, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectStats", reflect.TypeOf((*MockStorager)(nil).SelectStats), ctx, userID, key)
+}
+
+// SelectUserAPIKeys mocks base method.
+func (m *MockStorager) SelectUserAPIKeys(ctx context.Context, userID go_uuid.UUID) ([]authenticator.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectUserAPIKeys", ctx, userID)
+	ret0, _ := ret[0].([]authenticator.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectUserAPIKeys indicates an expected call of SelectUserAPIKeys.
+func (mr *MockStoragerMockRecorder) SelectUserAPIKeys(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectUserAPIKeys", reflect.TypeOf((*MockStorager)(nil).SelectUserAPIKeys), ctx, userID)
+}
+
+// SelectUserAccount mocks base method.
+func (m *MockStorager) SelectUserAccount(ctx context.Context, userID go_uuid.UUID) (authenticator.Account, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectUserAccount", ctx, userID)
+	ret0, _ := ret[0].(authenticator.Account)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectUserAccount indicates an expected call of SelectUserAccount.
+func (mr *MockStoragerMockRecorder) SelectUserAccount(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectUserAccount", reflect.TypeOf((*MockStorager)(nil).SelectUserAccount), ctx, userID)
+}
+
 // SelectUserAll mocks base method.
 func (m *MockStorager) SelectUserAll(ctx context.Context, userID go_uuid.UUID) ([]BatchElement, error) {
 	m.ctrl.T.Helper()
@@ -132,3 +1037,33 @@ func (mr *MockStoragerMockRecorder) SelectUserAll(ctx, userID interface{}) *gomo
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectUserAll", reflect.TypeOf((*MockStorager)(nil).SelectUserAll), ctx, userID)
 }
+
+// SelectUserPage mocks base method.
+func (m *MockStorager) SelectUserPage(ctx context.Context, userID go_uuid.UUID, query ListQuery) ([]BatchElement, *ListCursor, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectUserPage", ctx, userID, query)
+	ret0, _ := ret[0].([]BatchElement)
+	ret1, _ := ret[1].(*ListCursor)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// SelectUserPage indicates an expected call of SelectUserPage.
+func (mr *MockStoragerMockRecorder) SelectUserPage(ctx, userID, query interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectUserPage", reflect.TypeOf((*MockStorager)(nil).SelectUserPage), ctx, userID, query)
+}
+
+// UpdateOriginalURL mocks base method.
+func (m *MockStorager) UpdateOriginalURL(ctx context.Context, userID go_uuid.UUID, key, originalURL string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateOriginalURL", ctx, userID, key, originalURL)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateOriginalURL indicates an expected call of UpdateOriginalURL.
+func (mr *MockStoragerMockRecorder) UpdateOriginalURL(ctx, userID, key, originalURL interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOriginalURL", reflect.TypeOf((*MockStorager)(nil).UpdateOriginalURL), ctx, userID, key, originalURL)
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/Alena-Kurushkina/shortener/internal/sherr"
+)
+
+// CheckRedirectCode returns ErrInvalidRedirect if code is not HTTP status of redirect
+// which can be used by shortening.
+func CheckRedirectCode(code int) error {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return nil
+	}
+	return fmt.Errorf("%w: %d, use 301, 302, 307 or 308", sherr.ErrInvalidRedirect, code)
+}
+
+// checkLinkRedirectCode checks redirect code of shortening.
+// Zero code is valid, it means status defined by config.
+func checkLinkRedirectCode(code int) error {
+	if code == 0 {
+		return nil
+	}
+	return CheckRedirectCode(code)
+}
+
+// redirectCode returns HTTP status of redirect by shortening.
+func (sh *Shortener) redirectCode(redirect Redirect) int {
+	if redirect.RedirectCode != 0 {
+		return redirect.RedirectCode
+	}
+	return sh.config.RedirectCode
+}
+
+// redirectURL returns location of redirect by shortening.
+// If shortening passes query through, parameters of request are added to original URL,
+// parameters which original URL already has are kept as they are.
+func redirectURL(redirect Redirect, query url.Values) string {
+	if !redirect.Passthrough || len(query) == 0 {
+		return redirect.OriginalURL
+	}
+
+	target, err := url.Parse(redirect.OriginalURL)
+	if err != nil {
+		return redirect.OriginalURL
+	}
+	merged := target.Query()
+	for key, values := range query {
+		if _, ok := merged[key]; !ok {
+			merged[key] = values
+		}
+	}
+	target.RawQuery = merged.Encode()
+
+	return target.String()
+}
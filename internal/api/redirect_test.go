@@ -0,0 +1,125 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Alena-Kurushkina/shortener/internal/config"
+)
+
+func TestRedirectURL(t *testing.T) {
+	query := url.Values{"utm_source": {"mail"}, "id": {"2"}}
+
+	tests := []struct {
+		name     string
+		redirect Redirect
+		want     string
+	}{
+		{
+			name:     "query is dropped without passthrough",
+			redirect: Redirect{OriginalURL: "http://site.ru/page?id=1"},
+			want:     "http://site.ru/page?id=1",
+		},
+		{
+			name:     "query is merged",
+			redirect: Redirect{OriginalURL: "http://site.ru/page?id=1", Passthrough: true},
+			want:     "http://site.ru/page?id=1&utm_source=mail",
+		},
+		{
+			name:     "original URL without query",
+			redirect: Redirect{OriginalURL: "http://site.ru/page", Passthrough: true},
+			want:     "http://site.ru/page?id=2&utm_source=mail",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, redirectURL(tt.redirect, query))
+		})
+	}
+}
+
+func TestGetFullStringRedirect(t *testing.T) {
+	cfg = config.InitConfig()
+
+	tests := []struct {
+		name         string
+		redirect     Redirect
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			name:         "default code",
+			redirect:     Redirect{OriginalURL: "http://site.ru"},
+			wantCode:     http.StatusTemporaryRedirect,
+			wantLocation: "http://site.ru",
+		},
+		{
+			name:         "code of shortening",
+			redirect:     Redirect{OriginalURL: "http://site.ru", RedirectCode: http.StatusMovedPermanently},
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "http://site.ru",
+		},
+		{
+			name:         "query passthrough",
+			redirect:     Redirect{OriginalURL: "http://site.ru", RedirectCode: http.StatusPermanentRedirect, Passthrough: true},
+			wantCode:     http.StatusPermanentRedirect,
+			wantLocation: "http://site.ru?utm_source=mail",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMockStorager(gomock.NewController(t))
+			m.EXPECT().Select(gomock.Any(), "short").Return(tt.redirect, nil)
+
+			sh := newShortenerObject(m, sequence("short"), cfg)
+
+			req := httptest.NewRequest(http.MethodGet, "/short?utm_source=mail", nil)
+			rec := httptest.NewRecorder()
+			sh.GetFullString(rec, withURLParam(req, "id", "short"))
+
+			assert.Equal(t, tt.wantCode, rec.Code)
+			assert.Equal(t, tt.wantLocation, rec.Header().Get("Location"))
+		})
+	}
+}
+
+func TestCreateShorteningRedirect(t *testing.T) {
+	cfg = config.InitConfig()
+	userID := uuid.NewV4()
+
+	t.Run("options are saved", func(t *testing.T) {
+		m := NewMockStorager(gomock.NewController(t))
+		m.EXPECT().Insert(gomock.Any(), userID, "short", "http://site.ru", LinkOptions{RedirectCode: http.StatusFound, Passthrough: true}).Return(nil)
+
+		sh := newShortenerObject(m, sequence("short"), cfg)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten",
+			strings.NewReader(`{"url":"http://site.ru","redirect_code":302,"query_passthrough":true}`))
+		req = withUser(req, userID)
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		sh.CreateShorteningJSON(rec, req)
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+	})
+
+	t.Run("invalid code", func(t *testing.T) {
+		sh := newShortenerObject(NewMockStorager(gomock.NewController(t)), sequence("short"), cfg)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten",
+			strings.NewReader(`{"url":"http://site.ru","redirect_code":200}`))
+		req = withUser(req, userID)
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		sh.CreateShorteningJSON(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Alena-Kurushkina/shortener/internal/config"
+)
+
+func TestRestoreRecordJSON(t *testing.T) {
+	cfg = config.InitConfig()
+	userID := uuid.NewV4()
+
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+	}{
+		{name: "codes are queued", body: `["short1","short2"]`, wantCode: http.StatusAccepted},
+		{name: "empty list", body: `[]`, wantCode: http.StatusBadRequest},
+		{name: "invalid body", body: `short1`, wantCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sh := newShortenerObject(NewMockStorager(gomock.NewController(t)), sequence("short"), cfg)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/user/urls/restore", strings.NewReader(tt.body))
+			req = withUser(req, userID)
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			sh.RestoreRecordJSON(rec, req)
+
+			assert.Equal(t, tt.wantCode, rec.Code)
+			if tt.wantCode != http.StatusAccepted {
+				assert.Empty(t, sh.restoreChan)
+				return
+			}
+			require.Len(t, sh.restoreChan, 1)
+			assert.Equal(t, DeleteItem{UserID: userID, IDs: []string{"short1", "short2"}}, <-sh.restoreChan)
+		})
+	}
+
+	t.Run("full queue rejects request", func(t *testing.T) {
+		sh := newShortenerObject(NewMockStorager(gomock.NewController(t)), sequence("short"), cfg)
+		sh.restoreChan = make(chan DeleteItem)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/user/urls/restore", strings.NewReader(`["short1"]`))
+		req = withUser(req, userID)
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		sh.RestoreRecordJSON(rec, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.Equal(t, "5", rec.Header().Get("Retry-After"))
+	})
+}
+
+func TestPurgeDeleted(t *testing.T) {
+	now := time.Now()
+
+	t.Run("records deleted before retention are purged", func(t *testing.T) {
+		m := NewMockStorager(gomock.NewController(t))
+		m.EXPECT().PurgeDeleted(gomock.Any(), now.Add(-time.Hour)).Return([]string{"short"}, nil)
+
+		sh := newShortenerObject(m, sequence("short"), &config.Config{Settings: config.Settings{DeletedRetention: config.Duration{Duration: time.Hour}}})
+		sh.purgeDeleted(now)
+	})
+
+	t.Run("zero retention keeps deleted records", func(t *testing.T) {
+		sh := newShortenerObject(NewMockStorager(gomock.NewController(t)), sequence("short"), &config.Config{})
+		sh.purgeDeleted(now)
+	})
+}
@@ -0,0 +1,226 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/Alena-Kurushkina/shortener/internal/authenticator"
+	"github.com/Alena-Kurushkina/shortener/internal/logger"
+	"github.com/Alena-Kurushkina/shortener/internal/sherr"
+)
+
+// A Click represents one redirect by shortening.
+// Client address is kept only as salted hash, see Shortener.hashIP.
+type Click struct {
+	ShortURL  string
+	Time      time.Time
+	Referrer  string
+	UserAgent string
+	IPHash    string
+}
+
+// A DayClicks keeps number of redirects by shortening during one day
+// and number of unique visitors by hashes of their addresses.
+type DayClicks struct {
+	Day      time.Time
+	Clicks   int64
+	Visitors int64
+}
+
+// A SourceClicks keeps number of redirects by shortening from one referrer host or user agent.
+type SourceClicks struct {
+	Value  string
+	Clicks int64
+}
+
+// ClickStats keeps aggregated redirects by shortening: daily counters ordered by day
+// and the most frequent referrer hosts and user agents ordered by number of redirects.
+type ClickStats struct {
+	Days       []DayClicks
+	Referrers  []SourceClicks
+	UserAgents []SourceClicks
+}
+
+// TopSources is number of the most frequent referrers and user agents returned in ClickStats.
+const TopSources = 10
+
+// maxUserAgentLength limits length of user agent of click, so that clients can't bloat statistics.
+const maxUserAgentLength = 256
+
+// newIPSalt returns random salt of IP hashes, so that client addresses can't be restored from hashes.
+func newIPSalt() []byte {
+	salt := make([]byte, 16)
+	rand.Read(salt)
+	return salt
+}
+
+// hashIP returns salted hash of client address of request at day of click time.
+// Day is a part of hash, so that visits of the same client on different days can't be linked.
+func (sh *Shortener) hashIP(req *http.Request, t time.Time) string {
+	ip, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		ip = req.RemoteAddr
+	}
+	h := sha256.New()
+	h.Write(sh.ipSalt)
+	h.Write([]byte(t.UTC().Format(time.DateOnly)))
+	h.Write([]byte(ip))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// referrerHost returns host of referrer URL of request or empty string for direct redirect.
+// Path and query of referrer are dropped, they may contain data of client.
+func referrerHost(req *http.Request) string {
+	u, err := url.Parse(req.Referer())
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// recordClick sends redirect by shortening to chan for saving.
+// Click is dropped if chan is full, so that redirects are never slowed down by statistics.
+func (sh *Shortener) recordClick(req *http.Request, key string) {
+	now := time.Now()
+	userAgent := req.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	click := Click{
+		ShortURL:  key,
+		Time:      now,
+		Referrer:  referrerHost(req),
+		UserAgent: userAgent,
+		IPHash:    sh.hashIP(req, now),
+	}
+	select {
+	case sh.clickChan <- click:
+	default:
+		logger.Log.Infof("Click by %s is dropped, chan is full", key)
+	}
+}
+
+func (sh *Shortener) flushClicks() {
+	defer sh.wg.Done()
+
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	clicks := make([]Click, 0, 1024)
+
+	for {
+		select {
+		case click := <-sh.clickChan:
+			clicks = append(clicks, click)
+		case <-ticker.C:
+			sh.saveClicks(clicks)
+
+			clicks = make([]Click, 0, 1024)
+		case <-sh.done:
+			sh.saveClicks(clicks)
+			return
+		}
+	}
+}
+
+func (sh *Shortener) saveClicks(clicks []Click) {
+	if len(clicks) == 0 {
+		return
+	}
+	if err := sh.stats.SaveClicks(context.TODO(), clicks); err != nil {
+		logger.Log.Infof("Can't save clicks: %s", err.Error())
+		return
+	}
+	logger.Log.Debugf("Clicks were saved: %d", len(clicks))
+}
+
+// A DayStatsResponse is for encoding number of redirects and unique visitors during one day in json.
+type DayStatsResponse struct {
+	Date     string `json:"date"`
+	Clicks   int64  `json:"clicks"`
+	Visitors int64  `json:"visitors"`
+}
+
+// A SourceStatsResponse is for encoding number of redirects from referrer host or user agent in json.
+type SourceStatsResponse struct {
+	Value  string `json:"value"`
+	Clicks int64  `json:"clicks"`
+}
+
+// A StatsResponse is for encoding redirect statistics of shortening in json.
+type StatsResponse struct {
+	ShortURL   string                `json:"short_url"`
+	Total      int64                 `json:"total"`
+	Days       []DayStatsResponse    `json:"days"`
+	Referrers  []SourceStatsResponse `json:"referrers"`
+	UserAgents []SourceStatsResponse `json:"user_agents"`
+}
+
+// sourceStats converts counters of referrers or user agents to response.
+func sourceStats(sources []SourceClicks) []SourceStatsResponse {
+	result := make([]SourceStatsResponse, 0, len(sources))
+	for _, v := range sources {
+		result = append(result, SourceStatsResponse{Value: v.Value, Clicks: v.Clicks})
+	}
+	return result
+}
+
+// GetShorteningStats handle GET request with shortening in URL parameter named id
+// and makes response with total and daily numbers of redirects and unique visitors by it
+// and with the most frequent referrer hosts and user agents in json format.
+// Empty referrer stands for direct redirects.
+// Only owner of shortening gets statistics.
+// get /api/user/urls/{id}/stats
+func (sh *Shortener) GetShorteningStats(res http.ResponseWriter, req *http.Request) {
+	res.Header().Set("Content-Type", "application/json")
+
+	key := chi.URLParam(req, "id")
+	if key == "" {
+		http.Error(res, "Bad parameters", http.StatusBadRequest)
+		return
+	}
+
+	id, ok := authenticator.UserFromContext(req.Context())
+	if !ok {
+		http.Error(res, "User is not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	clickStats, err := sh.stats.SelectStats(req.Context(), id, key)
+	if errors.Is(err, sherr.ErrNotFound) {
+		http.Error(res, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	stats := StatsResponse{
+		ShortURL:   sh.config.BaseURL + key,
+		Days:       make([]DayStatsResponse, 0, len(clickStats.Days)),
+		Referrers:  sourceStats(clickStats.Referrers),
+		UserAgents: sourceStats(clickStats.UserAgents),
+	}
+	for _, v := range clickStats.Days {
+		stats.Total += v.Clicks
+		stats.Days = append(stats.Days, DayStatsResponse{Date: v.Day.Format(time.DateOnly), Clicks: v.Clicks, Visitors: v.Visitors})
+	}
+
+	responseData, err := json.Marshal(stats)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	res.WriteHeader(http.StatusOK)
+	res.Write(responseData)
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Alena-Kurushkina/shortener/internal/authenticator"
+	"github.com/Alena-Kurushkina/shortener/internal/config"
+	"github.com/Alena-Kurushkina/shortener/internal/sherr"
+)
+
+// withURLParam adds chi URL parameter to request.
+func withURLParam(req *http.Request, key, value string) *http.Request {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add(key, value)
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+}
+
+// withUser returns request authenticated as user with userID.
+func withUser(req *http.Request, userID uuid.UUID) *http.Request {
+	return req.WithContext(authenticator.WithUser(req.Context(), userID))
+}
+
+func TestRecordClick(t *testing.T) {
+	cfg = config.InitConfig()
+
+	m := NewMockStorager(gomock.NewController(t))
+	m.EXPECT().Select(gomock.Any(), "short").Return(Redirect{OriginalURL: "http://site.ru"}, nil)
+
+	sh := newShortenerObject(m, sequence("short"), cfg)
+
+	req := httptest.NewRequest(http.MethodGet, "/short", nil)
+	req.Header.Set("Referer", "http://blog.ru/post?user=alice")
+	req.Header.Set("User-Agent", "test-agent")
+	req.RemoteAddr = "10.0.0.1:5000"
+	rec := httptest.NewRecorder()
+	sh.GetFullString(rec, withURLParam(req, "id", "short"))
+
+	require.Equal(t, http.StatusTemporaryRedirect, rec.Code)
+	require.Len(t, sh.clickChan, 1)
+
+	click := <-sh.clickChan
+	assert.Equal(t, "short", click.ShortURL)
+	assert.Equal(t, "blog.ru", click.Referrer)
+	assert.Equal(t, "test-agent", click.UserAgent)
+	assert.NotEmpty(t, click.IPHash)
+	assert.NotContains(t, click.IPHash, "10.0.0.1")
+	assert.WithinDuration(t, time.Now(), click.Time, time.Minute)
+
+	// hash of the same address differs by day and by salt
+	now := time.Now()
+	assert.Equal(t, sh.hashIP(req, now), sh.hashIP(req, now))
+	assert.NotEqual(t, sh.hashIP(req, now), sh.hashIP(req, now.Add(24*time.Hour)))
+	other := newShortenerObject(m, sequence("short"), cfg)
+	assert.NotEqual(t, sh.hashIP(req, now), other.hashIP(req, now))
+}
+
+func TestGetShorteningStats(t *testing.T) {
+	cfg = config.InitConfig()
+	userID := uuid.NewV4()
+
+	t.Run("owner gets statistics", func(t *testing.T) {
+		m := NewMockStorager(gomock.NewController(t))
+		m.EXPECT().SelectStats(gomock.Any(), userID, "short").Return(ClickStats{
+			Days: []DayClicks{
+				{Day: time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC), Clicks: 2, Visitors: 1},
+				{Day: time.Date(2024, time.March, 3, 0, 0, 0, 0, time.UTC), Clicks: 5, Visitors: 3},
+			},
+			Referrers:  []SourceClicks{{Value: "blog.ru", Clicks: 4}, {Value: "", Clicks: 3}},
+			UserAgents: []SourceClicks{{Value: "test-agent", Clicks: 7}},
+		}, nil)
+
+		sh := newShortenerObject(m, sequence("short"), cfg)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/user/urls/short/stats", nil)
+		req = withUser(req, userID)
+		rec := httptest.NewRecorder()
+		sh.GetShorteningStats(rec, withURLParam(req, "id", "short"))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{
+			"short_url": "`+cfg.BaseURL+`short",
+			"total": 7,
+			"days": [{"date": "2024-03-01", "clicks": 2, "visitors": 1}, {"date": "2024-03-03", "clicks": 5, "visitors": 3}],
+			"referrers": [{"value": "blog.ru", "clicks": 4}, {"value": "", "clicks": 3}],
+			"user_agents": [{"value": "test-agent", "clicks": 7}]
+		}`, rec.Body.String())
+	})
+
+	t.Run("shortening of another user", func(t *testing.T) {
+		m := NewMockStorager(gomock.NewController(t))
+		m.EXPECT().SelectStats(gomock.Any(), userID, "short").Return(ClickStats{}, sherr.ErrNotFound)
+
+		sh := newShortenerObject(m, sequence("short"), cfg)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/user/urls/short/stats", nil)
+		req = withUser(req, userID)
+		rec := httptest.NewRecorder()
+		sh.GetShorteningStats(rec, withURLParam(req, "id", "short"))
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
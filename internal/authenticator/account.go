@@ -0,0 +1,270 @@
+package authenticator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/Alena-Kurushkina/shortener/internal/logger"
+	"github.com/Alena-Kurushkina/shortener/internal/sherr"
+)
+
+// Length limits of password, bcrypt ignores bytes after 72th.
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72
+)
+
+// usernamePattern defines allowed usernames, usernames are compared in lower case.
+var usernamePattern = regexp.MustCompile(`^[a-z0-9_.-]{3,64}$`)
+
+// An Account binds username and password to user id,
+// so that user keeps shortenings after cookies are cleared and can log in from another browser.
+type Account struct {
+	UserID    uuid.UUID `json:"user_id"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// An AccountStore keeps accounts with hashes of their passwords.
+type AccountStore interface {
+	// InsertAccount saves account. It returns ErrUsernameTaken if username or user id has account already.
+	InsertAccount(ctx context.Context, account Account, passwordHash string) error
+	// SelectAccount returns account with hash of its password by username or ErrNotFound.
+	SelectAccount(ctx context.Context, username string) (Account, string, error)
+	// SelectUserAccount returns account of user or ErrNotFound if user is anonymous.
+	SelectUserAccount(ctx context.Context, userID uuid.UUID) (Account, error)
+	// MergeUsers reassigns shortenings and API keys of user from to user to
+	// and revokes all sessions of user from. It returns number of reassigned shortenings.
+	MergeUsers(ctx context.Context, from, to uuid.UUID) (int, error)
+}
+
+// A credentials is body of Register and Login requests.
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// A LoginResponse is response of Login.
+type LoginResponse struct {
+	Account
+	// Merged is number of shortenings of anonymous user which were reassigned to account
+	Merged int `json:"merged"`
+}
+
+// accounts keeps accounts of Register and Login, they respond 501 until UseAccounts is called.
+var accounts AccountStore
+
+// UseAccounts makes Register and Login keep accounts in store.
+func UseAccounts(store AccountStore) {
+	accounts = store
+}
+
+// dummyHash is compared with password of unknown username,
+// so that response time doesn't tell whether username is registered.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, err := bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
+
+// decodeCredentials reads credentials from request body and checks that they meet requirements.
+// Username is returned in lower case.
+func decodeCredentials(r *http.Request) (credentials, error) {
+	var c credentials
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		return credentials{}, err
+	}
+
+	c.Username = strings.ToLower(strings.TrimSpace(c.Username))
+	if !usernamePattern.MatchString(c.Username) {
+		return credentials{}, sherr.ErrInvalidUsername
+	}
+	if len(c.Password) < minPasswordLength || len(c.Password) > maxPasswordLength {
+		return credentials{}, sherr.ErrInvalidPassword
+	}
+	return c, nil
+}
+
+// writeJSON writes v as JSON response with status code.
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Log.Errorf("Encode response: %v", err)
+	}
+}
+
+// Register binds username and password from body {"username": "...", "password": "..."}
+// to user of request, so shortenings which user has created anonymously stay with account.
+// It must be behind AuthMiddleware and RequireCookie.
+func Register(w http.ResponseWriter, r *http.Request) {
+	if accounts == nil {
+		http.Error(w, "Accounts are not supported by storage", http.StatusNotImplemented)
+		return
+	}
+	userID, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User is not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	c, err := decodeCredentials(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, err = accounts.SelectUserAccount(r.Context(), userID)
+	if err == nil {
+		http.Error(w, sherr.ErrAlreadyRegistered.Error(), http.StatusConflict)
+		return
+	}
+	if !errors.Is(err, sherr.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(c.Password), bcrypt.DefaultCost)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	account := Account{UserID: userID, Username: c.Username, CreatedAt: time.Now().UTC()}
+	err = accounts.InsertAccount(r.Context(), account, string(hash))
+	if errors.Is(err, sherr.ErrUsernameTaken) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Log.Infof("User %s was registered as %s", userID, c.Username)
+
+	writeJSON(w, http.StatusCreated, account)
+}
+
+// Login checks username and password from body {"username": "...", "password": "..."}
+// and starts new session of account. Shortenings and API keys of anonymous user of request
+// are reassigned to account and all sessions of anonymous user are revoked.
+// Registered user of request is not merged into another account.
+func Login(w http.ResponseWriter, r *http.Request) {
+	if accounts == nil {
+		http.Error(w, "Accounts are not supported by storage", http.StatusNotImplemented)
+		return
+	}
+
+	c, err := decodeCredentials(r)
+	if errors.Is(err, sherr.ErrInvalidUsername) || errors.Is(err, sherr.ErrInvalidPassword) {
+		http.Error(w, sherr.ErrInvalidCredentials.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	account, hash, err := accounts.SelectAccount(r.Context(), c.Username)
+	if errors.Is(err, sherr.ErrNotFound) {
+		_ = bcrypt.CompareHashAndPassword(dummyHash(), []byte(c.Password))
+		http.Error(w, sherr.ErrInvalidCredentials.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(c.Password)); err != nil {
+		http.Error(w, sherr.ErrInvalidCredentials.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	res := LoginResponse{Account: account}
+	anonymousID, sessionID := currentUser(r)
+	if anonymousID != uuid.Nil && !uuid.Equal(anonymousID, account.UserID) {
+		res.Merged, err = mergeAnonymous(r.Context(), anonymousID, account.UserID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if sessionID != "" && sessions != nil {
+			if err = sessions.RevokeSession(r.Context(), sessionID); err != nil && !errors.Is(err, sherr.ErrNotFound) {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			revoked.add(sessionID, time.Now())
+		}
+	}
+
+	if err = startSession(r.Context(), w, account.UserID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Log.Infof("User %s logged in as %s", account.UserID, account.Username)
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+// mergeAnonymous reassigns shortenings of user from to account of user to
+// and adds revoked sessions of user from to revocation list.
+// Shortenings of registered user stay with their own account.
+func mergeAnonymous(ctx context.Context, from, to uuid.UUID) (int, error) {
+	_, err := accounts.SelectUserAccount(ctx, from)
+	if err == nil {
+		return 0, nil
+	}
+	if !errors.Is(err, sherr.ErrNotFound) {
+		return 0, err
+	}
+
+	// time of revocation is stored with lower precision by some storages
+	mergedAt := time.Now().Add(-time.Second)
+	n, err := accounts.MergeUsers(ctx, from, to)
+	if err != nil {
+		return 0, err
+	}
+	if sessions != nil {
+		if err = loadRevoked(ctx, sessions, mergedAt); err != nil {
+			// sessions are revoked in storage, so they can't be refreshed anyway
+			logger.Log.Errorf("Failed to load sessions revoked by merge of user %s: %v", from, err)
+		}
+	}
+
+	logger.Log.Infof("Shortenings of user %s were merged into %s: %d", from, to, n)
+
+	return n, nil
+}
+
+// currentUser returns user of request and id of session by valid access token
+// or by refresh token of active session. It returns uuid.Nil if request has no valid tokens.
+// Tokens are not refreshed.
+func currentUser(r *http.Request) (uuid.UUID, string) {
+	if cookie, err := r.Cookie(accessCookie); err == nil {
+		if c, err := parseAccessToken(cookie.Value); err == nil {
+			return c.UserID, c.SessionID
+		}
+	}
+
+	cookie, err := r.Cookie(refreshCookie)
+	if err != nil || sessions == nil {
+		return uuid.Nil, ""
+	}
+	session, err := sessions.SelectSession(r.Context(), hashSecret(cookie.Value))
+	if err != nil || session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return uuid.Nil, ""
+	}
+	return session.UserID, session.ID
+}
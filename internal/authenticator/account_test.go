@@ -0,0 +1,210 @@
+package authenticator
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Alena-Kurushkina/shortener/internal/logger"
+	"github.com/Alena-Kurushkina/shortener/internal/sherr"
+)
+
+// An accountMap keeps accounts in map by usernames and remembers merged users.
+// Sessions of merged users are revoked in sessions if it is set.
+type accountMap struct {
+	mu       sync.Mutex
+	accounts map[string]Account
+	hashes   map[string]string
+	merged   map[uuid.UUID]uuid.UUID
+	sessions *sessionMap
+}
+
+func (m *accountMap) InsertAccount(_ context.Context, account Account, passwordHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, v := range m.accounts {
+		if v.Username == account.Username || uuid.Equal(v.UserID, account.UserID) {
+			return sherr.ErrUsernameTaken
+		}
+	}
+	m.accounts[account.Username] = account
+	m.hashes[account.Username] = passwordHash
+	return nil
+}
+
+func (m *accountMap) SelectAccount(_ context.Context, username string) (Account, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	account, ok := m.accounts[username]
+	if !ok {
+		return Account{}, "", sherr.ErrNotFound
+	}
+	return account, m.hashes[username], nil
+}
+
+func (m *accountMap) SelectUserAccount(_ context.Context, userID uuid.UUID) (Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, v := range m.accounts {
+		if uuid.Equal(v.UserID, userID) {
+			return v, nil
+		}
+	}
+	return Account{}, sherr.ErrNotFound
+}
+
+func (m *accountMap) MergeUsers(_ context.Context, from, to uuid.UUID) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.merged[from] = to
+	if m.sessions != nil {
+		m.sessions.revokeUser(from)
+	}
+	return 1, nil
+}
+
+// useAccountMap makes Register and Login keep accounts in new accountMap until test ends.
+func useAccountMap(t *testing.T) *accountMap {
+	t.Helper()
+
+	store := &accountMap{
+		accounts: make(map[string]Account),
+		hashes:   make(map[string]string),
+		merged:   make(map[uuid.UUID]uuid.UUID),
+	}
+	prev := accounts
+	t.Cleanup(func() { accounts = prev })
+	UseAccounts(store)
+	return store
+}
+
+// register registers user with username and password and returns response status.
+func register(t *testing.T, userID uuid.UUID, body string) int {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/register", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	Register(rec, req.WithContext(WithUser(req.Context(), userID)))
+	return rec.Code
+}
+
+func TestRegister(t *testing.T) {
+	require.NoError(t, logger.Initialize())
+	store := useAccountMap(t)
+	userID := uuid.NewV4()
+
+	require.Equal(t, http.StatusCreated, register(t, userID, `{"username":"Alice","password":"password1"}`))
+	account, err := store.SelectUserAccount(context.Background(), userID)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", account.Username)
+	assert.NotEqual(t, "password1", store.hashes["alice"])
+
+	tests := []struct {
+		name     string
+		userID   uuid.UUID
+		body     string
+		wantCode int
+	}{
+		{name: "user is registered", userID: userID, body: `{"username":"bob","password":"password1"}`, wantCode: http.StatusConflict},
+		{name: "username is taken", userID: uuid.NewV4(), body: `{"username":"alice","password":"password1"}`, wantCode: http.StatusConflict},
+		{name: "invalid username", userID: uuid.NewV4(), body: `{"username":"a b","password":"password1"}`, wantCode: http.StatusBadRequest},
+		{name: "short password", userID: uuid.NewV4(), body: `{"username":"bob","password":"short"}`, wantCode: http.StatusBadRequest},
+		{name: "invalid body", userID: uuid.NewV4(), body: `{`, wantCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantCode, register(t, tt.userID, tt.body))
+		})
+	}
+}
+
+func TestLogin(t *testing.T) {
+	require.NoError(t, logger.Initialize())
+	store := useAccountMap(t)
+	store.sessions = useSessionMap(t)
+
+	accountID := uuid.NewV4()
+	require.Equal(t, http.StatusCreated, register(t, accountID, `{"username":"alice","password":"password1"}`))
+
+	login := func(body string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(body))
+		for _, v := range cookies {
+			req.AddCookie(v)
+		}
+		rec := httptest.NewRecorder()
+		Login(rec, req)
+		return rec
+	}
+
+	t.Run("anonymous user is merged", func(t *testing.T) {
+		anonymousID := uuid.NewV4()
+		rec := httptest.NewRecorder()
+		require.NoError(t, startSession(context.Background(), rec, anonymousID))
+		access := cookie(rec, accessCookie)
+		// session of anonymous user in another browser
+		rec = httptest.NewRecorder()
+		require.NoError(t, startSession(context.Background(), rec, anonymousID))
+		otherAccess := cookie(rec, accessCookie)
+
+		rec = login(`{"username":"alice","password":"password1"}`, &http.Cookie{Name: accessCookie, Value: access})
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var res LoginResponse
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+		assert.Equal(t, accountID, res.UserID)
+		assert.Equal(t, 1, res.Merged)
+		assert.Equal(t, accountID, store.merged[anonymousID])
+
+		id, err := getUserID(cookie(rec, accessCookie))
+		require.NoError(t, err)
+		assert.Equal(t, accountID, id)
+		assert.NotEmpty(t, cookie(rec, refreshCookie))
+
+		// all sessions of anonymous user are revoked
+		_, err = getUserID(access)
+		assert.ErrorIs(t, err, sherr.ErrTokenInvalid)
+		_, err = getUserID(otherAccess)
+		assert.ErrorIs(t, err, sherr.ErrTokenInvalid)
+	})
+
+	t.Run("registered user is not merged", func(t *testing.T) {
+		otherID := uuid.NewV4()
+		require.Equal(t, http.StatusCreated, register(t, otherID, `{"username":"bob","password":"password2"}`))
+		access, err := buildJWTString(otherID)
+		require.NoError(t, err)
+
+		rec := login(`{"username":"alice","password":"password1"}`, &http.Cookie{Name: accessCookie, Value: access})
+		require.Equal(t, http.StatusOK, rec.Code)
+		_, ok := store.merged[otherID]
+		assert.False(t, ok)
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, login(`{"username":"alice","password":"password2"}`).Code)
+	})
+
+	t.Run("unknown username", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, login(`{"username":"carol","password":"password1"}`).Code)
+	})
+
+	t.Run("expired session is not merged", func(t *testing.T) {
+		anonymousID := uuid.NewV4()
+		rec := login(`{"username":"alice","password":"password1"}`,
+			&http.Cookie{Name: accessCookie, Value: expiredToken(t, anonymousID, "")})
+		require.Equal(t, http.StatusOK, rec.Code)
+		_, ok := store.merged[anonymousID]
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,153 @@
+package authenticator
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/Alena-Kurushkina/shortener/internal/sherr"
+)
+
+// Scopes of API keys.
+const (
+	ScopeCreate = "create"
+	ScopeRead   = "read"
+	ScopeDelete = "delete"
+)
+
+// apiKeyPrefix marks secrets of API keys, so that they are easy to recognize in logs and configs.
+const apiKeyPrefix = "shk_"
+
+// An APIKey gives server-to-server client access to user's shortenings without cookie.
+// Only hash of key secret is stored, secret itself is shown once when key is issued.
+type APIKey struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uuid.UUID `json:"-"`
+}
+
+// HasScope reports whether key is granted scope.
+func (k APIKey) HasScope(scope string) bool {
+	for _, v := range k.Scopes {
+		if v == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// An APIKeyFinder finds API key by hash of its secret.
+// It returns ErrNotFound if key is unknown or revoked.
+type APIKeyFinder interface {
+	SelectAPIKey(ctx context.Context, hash string) (APIKey, error)
+}
+
+// apiKeys finds API keys of AuthMiddleware, requests with API key are rejected until UseAPIKeys is called.
+var apiKeys APIKeyFinder
+
+// UseAPIKeys makes AuthMiddleware authenticate requests by API keys which finder finds.
+func UseAPIKeys(finder APIKeyFinder) {
+	apiKeys = finder
+}
+
+// CheckScopes returns ErrInvalidScope if scopes are empty or contain unknown scope.
+func CheckScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("%w: no scopes", sherr.ErrInvalidScope)
+	}
+	for _, v := range scopes {
+		switch v {
+		case ScopeCreate, ScopeRead, ScopeDelete:
+		default:
+			return fmt.Errorf("%w: %q, use create, read or delete", sherr.ErrInvalidScope, v)
+		}
+	}
+	return nil
+}
+
+// GenerateAPIKey returns new random secret of API key.
+func GenerateAPIKey() (string, error) {
+	return randomSecret(apiKeyPrefix)
+}
+
+// HashAPIKey returns hash of API key secret which is kept in data storage.
+func HashAPIKey(secret string) string {
+	return hashSecret(secret)
+}
+
+// randomSecret returns random secret with prefix.
+func randomSecret(prefix string) (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return prefix + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// hashSecret returns hash of random secret which is kept in data storage instead of secret.
+// Secrets are random and long, so fast hash is enough.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiKeyFromHeader returns API key secret from Authorization header with Bearer scheme or from X-API-Key header.
+func apiKeyFromHeader(r *http.Request) (string, bool) {
+	if v := r.Header.Get("X-API-Key"); v != "" {
+		return v, true
+	}
+	scheme, secret, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") && secret != "" {
+		return secret, true
+	}
+	return "", false
+}
+
+// findAPIKey returns API key by its secret.
+// It returns ErrAPIKeyInvalid if key is unknown or revoked.
+func findAPIKey(ctx context.Context, secret string) (APIKey, error) {
+	if apiKeys == nil {
+		return APIKey{}, sherr.ErrAPIKeyInvalid
+	}
+	key, err := apiKeys.SelectAPIKey(ctx, HashAPIKey(secret))
+	if errors.Is(err, sherr.ErrNotFound) {
+		return APIKey{}, sherr.ErrAPIKeyInvalid
+	}
+	return key, err
+}
+
+// RequireScope returns middleware which rejects requests authenticated by API key without scope.
+// Requests authenticated by cookie have every scope.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if key, ok := APIKeyFromContext(r.Context()); ok && !key.HasScope(scope) {
+				http.Error(w, fmt.Sprintf("%s: %s", sherr.ErrScopeDenied, scope), http.StatusForbidden)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireCookie rejects requests authenticated by API key, so that API keys can't manage API keys.
+func RequireCookie(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := APIKeyFromContext(r.Context()); ok {
+			http.Error(w, "API key can't be used for this request", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
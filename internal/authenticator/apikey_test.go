@@ -0,0 +1,87 @@
+package authenticator
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Alena-Kurushkina/shortener/internal/logger"
+	"github.com/Alena-Kurushkina/shortener/internal/sherr"
+)
+
+// A keyFinder finds API keys in map by hash of their secrets.
+type keyFinder map[string]APIKey
+
+func (f keyFinder) SelectAPIKey(_ context.Context, hash string) (APIKey, error) {
+	key, ok := f[hash]
+	if !ok {
+		return APIKey{}, sherr.ErrNotFound
+	}
+	return key, nil
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	require.NoError(t, logger.Initialize())
+	defer UseAPIKeys(apiKeys)
+
+	secret, err := GenerateAPIKey()
+	require.NoError(t, err)
+	key := APIKey{ID: "key", Scopes: []string{ScopeRead}, UserID: uuid.NewV4()}
+	UseAPIKeys(keyFinder{HashAPIKey(secret): key})
+
+	var gotUser uuid.UUID
+	handler := AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser, _ = UserFromContext(r.Context())
+	}))
+	read := AuthMiddleware(RequireScope(ScopeRead)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	create := AuthMiddleware(RequireScope(ScopeCreate)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	cookieOnly := AuthMiddleware(RequireCookie(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	tests := []struct {
+		name     string
+		handler  http.Handler
+		header   string
+		value    string
+		wantCode int
+		wantUser uuid.UUID
+	}{
+		{name: "X-API-Key header", handler: handler, header: "X-API-Key", value: secret, wantCode: http.StatusOK, wantUser: key.UserID},
+		{name: "bearer token", handler: handler, header: "Authorization", value: "Bearer " + secret, wantCode: http.StatusOK, wantUser: key.UserID},
+		{name: "unknown key", handler: handler, header: "X-API-Key", value: "shk_unknown", wantCode: http.StatusUnauthorized},
+		{name: "granted scope", handler: read, header: "X-API-Key", value: secret, wantCode: http.StatusOK},
+		{name: "scope is not granted", handler: create, header: "X-API-Key", value: secret, wantCode: http.StatusForbidden},
+		{name: "key management", handler: cookieOnly, header: "X-API-Key", value: secret, wantCode: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotUser = uuid.Nil
+
+			// request with API key doesn't make new user
+			req := httptest.NewRequest(http.MethodPost, "/api/shorten", nil)
+			req.Header.Set(tt.header, tt.value)
+			rec := httptest.NewRecorder()
+			tt.handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantCode, rec.Code)
+			assert.Empty(t, rec.Result().Cookies())
+			assert.Equal(t, tt.wantUser, gotUser)
+		})
+	}
+
+	t.Run("cookie has every scope", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		create.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/shorten", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+}
+
+func TestCheckScopes(t *testing.T) {
+	assert.NoError(t, CheckScopes([]string{ScopeCreate, ScopeRead, ScopeDelete}))
+	assert.ErrorIs(t, CheckScopes(nil), sherr.ErrInvalidScope)
+	assert.ErrorIs(t, CheckScopes([]string{ScopeRead, "admin"}), sherr.ErrInvalidScope)
+}
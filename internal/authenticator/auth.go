@@ -3,7 +3,6 @@ package authenticator
 
 import (
 	"errors"
-	"fmt"
 	"net/http"
 	"time"
 
@@ -16,59 +15,65 @@ import (
 
 type claims struct {
 	jwt.RegisteredClaims
-	UserID uuid.UUID
+	UserID    uuid.UUID
+	SessionID string `json:"sid,omitempty"`
 }
 
-const tokenExp = time.Hour * 3
-
-const secretKey = "secretkey"
-
-// buildJWTString makes token and returns it as a string.
+// buildJWTString makes access token of user without session.
 func buildJWTString(id uuid.UUID) (string, error) {
-	// создаём новый токен с алгоритмом подписи HS256 и утверждениями — Claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims{
+	return buildAccessToken(id, "")
+}
+
+// buildAccessToken makes token of user session signed by active key and returns it as a string.
+func buildAccessToken(id uuid.UUID, sessionID string) (string, error) {
+	// создаём новый токен с утверждениями — Claims, алгоритм подписи определяется активным ключом
+	return keys.sign(claims{
 		RegisteredClaims: jwt.RegisteredClaims{
-			// когда создан токен
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(tokenExp)),
+			// когда истекает токен
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(accessTokenTTL)),
 		},
 		// собственное утверждение
-		UserID: id,
+		UserID:    id,
+		SessionID: sessionID,
 	})
+}
 
-	// создаём строку токена
-	tokenString, err := token.SignedString([]byte(secretKey))
+// getUserID verifies token by key which id is in token header and returns user id from token.
+func getUserID(tokenString string) (uuid.UUID, error) {
+	c, err := parseAccessToken(tokenString)
 	if err != nil {
-		return "", err
+		return uuid.Nil, err
 	}
-
-	// возвращаем строку токена
-	return tokenString, nil
+	return c.UserID, nil
 }
 
-func getUserID(tokenString string) (uuid.UUID, error) {
-	claims := &claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims,
-		func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-			}
-			return []byte(secretKey), nil
-		})
+// parseAccessToken verifies token by key which id is in token header and returns its claims.
+// It returns ErrTokenExpired with claims if token is valid but expired,
+// and ErrTokenInvalid if token is forged, malformed or its session is revoked.
+func parseAccessToken(tokenString string) (claims, error) {
+	c := claims{}
+	token, err := jwt.ParseWithClaims(tokenString, &c, keys.verifyKey)
 	if err != nil {
-		v, _ := err.(*jwt.ValidationError)
-		if v.Errors == jwt.ValidationErrorExpired || v.Errors == jwt.ValidationErrorSignatureInvalid {
-			return uuid.Nil, sherr.ErrTokenInvalid
+		var v *jwt.ValidationError
+		if errors.As(err, &v) && v.Errors == jwt.ValidationErrorExpired {
+			return c, sherr.ErrTokenExpired
 		}
-		return uuid.Nil, err
+		if errors.Is(err, sherr.ErrTokenInvalid) || errors.As(err, &v) {
+			return claims{}, sherr.ErrTokenInvalid
+		}
+		return claims{}, err
 	}
 	if !token.Valid {
-		return uuid.Nil, sherr.ErrTokenInvalid
+		return claims{}, sherr.ErrTokenInvalid
+	}
+	if c.SessionID != "" && revoked.has(c.SessionID) {
+		return claims{}, sherr.ErrTokenInvalid
 	}
-	if claims.UserID == uuid.Nil {
-		return uuid.Nil, sherr.ErrNoUserIDInToken
+	if c.UserID == uuid.Nil {
+		return claims{}, sherr.ErrNoUserIDInToken
 	}
 	logger.Log.Infof("User token is valid")
-	return claims.UserID, nil
+	return c, nil
 }
 
 func setNewTokenInCookie(w http.ResponseWriter, userID uuid.UUID) error {
@@ -76,76 +81,112 @@ func setNewTokenInCookie(w http.ResponseWriter, userID uuid.UUID) error {
 	if err != nil {
 		return err
 	}
-	http.SetCookie(w, &http.Cookie{Name: "token", Value: jwt, MaxAge: 0})
+	http.SetCookie(w, &http.Cookie{Name: accessCookie, Value: jwt, MaxAge: 0})
 	return nil
 }
 
+// authenticateCookies returns user id from access token in cookie.
+// If access token is missing, expired or invalid, session is continued by refresh token,
+// so that user keeps the same id. It returns http.ErrNoCookie if request has no tokens,
+// error of access token if there is no refresh token and error of refreshSession if it fails.
+func authenticateCookies(w http.ResponseWriter, r *http.Request) (uuid.UUID, error) {
+	cookie, accessErr := r.Cookie(accessCookie)
+	if accessErr == nil {
+		var c claims
+		c, accessErr = parseAccessToken(cookie.Value)
+		if accessErr == nil {
+			return c.UserID, nil
+		}
+		if !errors.Is(accessErr, sherr.ErrTokenExpired) && !errors.Is(accessErr, sherr.ErrTokenInvalid) {
+			return uuid.Nil, accessErr
+		}
+		logger.Log.Infof("Access token: %v", accessErr)
+	}
+
+	refresh, err := r.Cookie(refreshCookie)
+	if err != nil {
+		return uuid.Nil, accessErr
+	}
+	session, _, err := refreshSession(r.Context(), w, refresh.Value)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return session.UserID, nil
+}
+
 // AuthMiddleware realises middleware for user authentication.
-// It creates new user UUID if there is no token in cookie or token is invalid.
-// Otherwise it try to get user UUID from cookie.
+// Request with API key in header is authenticated as owner of key, invalid key is rejected.
+// Otherwise it gets user UUID from access token in cookie. Expired or invalid access token is replaced
+// by refresh token of session, so that user keeps the same UUID; request without valid tokens gets 401.
+// Refresh token of revoked session is rejected and cookies are cleared. Request which refresh token
+// was used by concurrent refresh gets 409 and keeps cookies, so that it can be retried with new tokens.
+// POST request without cookies registers new user with new session.
+// User UUID is passed to next handler in request context, see UserFromContext.
 func AuthMiddleware(h http.Handler) http.Handler {
 	logFn := func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie("token")
-		if err != nil {
-			if errors.Is(err, http.ErrNoCookie) {
-				logger.Log.Infof("No cookie in request, method %s", r.Method)
-
-				if r.Method != http.MethodPost {
-					http.Error(w, err.Error(), http.StatusUnauthorized)
-					return
-				}
-				userID := uuid.NewV4()
-
-				err = setNewTokenInCookie(w, userID)
-				if err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-				}
-
-				q := r.URL.Query()
-				q.Add("userUUID", userID.String())
-				r.URL.RawQuery = q.Encode()
-
-				logger.Log.Infof("New user was registered with id %s", userID)
-
-				h.ServeHTTP(w, r)
+		if secret, ok := apiKeyFromHeader(r); ok {
+			key, err := findAPIKey(r.Context(), secret)
+			if errors.Is(err, sherr.ErrAPIKeyInvalid) {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
 				return
-			} else {
+			}
+			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
+
+			logger.Log.Infof("Got user id %s from API key %s", key.UserID, key.ID)
+
+			h.ServeHTTP(w, r.WithContext(withAPIKey(r.Context(), key)))
+			return
 		}
-		userID, err := getUserID(cookie.Value)
 
-		if err != nil {
-			switch {
-			case errors.Is(err, sherr.ErrNoUserIDInToken):
+		userID, err := authenticateCookies(w, r)
+		switch {
+		case err == nil:
+		case errors.Is(err, http.ErrNoCookie):
+			logger.Log.Infof("No cookie in request, method %s", r.Method)
+
+			if r.Method != http.MethodPost {
 				http.Error(w, err.Error(), http.StatusUnauthorized)
 				return
-			case errors.Is(err, sherr.ErrTokenInvalid):
-				logger.Log.Infof("Token invalid")
-
-				userID = uuid.NewV4()
-
-				errt := setNewTokenInCookie(w, userID)
-				if errt != nil {
-					http.Error(w, errt.Error(), http.StatusInternalServerError)
-					return
-				}
+			}
+			userID = uuid.NewV4()
 
-				logger.Log.Infof("New user was registered with id %s", userID)
-			default:
+			err = startSession(r.Context(), w, userID)
+			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
-		}
 
-		q := r.URL.Query()
-		q.Add("userUUID", userID.String())
-		r.URL.RawQuery = q.Encode()
+			logger.Log.Infof("New user was registered with id %s", userID)
+		case errors.Is(err, sherr.ErrSessionRevoked):
+			logger.Log.Infof("User is not authenticated: %v", err)
+
+			clearSessionCookies(w)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		case errors.Is(err, sherr.ErrSessionConflict):
+			logger.Log.Infof("User is not authenticated: %v", err)
+
+			rejectSessionConflict(w)
+			return
+		case errors.Is(err, sherr.ErrNoUserIDInToken),
+			errors.Is(err, sherr.ErrTokenExpired),
+			errors.Is(err, sherr.ErrTokenInvalid),
+			errors.Is(err, sherr.ErrSessionInvalid):
+			logger.Log.Infof("User is not authenticated: %v", err)
+
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
 		logger.Log.Infof("Got user id %s from token", userID)
 
-		h.ServeHTTP(w, r)
+		h.ServeHTTP(w, r.WithContext(WithUser(r.Context(), userID)))
 	}
 
 	return http.HandlerFunc(logFn)
@@ -0,0 +1,69 @@
+package authenticator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Alena-Kurushkina/shortener/internal/logger"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	require.NoError(t, logger.Initialize())
+
+	var (
+		gotUser uuid.UUID
+		gotOK   bool
+	)
+	handler := AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser, gotOK = UserFromContext(r.Context())
+	}))
+
+	t.Run("new user", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+
+		require.True(t, gotOK)
+		cookies := rec.Result().Cookies()
+		require.Len(t, cookies, 1)
+		id, err := getUserID(cookies[0].Value)
+		require.NoError(t, err)
+		assert.Equal(t, id, gotUser)
+	})
+
+	t.Run("user id in query is ignored", func(t *testing.T) {
+		userID := uuid.NewV4()
+		token, err := buildJWTString(userID)
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/user/urls?userUUID="+uuid.NewV4().String(), nil)
+		req.AddCookie(&http.Cookie{Name: "token", Value: token})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		require.True(t, gotOK)
+		assert.Equal(t, userID, gotUser)
+	})
+
+	t.Run("no token", func(t *testing.T) {
+		gotOK = false
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/user/urls?userUUID="+uuid.NewV4().String(), nil))
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.False(t, gotOK)
+	})
+}
+
+func TestUserFromContext(t *testing.T) {
+	_, ok := UserFromContext(httptest.NewRequest(http.MethodGet, "/", nil).Context())
+	assert.False(t, ok)
+
+	userID := uuid.NewV4()
+	id, ok := UserFromContext(WithUser(httptest.NewRequest(http.MethodGet, "/", nil).Context(), userID))
+	assert.True(t, ok)
+	assert.Equal(t, userID, id)
+}
@@ -0,0 +1,41 @@
+package authenticator
+
+import (
+	"context"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// A userKey is key of user id in request context.
+// Its type is unexported, so other packages can't overwrite user id.
+type userKey struct{}
+
+// WithUser returns copy of ctx which carries user id.
+func WithUser(ctx context.Context, userID uuid.UUID) context.Context {
+	return context.WithValue(ctx, userKey{}, userID)
+}
+
+// UserFromContext returns user id which AuthMiddleware put into request context.
+// It returns false if request is not authenticated.
+func UserFromContext(ctx context.Context) (uuid.UUID, bool) {
+	userID, ok := ctx.Value(userKey{}).(uuid.UUID)
+	if !ok || userID == uuid.Nil {
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// An apiKeyKey is key of API key which authenticated request in request context.
+type apiKeyKey struct{}
+
+// withAPIKey returns copy of ctx which carries API key and id of its user.
+func withAPIKey(ctx context.Context, key APIKey) context.Context {
+	return context.WithValue(WithUser(ctx, key.UserID), apiKeyKey{}, key)
+}
+
+// APIKeyFromContext returns API key which authenticated request.
+// It returns false if request is authenticated by cookie.
+func APIKeyFromContext(ctx context.Context) (APIKey, bool) {
+	key, ok := ctx.Value(apiKeyKey{}).(APIKey)
+	return key, ok
+}
@@ -0,0 +1,271 @@
+package authenticator
+
+import (
+	"crypto"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/Alena-Kurushkina/shortener/internal/config"
+	"github.com/Alena-Kurushkina/shortener/internal/logger"
+	"github.com/Alena-Kurushkina/shortener/internal/sherr"
+)
+
+// Algorithms of token signature.
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// defaultKeyID is id of key defined by secret.
+const defaultKeyID = "default"
+
+// A signingKey signs and verifies tokens. Key which has no signKey only verifies tokens.
+type signingKey struct {
+	id        string
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// A keySet keeps keys which verify tokens by their ids.
+// Active key signs new tokens, the others are kept to verify tokens issued before rotation.
+type keySet struct {
+	active *signingKey
+	keys   map[string]*signingKey
+}
+
+// A keyFile is for decoding of key set file.
+// Paths of PEM files are relative to directory of key set file.
+type keyFile struct {
+	Active string `json:"active"`
+	Keys   []struct {
+		ID         string `json:"kid"`
+		Alg        string `json:"alg"`
+		Secret     string `json:"secret,omitempty"`
+		PrivateKey string `json:"private_key,omitempty"`
+		PublicKey  string `json:"public_key,omitempty"`
+	} `json:"keys"`
+}
+
+// keys signs and verifies tokens of AuthMiddleware.
+// Until Initialize is called they are random, so tokens are valid only while process runs.
+var keys = randomKeySet()
+
+// Initialize loads keys which sign and verify tokens.
+// Keys are read from key set file if it is defined by config, otherwise secret of HS256 is used.
+// If neither is defined, it returns error unless config allows development key,
+// then random key is generated and tokens become invalid after restart.
+// Time to live of access and refresh tokens is set from config too.
+func Initialize(cfg *config.Config) error {
+	var (
+		ks  *keySet
+		err error
+	)
+	switch {
+	case cfg.JWTKeysFile != "" && cfg.JWTSecret != "":
+		return errors.New("JWT secret and key set file can't be used together")
+	case cfg.JWTKeysFile != "":
+		ks, err = loadKeySet(cfg.JWTKeysFile)
+	case cfg.JWTSecret != "":
+		ks, err = newSecretKeySet(cfg.JWTKeyID, []byte(cfg.JWTSecret))
+	case cfg.JWTDevKey:
+		logger.Log.Warn("JWT signing key is not configured, random development key is used")
+		ks = randomKeySet()
+	default:
+		return errors.New("JWT signing key is not configured: set -jwt-secret (JWT_SECRET) or -jwt-keys (JWT_KEYS_FILE), " +
+			"or -jwt-dev-key (JWT_DEV_KEY=true) for development")
+	}
+	if err != nil {
+		return err
+	}
+
+	keys = ks
+	if cfg.AccessTokenTTL.Duration != 0 {
+		accessTokenTTL = cfg.AccessTokenTTL.Duration
+	}
+	if cfg.RefreshTokenTTL.Duration != 0 {
+		refreshTokenTTL = cfg.RefreshTokenTTL.Duration
+	}
+	return nil
+}
+
+// loadKeySet reads key set from JSON file like
+//
+//	{"active": "2024-06", "keys": [
+//		{"kid": "2024-06", "alg": "EdDSA", "private_key": "ed25519.pem"},
+//		{"kid": "2024-01", "alg": "HS256", "secret": "..."},
+//		{"kid": "2023-12", "alg": "RS256", "public_key": "rsa.pub.pem"}
+//	]}
+//
+// Active key must have secret or private key, keys with public key only verify tokens.
+func loadKeySet(path string) (*keySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file keyFile
+	if err = json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse key set %s: %w", path, err)
+	}
+
+	ks := &keySet{keys: make(map[string]*signingKey, len(file.Keys))}
+	dir := filepath.Dir(path)
+	for _, v := range file.Keys {
+		if v.ID == "" {
+			return nil, errors.New("key without kid in key set")
+		}
+		if _, ok := ks.keys[v.ID]; ok {
+			return nil, fmt.Errorf("duplicate key %s in key set", v.ID)
+		}
+
+		key, err := parseKey(v.ID, v.Alg, v.Secret, pemPath(dir, v.PrivateKey), pemPath(dir, v.PublicKey))
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", v.ID, err)
+		}
+		ks.keys[v.ID] = key
+	}
+
+	active, ok := ks.keys[file.Active]
+	if !ok {
+		return nil, fmt.Errorf("active key %q is not in key set", file.Active)
+	}
+	if active.signKey == nil {
+		return nil, fmt.Errorf("active key %s can't sign tokens", file.Active)
+	}
+	ks.active = active
+
+	return ks, nil
+}
+
+// pemPath returns path of PEM file relative to dir.
+func pemPath(dir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// parseKey makes key of algorithm alg from secret or from PEM files.
+func parseKey(id, alg, secret, privatePath, publicPath string) (*signingKey, error) {
+	key := &signingKey{id: id}
+
+	switch alg {
+	case AlgHS256:
+		if secret == "" {
+			return nil, errors.New("HS256 key requires secret")
+		}
+		key.method = jwt.SigningMethodHS256
+		key.signKey = []byte(secret)
+		key.verifyKey = []byte(secret)
+
+	case AlgRS256:
+		key.method = jwt.SigningMethodRS256
+		if privatePath != "" {
+			data, err := os.ReadFile(privatePath)
+			if err != nil {
+				return nil, err
+			}
+			private, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+			if err != nil {
+				return nil, err
+			}
+			key.signKey = private
+			key.verifyKey = &private.PublicKey
+		} else if publicPath != "" {
+			data, err := os.ReadFile(publicPath)
+			if err != nil {
+				return nil, err
+			}
+			if key.verifyKey, err = jwt.ParseRSAPublicKeyFromPEM(data); err != nil {
+				return nil, err
+			}
+		} else {
+			return nil, errors.New("RS256 key requires private_key or public_key")
+		}
+
+	case AlgEdDSA:
+		key.method = jwt.SigningMethodEdDSA
+		if privatePath != "" {
+			data, err := os.ReadFile(privatePath)
+			if err != nil {
+				return nil, err
+			}
+			private, err := jwt.ParseEdPrivateKeyFromPEM(data)
+			if err != nil {
+				return nil, err
+			}
+			signer, ok := private.(crypto.Signer)
+			if !ok {
+				return nil, errors.New("EdDSA private key can't sign")
+			}
+			key.signKey = signer
+			key.verifyKey = signer.Public()
+		} else if publicPath != "" {
+			data, err := os.ReadFile(publicPath)
+			if err != nil {
+				return nil, err
+			}
+			if key.verifyKey, err = jwt.ParseEdPublicKeyFromPEM(data); err != nil {
+				return nil, err
+			}
+		} else {
+			return nil, errors.New("EdDSA key requires private_key or public_key")
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q, use HS256, RS256 or EdDSA", alg)
+	}
+
+	return key, nil
+}
+
+// newSecretKeySet returns key set of one HS256 key.
+func newSecretKeySet(id string, secret []byte) (*keySet, error) {
+	if id == "" {
+		id = defaultKeyID
+	}
+	key, err := parseKey(id, AlgHS256, string(secret), "", "")
+	if err != nil {
+		return nil, err
+	}
+	return &keySet{active: key, keys: map[string]*signingKey{id: key}}, nil
+}
+
+// randomKeySet returns key set of HS256 key with random secret.
+func randomKeySet() *keySet {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	ks, _ := newSecretKeySet(defaultKeyID, secret)
+	return ks
+}
+
+// sign makes token string of claims signed by active key with its id in header.
+func (ks *keySet) sign(c jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.active.method, c)
+	token.Header["kid"] = ks.active.id
+
+	return token.SignedString(ks.active.signKey)
+}
+
+// verifyKey returns key which verifies token by id in its header.
+// Tokens signed by unknown key or by algorithm other than the key's one are invalid.
+func (ks *keySet) verifyKey(t *jwt.Token) (interface{}, error) {
+	id, _ := t.Header["kid"].(string)
+	key, ok := ks.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key %q", sherr.ErrTokenInvalid, id)
+	}
+	if t.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("%w: unexpected signing method %v", sherr.ErrTokenInvalid, t.Header["alg"])
+	}
+	return key.verifyKey, nil
+}
@@ -0,0 +1,179 @@
+package authenticator
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Alena-Kurushkina/shortener/internal/config"
+	"github.com/Alena-Kurushkina/shortener/internal/logger"
+	"github.com/Alena-Kurushkina/shortener/internal/sherr"
+)
+
+// writePEM saves DER encoded key to PEM file in dir.
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) {
+	t.Helper()
+
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0600))
+}
+
+// writeKeys makes RSA and Ed25519 keys in dir.
+func writeKeys(t *testing.T, dir string) {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	writePEM(t, dir, "rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	require.NoError(t, err)
+	writePEM(t, dir, "rsa.pub.pem", "PUBLIC KEY", der)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err = x509.MarshalPKCS8PrivateKey(edKey)
+	require.NoError(t, err)
+	writePEM(t, dir, "ed25519.pem", "PRIVATE KEY", der)
+}
+
+// writeKeySet saves key set file in dir and returns its path.
+func writeKeySet(t *testing.T, dir, data string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, "keys.json")
+	require.NoError(t, os.WriteFile(path, []byte(data), 0600))
+	return path
+}
+
+func TestKeyRotation(t *testing.T) {
+	require.NoError(t, logger.Initialize())
+	defer func(ks *keySet) { keys = ks }(keys)
+
+	dir := t.TempDir()
+	writeKeys(t, dir)
+	userID := uuid.NewV4()
+
+	// tokens issued by every algorithm are valid after rotation
+	var tokens []string
+	for _, active := range []string{"hmac", "rsa", "ed"} {
+		path := writeKeySet(t, dir, `{"active": "`+active+`", "keys": [
+			{"kid": "hmac", "alg": "HS256", "secret": "secret"},
+			{"kid": "rsa", "alg": "RS256", "private_key": "rsa.pem"},
+			{"kid": "ed", "alg": "EdDSA", "private_key": "`+filepath.Join(dir, "ed25519.pem")+`"}
+		]}`)
+		require.NoError(t, Initialize(&config.Config{Settings: config.Settings{JWTKeysFile: path}}))
+
+		token, err := buildJWTString(userID)
+		require.NoError(t, err)
+		tokens = append(tokens, token)
+
+		for _, v := range tokens {
+			id, err := getUserID(v)
+			require.NoError(t, err)
+			assert.Equal(t, userID, id)
+		}
+	}
+
+	// retired keys only verify tokens until they are removed from key set
+	path := writeKeySet(t, dir, `{"active": "new", "keys": [
+		{"kid": "new", "alg": "HS256", "secret": "new secret"},
+		{"kid": "rsa", "alg": "RS256", "public_key": "rsa.pub.pem"}
+	]}`)
+	require.NoError(t, Initialize(&config.Config{Settings: config.Settings{JWTKeysFile: path}}))
+
+	_, err := getUserID(tokens[0])
+	assert.ErrorIs(t, err, sherr.ErrTokenInvalid)
+	id, err := getUserID(tokens[1])
+	require.NoError(t, err)
+	assert.Equal(t, userID, id)
+	_, err = getUserID(tokens[2])
+	assert.ErrorIs(t, err, sherr.ErrTokenInvalid)
+}
+
+func TestGetUserIDRejectsForgedTokens(t *testing.T) {
+	require.NoError(t, logger.Initialize())
+	defer func(ks *keySet) { keys = ks }(keys)
+
+	require.NoError(t, Initialize(&config.Config{Settings: config.Settings{JWTSecret: "secret", JWTKeyID: "2024"}}))
+	userID := uuid.NewV4()
+
+	forge := func(kid interface{}, method jwt.SigningMethod, key interface{}) string {
+		token := jwt.NewWithClaims(method, claims{UserID: userID})
+		if kid != nil {
+			token.Header["kid"] = kid
+		}
+		s, err := token.SignedString(key)
+		require.NoError(t, err)
+		return s
+	}
+
+	tests := map[string]string{
+		"old hard-coded secret":  forge(nil, jwt.SigningMethodHS256, []byte("secretkey")),
+		"unknown key":            forge("2023", jwt.SigningMethodHS256, []byte("secret")),
+		"wrong secret":           forge("2024", jwt.SigningMethodHS256, []byte("secretkey")),
+		"other algorithm of key": forge("2024", jwt.SigningMethodHS512, []byte("secret")),
+	}
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := getUserID(token)
+			assert.ErrorIs(t, err, sherr.ErrTokenInvalid)
+		})
+	}
+
+	token, err := buildJWTString(userID)
+	require.NoError(t, err)
+	id, err := getUserID(token)
+	require.NoError(t, err)
+	assert.Equal(t, userID, id)
+}
+
+func TestLoadKeySetErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeKeys(t, dir)
+
+	tests := map[string]string{
+		"unknown active key":   `{"active": "b", "keys": [{"kid": "a", "alg": "HS256", "secret": "s"}]}`,
+		"active key verifies":  `{"active": "a", "keys": [{"kid": "a", "alg": "RS256", "public_key": "rsa.pub.pem"}]}`,
+		"duplicate key":        `{"active": "a", "keys": [{"kid": "a", "alg": "HS256", "secret": "s"}, {"kid": "a", "alg": "HS256", "secret": "t"}]}`,
+		"key without id":       `{"active": "", "keys": [{"alg": "HS256", "secret": "s"}]}`,
+		"unsupported alg":      `{"active": "a", "keys": [{"kid": "a", "alg": "none"}]}`,
+		"HMAC without secret":  `{"active": "a", "keys": [{"kid": "a", "alg": "HS256"}]}`,
+		"missing key file":     `{"active": "a", "keys": [{"kid": "a", "alg": "EdDSA", "private_key": "missing.pem"}]}`,
+		"key of other alg":     `{"active": "a", "keys": [{"kid": "a", "alg": "EdDSA", "private_key": "rsa.pem"}]}`,
+		"invalid key set file": `{"active": "a", "keys": {}}`,
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := loadKeySet(writeKeySet(t, dir, data))
+			assert.Error(t, err)
+		})
+	}
+
+	err := Initialize(&config.Config{Settings: config.Settings{JWTSecret: "s", JWTKeysFile: "keys.json"}})
+	assert.Error(t, err)
+}
+
+func TestInitializeRequiresKey(t *testing.T) {
+	require.NoError(t, logger.Initialize())
+	defer func(ks *keySet) { keys = ks }(keys)
+
+	assert.Error(t, Initialize(&config.Config{}))
+
+	require.NoError(t, Initialize(&config.Config{Settings: config.Settings{JWTDevKey: true}}))
+	userID := uuid.NewV4()
+	token, err := buildJWTString(userID)
+	require.NoError(t, err)
+	id, err := getUserID(token)
+	require.NoError(t, err)
+	assert.Equal(t, userID, id)
+}
@@ -0,0 +1,331 @@
+package authenticator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/Alena-Kurushkina/shortener/internal/logger"
+	"github.com/Alena-Kurushkina/shortener/internal/sherr"
+)
+
+// Names of cookies which carry tokens of user.
+const (
+	accessCookie  = "token"
+	refreshCookie = "refresh_token"
+)
+
+// sessionConflictRetryAfter is delay suggested to client which lost concurrent refresh of session,
+// so that tokens of winning refresh reach client before retry.
+const sessionConflictRetryAfter = time.Second
+
+// refreshTokenPrefix marks refresh tokens, so that they are easy to tell from API keys.
+const refreshTokenPrefix = "shr_"
+
+// A Session binds refresh token to user. Session lasts while its refresh token is used before ExpiresAt,
+// every refresh issues new refresh token and invalidates the previous one.
+// Only hash of refresh token is stored.
+type Session struct {
+	ID        string
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+	RevokedAt *time.Time
+}
+
+// A SessionStore keeps sessions by hashes of their refresh tokens.
+type SessionStore interface {
+	// InsertSession saves new session with hash of its refresh token.
+	InsertSession(ctx context.Context, session Session, hash string) error
+	// SelectSession returns session by hash of its current refresh token or ErrNotFound.
+	SelectSession(ctx context.Context, hash string) (Session, error)
+	// RotateSession replaces refresh token of session and prolongs it.
+	// It returns ErrNotFound if session is revoked or oldHash is not its current token,
+	// so that refresh token can be used only once.
+	RotateSession(ctx context.Context, id, oldHash, newHash string, expiresAt time.Time) error
+	// RevokeSession ends session, its tokens become invalid.
+	RevokeSession(ctx context.Context, id string) error
+	// SelectRevokedSessions returns ids of sessions revoked after since.
+	SelectRevokedSessions(ctx context.Context, since time.Time) ([]string, error)
+}
+
+// A TokenResponse is response of Refresh.
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// A refreshRequest is body of Refresh request for clients which don't keep cookies.
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Time to live of tokens, they are set by Initialize.
+var (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// sessions keeps sessions of AuthMiddleware.
+// Until UseSessions is called users get access tokens only and have to log in again after they expire.
+var sessions SessionStore
+
+// revoked keeps ids of revoked sessions which access tokens are not expired yet.
+var revoked = &revocationList{ids: make(map[string]time.Time)}
+
+// A revocationList keeps ids of revoked sessions in memory, so that access tokens are checked without storage.
+// Ids are kept while access tokens of session can be valid.
+// Every process has its own list which is loaded from storage only by UseSessions,
+// so access token of session revoked by another process is accepted until it expires,
+// that is not longer than access token TTL. Refresh tokens are checked in storage by every refresh.
+type revocationList struct {
+	mu  sync.RWMutex
+	ids map[string]time.Time
+}
+
+// add puts session id into list and drops ids which access tokens are expired.
+func (l *revocationList) add(id string, at time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for k, v := range l.ids {
+		if time.Since(v) > accessTokenTTL {
+			delete(l.ids, k)
+		}
+	}
+	l.ids[id] = at
+}
+
+// has reports whether session is revoked.
+func (l *revocationList) has(id string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	_, ok := l.ids[id]
+	return ok
+}
+
+// UseSessions makes AuthMiddleware keep sessions in store and issue refresh tokens.
+// Sessions revoked while their access tokens can be valid are loaded into revocation list.
+func UseSessions(ctx context.Context, store SessionStore) error {
+	if err := loadRevoked(ctx, store, time.Now().Add(-accessTokenTTL)); err != nil {
+		return err
+	}
+	sessions = store
+	return nil
+}
+
+// loadRevoked adds sessions revoked in store after since to revocation list.
+func loadRevoked(ctx context.Context, store SessionStore, since time.Time) error {
+	ids, err := store.SelectRevokedSessions(ctx, since)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, id := range ids {
+		revoked.add(id, now)
+	}
+	return nil
+}
+
+// startSession creates session of user and sets its tokens in cookies.
+// If sessions are not used, only access token is set.
+func startSession(ctx context.Context, w http.ResponseWriter, userID uuid.UUID) error {
+	if sessions == nil {
+		return setNewTokenInCookie(w, userID)
+	}
+
+	refreshToken, err := randomSecret(refreshTokenPrefix)
+	if err != nil {
+		return err
+	}
+	session := Session{
+		ID:        uuid.NewV4().String(),
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(refreshTokenTTL),
+	}
+	if err = sessions.InsertSession(ctx, session, hashSecret(refreshToken)); err != nil {
+		return err
+	}
+
+	_, err = setSessionCookies(w, session, refreshToken)
+	return err
+}
+
+// refreshSession rotates refresh token of session and sets new tokens in cookies.
+// Session is always checked in storage, so revocation by another process is taken into account.
+// It returns ErrSessionInvalid if refresh token is unknown, expired or already used,
+// ErrSessionRevoked if session is revoked and ErrSessionConflict if token is used by concurrent refresh.
+func refreshSession(ctx context.Context, w http.ResponseWriter, refreshToken string) (Session, TokenResponse, error) {
+	if sessions == nil {
+		return Session{}, TokenResponse{}, sherr.ErrSessionInvalid
+	}
+
+	hash := hashSecret(refreshToken)
+	session, err := sessions.SelectSession(ctx, hash)
+	if errors.Is(err, sherr.ErrNotFound) {
+		return Session{}, TokenResponse{}, sherr.ErrSessionInvalid
+	}
+	if err != nil {
+		return Session{}, TokenResponse{}, err
+	}
+	if session.RevokedAt != nil {
+		return Session{}, TokenResponse{}, sherr.ErrSessionRevoked
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return Session{}, TokenResponse{}, sherr.ErrSessionInvalid
+	}
+
+	newToken, err := randomSecret(refreshTokenPrefix)
+	if err != nil {
+		return Session{}, TokenResponse{}, err
+	}
+	session.ExpiresAt = time.Now().Add(refreshTokenTTL)
+	err = sessions.RotateSession(ctx, session.ID, hash, hashSecret(newToken), session.ExpiresAt)
+	if errors.Is(err, sherr.ErrNotFound) {
+		// token was used by concurrent refresh or session was revoked meanwhile,
+		// in the latter case retry gets ErrSessionRevoked
+		return Session{}, TokenResponse{}, sherr.ErrSessionConflict
+	}
+	if err != nil {
+		return Session{}, TokenResponse{}, err
+	}
+
+	tokens, err := setSessionCookies(w, session, newToken)
+	if err != nil {
+		return Session{}, TokenResponse{}, err
+	}
+
+	logger.Log.Infof("Session %s of user %s was refreshed", session.ID, session.UserID)
+
+	return session, tokens, nil
+}
+
+// setSessionCookies sets access token of session and refresh token in cookies.
+func setSessionCookies(w http.ResponseWriter, session Session, refreshToken string) (TokenResponse, error) {
+	accessToken, err := buildAccessToken(session.UserID, session.ID)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: accessCookie, Value: accessToken, MaxAge: 0})
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshCookie,
+		Value:    refreshToken,
+		Path:     "/",
+		MaxAge:   int(refreshTokenTTL.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(accessTokenTTL.Seconds()),
+	}, nil
+}
+
+// clearSessionCookies removes tokens from cookies.
+func clearSessionCookies(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: accessCookie, Value: "", MaxAge: -1})
+	http.SetCookie(w, &http.Cookie{Name: refreshCookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+}
+
+// rejectSessionConflict responds with status Conflict and Retry-After header to request
+// which lost concurrent refresh of session. Cookies are kept.
+func rejectSessionConflict(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(sessionConflictRetryAfter.Seconds())))
+	http.Error(w, sherr.ErrSessionConflict.Error(), http.StatusConflict)
+}
+
+// refreshTokenFromRequest returns refresh token from cookie or from JSON body of request.
+func refreshTokenFromRequest(r *http.Request) (string, bool) {
+	if cookie, err := r.Cookie(refreshCookie); err == nil && cookie.Value != "" {
+		return cookie.Value, true
+	}
+
+	var body refreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.RefreshToken == "" {
+		return "", false
+	}
+	return body.RefreshToken, true
+}
+
+// Refresh issues new access and refresh tokens of session by refresh token
+// from cookie or from body {"refresh_token": "..."}.
+// Tokens are set in cookies and returned in response body.
+// Used refresh token becomes invalid. Cookies are cleared only if session is revoked,
+// so that refresh which lost the race with concurrent one doesn't remove tokens issued by that one.
+func Refresh(w http.ResponseWriter, r *http.Request) {
+	refreshToken, ok := refreshTokenFromRequest(r)
+	if !ok {
+		http.Error(w, "Refresh token is required", http.StatusUnauthorized)
+		return
+	}
+
+	_, tokens, err := refreshSession(r.Context(), w, refreshToken)
+	if errors.Is(err, sherr.ErrSessionRevoked) {
+		clearSessionCookies(w)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if errors.Is(err, sherr.ErrSessionConflict) {
+		rejectSessionConflict(w)
+		return
+	}
+	if errors.Is(err, sherr.ErrSessionInvalid) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(tokens); err != nil {
+		logger.Log.Errorf("Encode tokens: %v", err)
+	}
+}
+
+// Logout revokes session of request and removes tokens from cookies.
+// Session is found by access token, even expired one, or by refresh token.
+func Logout(w http.ResponseWriter, r *http.Request) {
+	id := sessionIDFromRequest(r)
+	if id != "" && sessions != nil {
+		if err := sessions.RevokeSession(r.Context(), id); err != nil && !errors.Is(err, sherr.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		revoked.add(id, time.Now())
+
+		logger.Log.Infof("Session %s was revoked", id)
+	}
+
+	clearSessionCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sessionIDFromRequest returns id of session which tokens request carries or empty string.
+func sessionIDFromRequest(r *http.Request) string {
+	if cookie, err := r.Cookie(accessCookie); err == nil {
+		c, err := parseAccessToken(cookie.Value)
+		if (err == nil || errors.Is(err, sherr.ErrTokenExpired)) && c.SessionID != "" {
+			return c.SessionID
+		}
+	}
+	if refreshToken, ok := refreshTokenFromRequest(r); ok && sessions != nil {
+		if session, err := sessions.SelectSession(r.Context(), hashSecret(refreshToken)); err == nil {
+			return session.ID
+		}
+	}
+	return ""
+}
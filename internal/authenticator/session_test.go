@@ -0,0 +1,319 @@
+package authenticator
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Alena-Kurushkina/shortener/internal/logger"
+	"github.com/Alena-Kurushkina/shortener/internal/sherr"
+)
+
+// A sessionMap keeps sessions in map by hashes of their refresh tokens.
+type sessionMap struct {
+	mu       sync.Mutex
+	sessions map[string]Session
+}
+
+func (m *sessionMap) InsertSession(_ context.Context, session Session, hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sessions[hash] = session
+	return nil
+}
+
+func (m *sessionMap) SelectSession(_ context.Context, hash string) (Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[hash]
+	if !ok {
+		return Session{}, sherr.ErrNotFound
+	}
+	return session, nil
+}
+
+func (m *sessionMap) RotateSession(_ context.Context, id, oldHash, newHash string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[oldHash]
+	if !ok || session.ID != id || session.RevokedAt != nil {
+		return sherr.ErrNotFound
+	}
+	delete(m.sessions, oldHash)
+	session.ExpiresAt = expiresAt
+	m.sessions[newHash] = session
+	return nil
+}
+
+func (m *sessionMap) RevokeSession(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for hash, v := range m.sessions {
+		if v.ID == id {
+			now := time.Now()
+			v.RevokedAt = &now
+			m.sessions[hash] = v
+			return nil
+		}
+	}
+	return sherr.ErrNotFound
+}
+
+func (m *sessionMap) SelectRevokedSessions(_ context.Context, since time.Time) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var ids []string
+	for _, v := range m.sessions {
+		if v.RevokedAt != nil && v.RevokedAt.After(since) {
+			ids = append(ids, v.ID)
+		}
+	}
+	return ids, nil
+}
+
+// revokeUser marks active sessions of user as revoked.
+func (m *sessionMap) revokeUser(userID uuid.UUID) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for hash, v := range m.sessions {
+		if uuid.Equal(v.UserID, userID) && v.RevokedAt == nil {
+			v.RevokedAt = &now
+			m.sessions[hash] = v
+		}
+	}
+}
+
+// useSessionMap makes AuthMiddleware keep sessions in new sessionMap until test ends.
+func useSessionMap(t *testing.T) *sessionMap {
+	t.Helper()
+
+	store := &sessionMap{sessions: make(map[string]Session)}
+	prev := sessions
+	t.Cleanup(func() { sessions = prev })
+	require.NoError(t, UseSessions(context.Background(), store))
+	return store
+}
+
+// cookie returns value of cookie set in response or empty string.
+func cookie(rec *httptest.ResponseRecorder, name string) string {
+	for _, v := range rec.Result().Cookies() {
+		if v.Name == name {
+			return v.Value
+		}
+	}
+	return ""
+}
+
+// expiredToken returns access token of session which expired a minute ago.
+func expiredToken(t *testing.T, userID uuid.UUID, sessionID string) string {
+	t.Helper()
+
+	token, err := keys.sign(claims{
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute))},
+		UserID:           userID,
+		SessionID:        sessionID,
+	})
+	require.NoError(t, err)
+	return token
+}
+
+func TestSessions(t *testing.T) {
+	require.NoError(t, logger.Initialize())
+	useSessionMap(t)
+
+	var gotUser uuid.UUID
+	handler := AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser, _ = UserFromContext(r.Context())
+	}))
+	serve := func(method, access, refresh string) *httptest.ResponseRecorder {
+		gotUser = uuid.Nil
+		req := httptest.NewRequest(method, "/api/user/urls", nil)
+		if access != "" {
+			req.AddCookie(&http.Cookie{Name: accessCookie, Value: access})
+		}
+		if refresh != "" {
+			req.AddCookie(&http.Cookie{Name: refreshCookie, Value: refresh})
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// new user gets session
+	rec := serve(http.MethodPost, "", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	userID := gotUser
+	refresh := cookie(rec, refreshCookie)
+	require.NotEmpty(t, refresh)
+	c, err := parseAccessToken(cookie(rec, accessCookie))
+	require.NoError(t, err)
+	assert.Equal(t, userID, c.UserID)
+	require.NotEmpty(t, c.SessionID)
+
+	t.Run("expired access token is refreshed for the same user", func(t *testing.T) {
+		rec := serve(http.MethodGet, expiredToken(t, userID, c.SessionID), refresh)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, userID, gotUser)
+
+		newRefresh := cookie(rec, refreshCookie)
+		require.NotEmpty(t, newRefresh)
+		assert.NotEqual(t, refresh, newRefresh)
+
+		// used refresh token is rejected
+		rec = serve(http.MethodGet, "", refresh)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+		refresh = newRefresh
+	})
+
+	t.Run("missing access token is refreshed", func(t *testing.T) {
+		rec := serve(http.MethodGet, "", refresh)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, userID, gotUser)
+		refresh = cookie(rec, refreshCookie)
+	})
+
+	t.Run("expired access token without refresh token", func(t *testing.T) {
+		rec := serve(http.MethodPost, expiredToken(t, userID, c.SessionID), "")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, uuid.Nil, gotUser)
+	})
+
+	t.Run("forged access token without refresh token", func(t *testing.T) {
+		rec := serve(http.MethodPost, "forged", "")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, uuid.Nil, gotUser)
+	})
+
+	t.Run("logout revokes session", func(t *testing.T) {
+		access, err := buildAccessToken(userID, c.SessionID)
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/logout", nil)
+		req.AddCookie(&http.Cookie{Name: accessCookie, Value: access})
+		rec := httptest.NewRecorder()
+		Logout(rec, req)
+		require.Equal(t, http.StatusNoContent, rec.Code)
+
+		assert.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, access, "").Code)
+
+		// refresh token of revoked session is rejected and cookies are cleared
+		rec = serve(http.MethodGet, access, refresh)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, uuid.Nil, gotUser)
+		for _, v := range rec.Result().Cookies() {
+			assert.Negative(t, v.MaxAge, v.Name)
+		}
+	})
+}
+
+// A racingSessionMap rotates refresh token of session just before every rotation,
+// as concurrent refresh which wins the race does.
+type racingSessionMap struct {
+	*sessionMap
+}
+
+func (m racingSessionMap) RotateSession(ctx context.Context, id, oldHash, newHash string, expiresAt time.Time) error {
+	if err := m.sessionMap.RotateSession(ctx, id, oldHash, "winner "+newHash, expiresAt); err != nil {
+		return err
+	}
+	return m.sessionMap.RotateSession(ctx, id, oldHash, newHash, expiresAt)
+}
+
+func TestConcurrentRefresh(t *testing.T) {
+	require.NoError(t, logger.Initialize())
+	store := useSessionMap(t)
+	sessions = racingSessionMap{store}
+
+	handler := AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	requests := map[string]func(refresh string) *httptest.ResponseRecorder{
+		"middleware": func(refresh string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+			req.AddCookie(&http.Cookie{Name: refreshCookie, Value: refresh})
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			return rec
+		},
+		"refresh": func(refresh string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, "/api/auth/refresh", nil)
+			req.AddCookie(&http.Cookie{Name: refreshCookie, Value: refresh})
+			rec := httptest.NewRecorder()
+			Refresh(rec, req)
+			return rec
+		},
+	}
+	for name, request := range requests {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			require.NoError(t, startSession(context.Background(), rec, uuid.NewV4()))
+
+			// request which lost the race can be retried and doesn't remove tokens of winner
+			rec = request(cookie(rec, refreshCookie))
+			assert.Equal(t, http.StatusConflict, rec.Code)
+			assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+			assert.Empty(t, rec.Result().Cookies())
+		})
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	require.NoError(t, logger.Initialize())
+	useSessionMap(t)
+
+	userID := uuid.NewV4()
+	rec := httptest.NewRecorder()
+	require.NoError(t, startSession(context.Background(), rec, userID))
+	refresh := cookie(rec, refreshCookie)
+
+	t.Run("refresh token in body", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		Refresh(rec, httptest.NewRequest(http.MethodPost, "/api/auth/refresh", strings.NewReader(`{"refresh_token":"`+refresh+`"}`)))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var tokens TokenResponse
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&tokens))
+		assert.Equal(t, int64(accessTokenTTL.Seconds()), tokens.ExpiresIn)
+		assert.Equal(t, tokens.RefreshToken, cookie(rec, refreshCookie))
+		id, err := getUserID(tokens.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, userID, id)
+		refresh = tokens.RefreshToken
+	})
+
+	t.Run("refresh token in cookie", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/refresh", nil)
+		req.AddCookie(&http.Cookie{Name: refreshCookie, Value: refresh})
+		rec := httptest.NewRecorder()
+		Refresh(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("used refresh token", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		Refresh(rec, httptest.NewRequest(http.MethodPost, "/api/auth/refresh", strings.NewReader(`{"refresh_token":"`+refresh+`"}`)))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Empty(t, rec.Result().Cookies())
+	})
+
+	t.Run("no refresh token", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		Refresh(rec, httptest.NewRequest(http.MethodPost, "/api/auth/refresh", nil))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+}
@@ -6,15 +6,26 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/Alena-Kurushkina/shortener/internal/generator"
 )
 
 // A Config serves all configuration variables.
 type Config struct {
 	ConfigPath string
 	Settings
+
+	// envErr keeps errors of parsing environment variables until Validate
+	envErr error
 }
 
 // A Settings keeps service main configurations.
@@ -24,6 +35,56 @@ type Settings struct {
 	FileStoragePath string `json:"file_storage_path"`
 	ConnectionStr   string `json:"database_dsn"`
 	EnableHTTPS     bool   `json:"enable_https"`
+
+	FileSyncPolicy   string   `json:"file_sync_policy"`
+	FileSyncInterval Duration `json:"file_sync_interval"`
+
+	FileCompactInterval  Duration `json:"file_compact_interval"`
+	FileCompactThreshold int      `json:"file_compact_threshold"`
+
+	CacheSize int      `json:"cache_size"`
+	CacheTTL  Duration `json:"cache_ttl"`
+
+	GeneratorStrategy string `json:"generator_strategy"`
+	GeneratorAlphabet string `json:"generator_alphabet"`
+	ShortLength       int    `json:"short_length"`
+
+	AliasPattern    string   `json:"alias_pattern"`
+	ReservedAliases []string `json:"reserved_aliases"`
+
+	ReaperInterval   Duration `json:"reaper_interval"`
+	DeletedRetention Duration `json:"deleted_retention"`
+
+	RedirectCode int `json:"redirect_code"`
+
+	JWTSecret   string `json:"jwt_secret"`
+	JWTKeyID    string `json:"jwt_key_id"`
+	JWTKeysFile string `json:"jwt_keys_file"`
+	// JWTDevKey allows to start without configured key, tokens are signed by random key
+	// and become invalid after restart, so it is for development only
+	JWTDevKey bool `json:"jwt_dev_key"`
+
+	AccessTokenTTL  Duration `json:"access_token_ttl"`
+	RefreshTokenTTL Duration `json:"refresh_token_ttl"`
+}
+
+// A Duration is time.Duration which is read from config file as string like "1s" or "5m".
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON parses duration from JSON string.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
 }
 
 var (
@@ -32,6 +93,7 @@ var (
 )
 
 // InitConfig initialize configuration variables from flags values and environment variables.
+// Values which can't be parsed and values out of range are reported by Validate.
 func InitConfig() *Config {
 	once.Do(
 		func() {
@@ -39,14 +101,52 @@ func InitConfig() *Config {
 			cfg = &Config{}
 			cfg.ServerAddress = "localhost:8080"
 			cfg.BaseURL = "http://localhost:8080"
+			cfg.FileSyncPolicy = "interval"
+			cfg.FileSyncInterval.Duration = time.Second
+			cfg.FileCompactInterval.Duration = time.Minute
+			cfg.FileCompactThreshold = 1000
+			cfg.CacheTTL.Duration = time.Minute
+			cfg.GeneratorStrategy = generator.StrategyRandom
+			cfg.GeneratorAlphabet = generator.Base62
+			cfg.ShortLength = 15
+			cfg.AliasPattern = `^[a-zA-Z0-9_-]{3,64}$`
+			cfg.ReservedAliases = []string{"ping", "api", "debug"}
+			cfg.ReaperInterval.Duration = time.Minute
+			cfg.DeletedRetention.Duration = 30 * 24 * time.Hour
+			cfg.RedirectCode = http.StatusTemporaryRedirect
+			cfg.AccessTokenTTL.Duration = 15 * time.Minute
+			cfg.RefreshTokenTTL.Duration = 30 * 24 * time.Hour
 
 			// define flags
 			flagValues := &Config{}
 			flag.StringVar(&flagValues.ServerAddress, "a", "", "address of HTTP server")
 			flag.StringVar(&flagValues.BaseURL, "b", "", "base address of shorten URL")
 			flag.StringVar(&flagValues.FileStoragePath, "f", "", "path to storage file")
-			flag.StringVar(&flagValues.ConnectionStr, "d", "", "connection string to database")
+			flag.StringVar(&flagValues.ConnectionStr, "d", "", "connection string to database, sqlite://<path> selects SQLite")
 			flag.BoolVar(&flagValues.EnableHTTPS, "s", false, "enable HTTPS")
+			flag.StringVar(&flagValues.FileSyncPolicy, "file-sync", "", "fsync policy of storage file: always, interval or never")
+			flag.DurationVar(&flagValues.FileSyncInterval.Duration, "file-sync-interval", 0, "fsync interval of storage file")
+			flag.DurationVar(&flagValues.FileCompactInterval.Duration, "file-compact-interval", 0, "interval of storage file compaction checks")
+			flag.IntVar(&flagValues.FileCompactThreshold, "file-compact-threshold", 0, "number of storage file records which triggers compaction")
+			flag.IntVar(&flagValues.CacheSize, "cache-size", 0, "number of cached shortenings, 0 disables cache")
+			flag.DurationVar(&flagValues.CacheTTL.Duration, "cache-ttl", 0, "time to live of cached shortening")
+			flag.StringVar(&flagValues.GeneratorStrategy, "generator", "", "strategy of shortening generation: random, counter or hash")
+			flag.StringVar(&flagValues.GeneratorAlphabet, "alphabet", "", "characters of generated shortenings")
+			flag.IntVar(&flagValues.ShortLength, "short-length", 0, "length of generated shortenings, minimal length for counter strategy")
+			flag.StringVar(&flagValues.AliasPattern, "alias-pattern", "", "regular expression which custom aliases must match")
+			flag.Func("reserved-aliases", "comma separated words which can't be used as custom aliases", func(s string) error {
+				flagValues.ReservedAliases = strings.Split(s, ",")
+				return nil
+			})
+			flag.DurationVar(&flagValues.ReaperInterval.Duration, "reaper-interval", 0, "interval of deleting expired shortenings")
+			flag.DurationVar(&flagValues.DeletedRetention.Duration, "deleted-retention", 0, "time after which deleted shortenings are purged permanently")
+			flag.IntVar(&flagValues.RedirectCode, "redirect-code", 0, "default HTTP status of redirect by shortening: 301, 302, 307 or 308")
+			flag.StringVar(&flagValues.JWTSecret, "jwt-secret", "", "secret of HS256 signature of user tokens")
+			flag.StringVar(&flagValues.JWTKeyID, "jwt-kid", "", "id of key defined by JWT secret")
+			flag.StringVar(&flagValues.JWTKeysFile, "jwt-keys", "", "path to JSON file with keys of user tokens")
+			flag.BoolVar(&flagValues.JWTDevKey, "jwt-dev-key", false, "sign user tokens with random key if no key is configured, for development only")
+			flag.DurationVar(&flagValues.AccessTokenTTL.Duration, "access-token-ttl", 0, "time to live of user access token")
+			flag.DurationVar(&flagValues.RefreshTokenTTL.Duration, "refresh-token-ttl", 0, "time to live of user session without refresh")
 
 			flag.StringVar(&cfg.ConfigPath, "c", "", "path to config file")
 			flag.StringVar(&cfg.ConfigPath, "config", "", "path to config file")
@@ -77,39 +177,105 @@ func InitConfig() *Config {
 				if settings.ServerAddress != "" {
 					cfg.ServerAddress = settings.ServerAddress
 				}
+				if settings.FileSyncPolicy != "" {
+					cfg.FileSyncPolicy = settings.FileSyncPolicy
+				}
+				if settings.FileSyncInterval.Duration != 0 {
+					cfg.FileSyncInterval = settings.FileSyncInterval
+				}
+				if settings.FileCompactInterval.Duration != 0 {
+					cfg.FileCompactInterval = settings.FileCompactInterval
+				}
+				if settings.FileCompactThreshold != 0 {
+					cfg.FileCompactThreshold = settings.FileCompactThreshold
+				}
+				if settings.CacheSize != 0 {
+					cfg.CacheSize = settings.CacheSize
+				}
+				if settings.CacheTTL.Duration != 0 {
+					cfg.CacheTTL = settings.CacheTTL
+				}
+				if settings.GeneratorStrategy != "" {
+					cfg.GeneratorStrategy = settings.GeneratorStrategy
+				}
+				if settings.GeneratorAlphabet != "" {
+					cfg.GeneratorAlphabet = settings.GeneratorAlphabet
+				}
+				if settings.ShortLength != 0 {
+					cfg.ShortLength = settings.ShortLength
+				}
+				if settings.AliasPattern != "" {
+					cfg.AliasPattern = settings.AliasPattern
+				}
+				if settings.ReservedAliases != nil {
+					cfg.ReservedAliases = settings.ReservedAliases
+				}
+				if settings.ReaperInterval.Duration != 0 {
+					cfg.ReaperInterval = settings.ReaperInterval
+				}
+				if settings.DeletedRetention.Duration != 0 {
+					cfg.DeletedRetention = settings.DeletedRetention
+				}
+				if settings.RedirectCode != 0 {
+					cfg.RedirectCode = settings.RedirectCode
+				}
+				if settings.JWTSecret != "" {
+					cfg.JWTSecret = settings.JWTSecret
+				}
+				if settings.JWTKeyID != "" {
+					cfg.JWTKeyID = settings.JWTKeyID
+				}
+				if settings.JWTKeysFile != "" {
+					cfg.JWTKeysFile = settings.JWTKeysFile
+				}
+				if settings.JWTDevKey {
+					cfg.JWTDevKey = settings.JWTDevKey
+				}
+				if settings.AccessTokenTTL.Duration != 0 {
+					cfg.AccessTokenTTL = settings.AccessTokenTTL
+				}
+				if settings.RefreshTokenTTL.Duration != 0 {
+					cfg.RefreshTokenTTL = settings.RefreshTokenTTL
+				}
 			}
 
-			// read environment variables
-			sa, exists := os.LookupEnv("SERVER_ADDRESS")
-			if exists {
-				cfg.ServerAddress = sa
-			} else if flagValues.ServerAddress != "" {
-				cfg.ServerAddress = flagValues.ServerAddress
-			}
-			bu, exists := os.LookupEnv("BASE_URL")
-			if exists {
-				cfg.BaseURL = bu
-			} else if flagValues.BaseURL != "" {
-				cfg.BaseURL = flagValues.BaseURL
-			}
-			fu, exists := os.LookupEnv("FILE_STORAGE_PATH")
-			if exists {
-				cfg.FileStoragePath = fu
-			} else if flagValues.FileStoragePath != "" {
-				cfg.FileStoragePath = flagValues.FileStoragePath
-			}
-			du, exists := os.LookupEnv("DATABASE_DSN")
-			if exists {
-				cfg.ConnectionStr = du
-			} else if flagValues.ConnectionStr != "" {
-				cfg.ConnectionStr = flagValues.ConnectionStr
-			}
-			_, exists = os.LookupEnv("ENABLE_HTTPS")
-			if exists {
-				cfg.EnableHTTPS = true
-			} else if flagValues.EnableHTTPS {
-				cfg.EnableHTTPS = flagValues.EnableHTTPS
-			}
+			// read environment variables, they have priority over flags
+			cfg.envErr = errors.Join(
+				setString(&cfg.ServerAddress, "SERVER_ADDRESS", flagValues.ServerAddress),
+				setString(&cfg.BaseURL, "BASE_URL", flagValues.BaseURL),
+				setString(&cfg.FileStoragePath, "FILE_STORAGE_PATH", flagValues.FileStoragePath),
+				setString(&cfg.ConnectionStr, "DATABASE_DSN", flagValues.ConnectionStr),
+				// any value of ENABLE_HTTPS enables HTTPS
+				setting(&cfg.EnableHTTPS, "ENABLE_HTTPS", flagValues.EnableHTTPS, func(string) (bool, error) { return true, nil }),
+
+				setString(&cfg.FileSyncPolicy, "FILE_SYNC_POLICY", flagValues.FileSyncPolicy),
+				setDuration(&cfg.FileSyncInterval, "FILE_SYNC_INTERVAL", flagValues.FileSyncInterval),
+				setDuration(&cfg.FileCompactInterval, "FILE_COMPACT_INTERVAL", flagValues.FileCompactInterval),
+				setInt(&cfg.FileCompactThreshold, "FILE_COMPACT_THRESHOLD", flagValues.FileCompactThreshold),
+
+				setInt(&cfg.CacheSize, "CACHE_SIZE", flagValues.CacheSize),
+				setDuration(&cfg.CacheTTL, "CACHE_TTL", flagValues.CacheTTL),
+
+				setString(&cfg.GeneratorStrategy, "GENERATOR_STRATEGY", flagValues.GeneratorStrategy),
+				setString(&cfg.GeneratorAlphabet, "GENERATOR_ALPHABET", flagValues.GeneratorAlphabet),
+				setInt(&cfg.ShortLength, "SHORT_LENGTH", flagValues.ShortLength),
+
+				setString(&cfg.AliasPattern, "ALIAS_PATTERN", flagValues.AliasPattern),
+				setList(&cfg.ReservedAliases, "RESERVED_ALIASES", flagValues.ReservedAliases),
+
+				setDuration(&cfg.ReaperInterval, "REAPER_INTERVAL", flagValues.ReaperInterval),
+				setDuration(&cfg.DeletedRetention, "DELETED_RETENTION", flagValues.DeletedRetention),
+
+				setInt(&cfg.RedirectCode, "REDIRECT_CODE", flagValues.RedirectCode),
+
+				setString(&cfg.JWTSecret, "JWT_SECRET", flagValues.JWTSecret),
+				setString(&cfg.JWTKeyID, "JWT_KEY_ID", flagValues.JWTKeyID),
+				setString(&cfg.JWTKeysFile, "JWT_KEYS_FILE", flagValues.JWTKeysFile),
+				setting(&cfg.JWTDevKey, "JWT_DEV_KEY", flagValues.JWTDevKey, strconv.ParseBool),
+
+				setDuration(&cfg.AccessTokenTTL, "ACCESS_TOKEN_TTL", flagValues.AccessTokenTTL),
+				setDuration(&cfg.RefreshTokenTTL, "REFRESH_TOKEN_TTL", flagValues.RefreshTokenTTL),
+			)
 
 			// form BaseURL variable
 			if len(cfg.BaseURL) != 0 && cfg.BaseURL[len(cfg.BaseURL)-1:] != "/" {
@@ -119,6 +285,87 @@ func InitConfig() *Config {
 	return cfg
 }
 
+// Validate returns error if environment variables can't be parsed or settings are out of range.
+func (c *Config) Validate() error {
+	errs := []error{c.envErr}
+
+	// durations of tickers and token lifetimes
+	positive := func(name string, d Duration) {
+		if d.Duration <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive, got %s", name, d))
+		}
+	}
+	positive("file sync interval", c.FileSyncInterval)
+	positive("file compaction interval", c.FileCompactInterval)
+	positive("reaper interval", c.ReaperInterval)
+	positive("access token TTL", c.AccessTokenTTL)
+	positive("refresh token TTL", c.RefreshTokenTTL)
+	if c.CacheSize > 0 {
+		positive("cache TTL", c.CacheTTL)
+	}
+	if c.DeletedRetention.Duration < 0 {
+		errs = append(errs, fmt.Errorf("deleted retention can't be negative, got %s", c.DeletedRetention))
+	}
+	if c.CacheSize < 0 {
+		errs = append(errs, fmt.Errorf("cache size can't be negative, got %d", c.CacheSize))
+	}
+	if c.FileCompactThreshold < 0 {
+		errs = append(errs, fmt.Errorf("file compaction threshold can't be negative, got %d", c.FileCompactThreshold))
+	}
+	if c.ShortLength <= 0 {
+		errs = append(errs, fmt.Errorf("short length must be positive, got %d", c.ShortLength))
+	}
+
+	return errors.Join(errs...)
+}
+
+// setting sets dst to value of environment variable name parsed by parse
+// or, if variable is not defined, to flag value if it isn't zero.
+func setting[T comparable](dst *T, name string, flagValue T, parse func(string) (T, error)) error {
+	if s, exists := os.LookupEnv(name); exists {
+		v, err := parse(s)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: %w", name, s, err)
+		}
+		*dst = v
+		return nil
+	}
+
+	var zero T
+	if flagValue != zero {
+		*dst = flagValue
+	}
+	return nil
+}
+
+// setString sets dst to value of environment variable name or to nonempty flag value.
+func setString(dst *string, name, flagValue string) error {
+	return setting(dst, name, flagValue, func(s string) (string, error) { return s, nil })
+}
+
+// setList sets dst to comma separated words from environment variable name or to flag value if it is set.
+func setList(dst *[]string, name string, flagValue []string) error {
+	if s, exists := os.LookupEnv(name); exists {
+		*dst = strings.Split(s, ",")
+	} else if flagValue != nil {
+		*dst = flagValue
+	}
+	return nil
+}
+
+// setInt sets dst to integer from environment variable name or to nonzero flag value.
+func setInt(dst *int, name string, flagValue int) error {
+	return setting(dst, name, flagValue, strconv.Atoi)
+}
+
+// setDuration sets dst to duration like "1s" from environment variable name or to nonzero flag value.
+func setDuration(dst *Duration, name string, flagValue Duration) error {
+	return setting(dst, name, flagValue, func(s string) (Duration, error) {
+		d, err := time.ParseDuration(s)
+		return Duration{d}, err
+	})
+}
+
 func readConfigFromFile(pathToConfig string, settings *Settings) error {
 	dir, err := os.Getwd()
 	if err != nil {
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetting(t *testing.T) {
+	t.Run("environment variable has priority over flag", func(t *testing.T) {
+		t.Setenv("TEST_DURATION", "5s")
+		d := Duration{time.Second}
+		require.NoError(t, setDuration(&d, "TEST_DURATION", Duration{time.Minute}))
+		assert.Equal(t, 5*time.Second, d.Duration)
+	})
+
+	t.Run("nonzero flag is applied without environment variable", func(t *testing.T) {
+		n := 1
+		require.NoError(t, setInt(&n, "TEST_UNDEFINED_INT", 7))
+		assert.Equal(t, 7, n)
+
+		require.NoError(t, setInt(&n, "TEST_UNDEFINED_INT", 0))
+		assert.Equal(t, 7, n)
+	})
+
+	t.Run("invalid value is error", func(t *testing.T) {
+		t.Setenv("TEST_DURATION", "5")
+		d := Duration{time.Second}
+		assert.ErrorContains(t, setDuration(&d, "TEST_DURATION", Duration{}), "TEST_DURATION")
+		assert.Equal(t, time.Second, d.Duration)
+
+		t.Setenv("TEST_INT", "ten")
+		n := 1
+		assert.Error(t, setInt(&n, "TEST_INT", 0))
+	})
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() *Config {
+		c := &Config{}
+		c.FileSyncInterval.Duration = time.Second
+		c.FileCompactInterval.Duration = time.Minute
+		c.ReaperInterval.Duration = time.Minute
+		c.AccessTokenTTL.Duration = time.Minute
+		c.RefreshTokenTTL.Duration = time.Hour
+		c.ShortLength = 8
+		return c
+	}
+	require.NoError(t, valid().Validate())
+
+	tests := map[string]func(c *Config){
+		"zero sync interval":         func(c *Config) { c.FileSyncInterval.Duration = 0 },
+		"negative reaper interval":   func(c *Config) { c.ReaperInterval.Duration = -time.Second },
+		"zero cache TTL":             func(c *Config) { c.CacheSize = 10; c.CacheTTL.Duration = 0 },
+		"negative cache size":        func(c *Config) { c.CacheSize = -1 },
+		"negative deleted retention": func(c *Config) { c.DeletedRetention.Duration = -time.Hour },
+		"zero short length":          func(c *Config) { c.ShortLength = 0 },
+	}
+	for name, modify := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := valid()
+			modify(c)
+			assert.Error(t, c.Validate())
+		})
+	}
+}
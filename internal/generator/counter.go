@@ -0,0 +1,86 @@
+package generator
+
+import (
+	"hash/fnv"
+	"math/big"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Layout of Snowflake-style identifier: milliseconds since epoch, node and sequence number within millisecond.
+const (
+	nodeBits     = 10
+	sequenceBits = 12
+	maxSequence  = 1<<sequenceBits - 1
+)
+
+// epoch is start of time counted in identifiers.
+var epoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// mixMultiplier is odd constant, so multiplication by it is bijection of 64-bit numbers
+// which scatters consecutive identifiers.
+const mixMultiplier = 0x9E3779B97F4A7C15
+
+// A CounterGenerator makes shortenings of unique increasing identifiers.
+// Identifiers are scattered and encoded with permutation of alphabet,
+// so that consecutive shortenings don't look consecutive.
+type CounterGenerator struct {
+	alphabet  string
+	minLength int
+	node      uint64
+
+	mu       sync.Mutex
+	lastTime uint64
+	sequence uint64
+}
+
+// NewCounterGenerator returns generator of shortenings of Snowflake-style identifiers.
+// Shortenings are padded up to minLength.
+func NewCounterGenerator(alphabet string, minLength int) *CounterGenerator {
+	return &CounterGenerator{
+		alphabet:  permute(alphabet),
+		minLength: minLength,
+	}
+}
+
+// permute shuffles alphabet in the same way on every start.
+func permute(alphabet string) string {
+	h := fnv.New64a()
+	h.Write([]byte(alphabet))
+
+	chars := []byte(alphabet)
+	rand.New(rand.NewSource(int64(h.Sum64()))).Shuffle(len(chars), func(i, j int) {
+		chars[i], chars[j] = chars[j], chars[i]
+	})
+
+	return string(chars)
+}
+
+// nextID returns unique identifier. If sequence of millisecond is exhausted
+// or clock goes backwards identifiers are counted from the latest used millisecond.
+func (g *CounterGenerator) nextID() uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := uint64(time.Since(epoch).Milliseconds())
+	if now > g.lastTime {
+		g.lastTime = now
+		g.sequence = 0
+	} else {
+		g.sequence++
+		if g.sequence > maxSequence {
+			g.lastTime++
+			g.sequence = 0
+		}
+	}
+
+	return g.lastTime<<(nodeBits+sequenceBits) | g.node<<sequenceBits | g.sequence
+}
+
+// Generate returns shortening of next identifier, URL and attempt are not used.
+func (g *CounterGenerator) Generate(_ string, _ int) string {
+	id := g.nextID() * mixMultiplier
+
+	return encode(new(big.Int).SetUint64(id), g.alphabet, g.minLength)
+}
@@ -1,14 +1,93 @@
-// Package generator realises function for generating random string of certain length
+// Package generator realises strategies of generating shortenings of long URL.
 package generator
 
 import (
 	"crypto/rand"
+	"errors"
+	"fmt"
 	"math/big"
 	"strings"
 )
 
 const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 
+// Base62 is default alphabet of shortenings.
+const Base62 = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// Names of generation strategies.
+const (
+	StrategyRandom  = "random"
+	StrategyCounter = "counter"
+	StrategyHash    = "hash"
+)
+
+// A Generator makes shortenings of long URL.
+// Attempt is number of previous shortenings of the same URL which collided with existing ones,
+// generator must return different shortening for different attempts.
+type Generator interface {
+	Generate(originalURL string, attempt int) string
+}
+
+// New returns generator of strategy which makes shortenings of passed length from characters of alphabet.
+// For counter strategy length is minimal length of shortening.
+func New(strategy, alphabet string, length int) (Generator, error) {
+	if err := checkAlphabet(alphabet); err != nil {
+		return nil, err
+	}
+	if length <= 0 {
+		return nil, errors.New("length of shortening must be positive")
+	}
+
+	switch strategy {
+	case StrategyRandom:
+		return NewRandomGenerator(alphabet, length), nil
+	case StrategyCounter:
+		return NewCounterGenerator(alphabet, length), nil
+	case StrategyHash:
+		return NewHashGenerator(alphabet, length)
+	default:
+		return nil, fmt.Errorf("unknown generation strategy %q, use random, counter or hash", strategy)
+	}
+}
+
+// checkAlphabet returns error if alphabet is too short or has repeated characters.
+func checkAlphabet(alphabet string) error {
+	if len(alphabet) < 2 {
+		return errors.New("alphabet must have at least 2 characters")
+	}
+	seen := make(map[byte]bool, len(alphabet))
+	for i := 0; i < len(alphabet); i++ {
+		c := alphabet[i]
+		if c >= 0x80 {
+			return errors.New("alphabet must consist of ASCII characters")
+		}
+		if seen[c] {
+			return fmt.Errorf("alphabet has repeated character %q", c)
+		}
+		seen[c] = true
+	}
+	return nil
+}
+
+// encode writes number n in positional system with digits of alphabet.
+// Result is padded with the first character of alphabet up to minLength.
+func encode(n *big.Int, alphabet string, minLength int) string {
+	base := big.NewInt(int64(len(alphabet)))
+	n = new(big.Int).Set(n)
+	digit := new(big.Int)
+
+	result := make([]byte, 0, minLength)
+	for n.Sign() > 0 {
+		n.DivMod(n, base, digit)
+		result = append(result, alphabet[digit.Int64()])
+	}
+	for len(result) < minLength {
+		result = append(result, alphabet[0])
+	}
+
+	return string(result)
+}
+
 // GenerateRandomString returns string of random characters of passed length.
 func GenerateRandomString(length int) string {
 	result := strings.Builder{}
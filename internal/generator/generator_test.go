@@ -0,0 +1,75 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		alphabet string
+		length   int
+		wantErr  bool
+	}{
+		{name: "random", strategy: StrategyRandom, alphabet: Base62, length: 15},
+		{name: "counter", strategy: StrategyCounter, alphabet: Base62, length: 8},
+		{name: "hash", strategy: StrategyHash, alphabet: Base62, length: 10},
+		{name: "unknown strategy", strategy: "uuid", alphabet: Base62, length: 15, wantErr: true},
+		{name: "short alphabet", strategy: StrategyRandom, alphabet: "a", length: 15, wantErr: true},
+		{name: "repeated character", strategy: StrategyRandom, alphabet: "abca", length: 15, wantErr: true},
+		{name: "zero length", strategy: StrategyRandom, alphabet: Base62, length: 0, wantErr: true},
+		{name: "hash too long", strategy: StrategyHash, alphabet: Base62, length: 50, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen, err := New(tt.strategy, tt.alphabet, tt.length)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			short := gen.Generate("http://site.ru", 0)
+			assert.GreaterOrEqual(t, len(short), tt.length)
+			for _, c := range short {
+				assert.True(t, strings.ContainsRune(tt.alphabet, c))
+			}
+		})
+	}
+}
+
+func TestRandomGenerator(t *testing.T) {
+	gen := NewRandomGenerator("ab", 64)
+
+	short := gen.Generate("", 0)
+	assert.Len(t, short, 64)
+	assert.NotEqual(t, short, gen.Generate("", 0))
+}
+
+func TestCounterGenerator(t *testing.T) {
+	gen := NewCounterGenerator(Base62, 6)
+
+	const count = 10000
+	seen := make(map[string]bool, count)
+	for i := 0; i < count; i++ {
+		short := gen.Generate("http://site.ru", 0)
+		require.False(t, seen[short], "shortening %s is repeated", short)
+		seen[short] = true
+	}
+}
+
+func TestHashGenerator(t *testing.T) {
+	gen, err := NewHashGenerator(Base62, 12)
+	require.NoError(t, err)
+
+	short := gen.Generate("http://site.ru", 0)
+	assert.Len(t, short, 12)
+	assert.Equal(t, short, gen.Generate("http://site.ru", 0))
+	assert.NotEqual(t, short, gen.Generate("http://site.ru", 1))
+	assert.NotEqual(t, short, gen.Generate("http://site.ru/1", 0))
+}
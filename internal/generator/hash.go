@@ -0,0 +1,39 @@
+package generator
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// A HashGenerator makes shortenings of hash of long URL,
+// so the same URL always gets the same shortening.
+type HashGenerator struct {
+	alphabet string
+	length   int
+}
+
+// NewHashGenerator returns generator of shortenings of hash of URL.
+// It returns error if hash is too short for shortening of passed length.
+func NewHashGenerator(alphabet string, length int) (*HashGenerator, error) {
+	maxLength := int(sha256.Size * 8 / math.Log2(float64(len(alphabet))))
+	if length > maxLength {
+		return nil, fmt.Errorf("length of hash shortening must not exceed %d for alphabet of %d characters", maxLength, len(alphabet))
+	}
+	return &HashGenerator{alphabet: alphabet, length: length}, nil
+}
+
+// Generate returns shortening of hash of URL.
+// Attempt is mixed into hash to get another shortening after collision.
+func (g *HashGenerator) Generate(originalURL string, attempt int) string {
+	data := []byte(originalURL)
+	if attempt > 0 {
+		data = append(data, 0)
+		data = strconv.AppendInt(data, int64(attempt), 10)
+	}
+	sum := sha256.Sum256(data)
+
+	return encode(new(big.Int).SetBytes(sum[:]), g.alphabet, g.length)[:g.length]
+}
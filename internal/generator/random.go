@@ -0,0 +1,32 @@
+package generator
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strings"
+)
+
+// A RandomGenerator makes shortenings of random characters of alphabet.
+type RandomGenerator struct {
+	alphabet string
+	length   int
+}
+
+// NewRandomGenerator returns generator of random shortenings of passed length.
+func NewRandomGenerator(alphabet string, length int) *RandomGenerator {
+	return &RandomGenerator{alphabet: alphabet, length: length}
+}
+
+// Generate returns new random shortening, URL and attempt are not used.
+func (g *RandomGenerator) Generate(_ string, _ int) string {
+	max := big.NewInt(int64(len(g.alphabet)))
+
+	result := strings.Builder{}
+	result.Grow(g.length)
+	for i := 0; i < g.length; i++ {
+		n, _ := rand.Int(rand.Reader, max)
+		result.WriteByte(g.alphabet[n.Int64()])
+	}
+
+	return result.String()
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/Alena-Kurushkina/shortener/internal/authenticator"
+	"github.com/Alena-Kurushkina/shortener/internal/sherr"
+)
+
+// A storedAccount is account with hash of its password.
+type storedAccount struct {
+	authenticator.Account
+	hash string
+}
+
+// An accountIndex keeps accounts of memory and file storages by usernames.
+type accountIndex struct {
+	accounts map[string]storedAccount
+	// usernames maps user id to username of user's account
+	usernames map[uuid.UUID]string
+}
+
+// newAccountIndex returns empty index.
+func newAccountIndex() *accountIndex {
+	return &accountIndex{
+		accounts:  make(map[string]storedAccount),
+		usernames: make(map[uuid.UUID]string),
+	}
+}
+
+// insert adds account to index. It returns ErrUsernameTaken if username or user id has account already.
+func (idx *accountIndex) insert(account authenticator.Account, hash string) error {
+	if _, ok := idx.accounts[account.Username]; ok {
+		return sherr.ErrUsernameTaken
+	}
+	if _, ok := idx.usernames[account.UserID]; ok {
+		return sherr.ErrUsernameTaken
+	}
+	idx.accounts[account.Username] = storedAccount{Account: account, hash: hash}
+	idx.usernames[account.UserID] = account.Username
+	return nil
+}
+
+// remove deletes account from index.
+func (idx *accountIndex) remove(account authenticator.Account) {
+	delete(idx.accounts, account.Username)
+	delete(idx.usernames, account.UserID)
+}
+
+// find returns account with hash of its password by username or ErrNotFound.
+func (idx *accountIndex) find(username string) (authenticator.Account, string, error) {
+	v, ok := idx.accounts[username]
+	if !ok {
+		return authenticator.Account{}, "", sherr.ErrNotFound
+	}
+	return v.Account, v.hash, nil
+}
+
+// user returns account of user or ErrNotFound.
+func (idx *accountIndex) user(userID uuid.UUID) (authenticator.Account, error) {
+	username, ok := idx.usernames[userID]
+	if !ok {
+		return authenticator.Account{}, sherr.ErrNotFound
+	}
+	return idx.accounts[username].Account, nil
+}
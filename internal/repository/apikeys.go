@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"sort"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/Alena-Kurushkina/shortener/internal/authenticator"
+	"github.com/Alena-Kurushkina/shortener/internal/sherr"
+)
+
+// An apiKeyIndex keeps active API keys of memory and file storages by hashes of their secrets.
+// Revoked keys are removed from index.
+type apiKeyIndex map[string]authenticator.APIKey
+
+// copyAPIKey returns key which doesn't share scopes with stored one.
+func copyAPIKey(key authenticator.APIKey) authenticator.APIKey {
+	key.Scopes = append([]string(nil), key.Scopes...)
+	return key
+}
+
+// insert adds key to index.
+func (idx apiKeyIndex) insert(key authenticator.APIKey, hash string) {
+	idx[hash] = copyAPIKey(key)
+}
+
+// find returns key by hash of its secret or ErrNotFound.
+func (idx apiKeyIndex) find(hash string) (authenticator.APIKey, error) {
+	key, ok := idx[hash]
+	if !ok {
+		return authenticator.APIKey{}, sherr.ErrNotFound
+	}
+	return copyAPIKey(key), nil
+}
+
+// user returns keys of user ordered by time of issuance.
+func (idx apiKeyIndex) user(userID uuid.UUID) []authenticator.APIKey {
+	keys := make([]authenticator.APIKey, 0)
+	for _, v := range idx {
+		if uuid.Equal(v.UserID, userID) {
+			keys = append(keys, copyAPIKey(v))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].ID < keys[j].ID
+		}
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys
+}
+
+// revoke removes user's key by its id. It returns removed key with its hash or ErrNotFound.
+func (idx apiKeyIndex) revoke(userID uuid.UUID, id string) (string, authenticator.APIKey, error) {
+	for hash, v := range idx {
+		if v.ID == id && uuid.Equal(v.UserID, userID) {
+			delete(idx, hash)
+			return hash, v, nil
+		}
+	}
+	return "", authenticator.APIKey{}, sherr.ErrNotFound
+}
+
+// merge reassigns keys of user from to user to. It reports whether any key was reassigned.
+func (idx apiKeyIndex) merge(from, to uuid.UUID) bool {
+	merged := false
+	for hash, v := range idx {
+		if uuid.Equal(v.UserID, from) {
+			v.UserID = to
+			idx[hash] = v
+			merged = true
+		}
+	}
+	return merged
+}
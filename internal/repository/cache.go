@@ -0,0 +1,262 @@
+package repository
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"expvar"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/Alena-Kurushkina/shortener/internal/api"
+	"github.com/Alena-Kurushkina/shortener/internal/authenticator"
+	"github.com/Alena-Kurushkina/shortener/internal/logger"
+	"github.com/Alena-Kurushkina/shortener/internal/sherr"
+)
+
+// A cacheEntry keeps result of Select of one shortening.
+type cacheEntry struct {
+	key       string
+	redirect  api.Redirect
+	err       error
+	expiresAt time.Time
+}
+
+// A CachedRepository is read-through LRU cache of Select results in front of shortenings of data storage.
+// Results of missing and deleted shortenings are cached as well.
+// Other methods are passed to data storage and invalidate affected shortenings.
+type CachedRepository struct {
+	api.LinkStore
+
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+	// generation is changed by every invalidation, so that result of Select
+	// which raced with modification of data storage is not cached
+	generation uint64
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// cacheVars exposes counters of cache created by NewRepository, they are served by expvar handler.
+var cacheVars = expvar.NewMap("cache")
+
+// NewCachedRepository wraps shortenings of data storage with cache of passed size and time to live of entries.
+func NewCachedRepository(links api.LinkStore, size int, ttl time.Duration) *CachedRepository {
+	return &CachedRepository{
+		LinkStore: links,
+		size:      size,
+		ttl:       ttl,
+		order:     list.New(),
+		entries:   make(map[string]*list.Element, size),
+	}
+}
+
+// Hits returns number of Select calls served from cache.
+func (c *CachedRepository) Hits() int64 {
+	return c.hits.Load()
+}
+
+// Misses returns number of Select calls passed to data storage.
+func (c *CachedRepository) Misses() int64 {
+	return c.misses.Load()
+}
+
+// publish makes Hits and Misses of cache available as cache.hits and cache.misses expvar variables.
+// Cache published later replaces the previous one.
+func (c *CachedRepository) publish() {
+	cacheVars.Set("hits", expvar.Func(func() any { return c.Hits() }))
+	cacheVars.Set("misses", expvar.Func(func() any { return c.Misses() }))
+}
+
+// lookup returns fresh cache entry of shortening and marks it as recently used.
+func (c *CachedRepository) lookup(key string) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+
+	return entry, true
+}
+
+// currentGeneration returns generation of cache content.
+func (c *CachedRepository) currentGeneration() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.generation
+}
+
+// store puts entry to cache if there were no invalidations since generation
+// and evicts least recently used entries above size.
+func (c *CachedRepository) store(entry *cacheEntry, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	if elem, ok := c.entries[entry.key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[entry.key] = c.order.PushFront(entry)
+
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// invalidate removes shortenings from cache.
+func (c *CachedRepository) invalidate(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	for _, key := range keys {
+		if elem, ok := c.entries[key]; ok {
+			c.order.Remove(elem)
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Select returns redirect of shortening from cache or from data storage.
+// Only found, missing, deleted and expired results are cached, other errors are not.
+// Found shortening which expires stays in cache not longer than until its expiration time,
+// so that the next Select gets ErrLinkExpired from data storage.
+func (c *CachedRepository) Select(ctx context.Context, key string) (api.Redirect, error) {
+	if entry, ok := c.lookup(key); ok {
+		c.hits.Add(1)
+		return entry.redirect, entry.err
+	}
+	c.misses.Add(1)
+
+	generation := c.currentGeneration()
+	redirect, err := c.LinkStore.Select(ctx, key)
+	if err == nil || errors.Is(err, sherr.ErrNotFound) || errors.Is(err, sherr.ErrDBRecordDeleted) || errors.Is(err, sherr.ErrLinkExpired) {
+		deadline := time.Now().Add(c.ttl)
+		if redirect.ExpiresAt != nil && redirect.ExpiresAt.Before(deadline) {
+			deadline = *redirect.ExpiresAt
+		}
+		c.store(&cacheEntry{key: key, redirect: redirect, err: err, expiresAt: deadline}, generation)
+	}
+
+	return redirect, err
+}
+
+// Insert saves shortening to data storage and drops cached result of it.
+func (c *CachedRepository) Insert(ctx context.Context, userID uuid.UUID, key, value string, opts api.LinkOptions) error {
+	defer c.invalidate(key)
+
+	return c.LinkStore.Insert(ctx, userID, key, value, opts)
+}
+
+// InsertBatch saves shortenings to data storage and drops cached results of them.
+func (c *CachedRepository) InsertBatch(ctx context.Context, userID uuid.UUID, batch []api.BatchElement) error {
+	keys := make([]string, 0, len(batch))
+	for _, v := range batch {
+		keys = append(keys, v.ShortURL)
+	}
+	defer c.invalidate(keys...)
+
+	return c.LinkStore.InsertBatch(ctx, userID, batch)
+}
+
+// DeleteRecords deletes records in data storage and drops cached results of them.
+func (c *CachedRepository) DeleteRecords(ctx context.Context, deleteItems []api.DeleteItem) ([]api.DeleteItem, error) {
+	keys := make([]string, 0, len(deleteItems))
+	for _, v := range deleteItems {
+		keys = append(keys, v.IDs...)
+	}
+	defer c.invalidate(keys...)
+
+	return c.LinkStore.DeleteRecords(ctx, deleteItems)
+}
+
+// UpdateOriginalURL changes original URL in data storage and drops cached result of shortening.
+func (c *CachedRepository) UpdateOriginalURL(ctx context.Context, userID uuid.UUID, key, originalURL string) error {
+	defer c.invalidate(key)
+
+	return c.LinkStore.UpdateOriginalURL(ctx, userID, key, originalURL)
+}
+
+// DeleteExpired deletes expired records in data storage and drops cached results of them.
+func (c *CachedRepository) DeleteExpired(ctx context.Context, now time.Time) ([]string, error) {
+	expired, err := c.LinkStore.DeleteExpired(ctx, now)
+	c.invalidate(expired...)
+
+	return expired, err
+}
+
+// RestoreRecords restores records in data storage and drops cached results of them.
+func (c *CachedRepository) RestoreRecords(ctx context.Context, restoreItems []api.DeleteItem) ([]api.DeleteItem, error) {
+	keys := make([]string, 0, len(restoreItems))
+	for _, v := range restoreItems {
+		keys = append(keys, v.IDs...)
+	}
+	defer c.invalidate(keys...)
+
+	return c.LinkStore.RestoreRecords(ctx, restoreItems)
+}
+
+// PurgeDeleted removes deleted records from data storage and drops cached results of them.
+func (c *CachedRepository) PurgeDeleted(ctx context.Context, before time.Time) ([]string, error) {
+	purged, err := c.LinkStore.PurgeDeleted(ctx, before)
+	c.invalidate(purged...)
+
+	return purged, err
+}
+
+// A cachedStorage is data storage which shortenings are served by cache,
+// other stores are data storage itself.
+type cachedStorage struct {
+	*CachedRepository
+	api.HistoryStore
+	api.JobStore
+	api.StatsStore
+	api.APIKeyStore
+	api.SessionStore
+	authenticator.AccountStore
+	api.Conn
+}
+
+// withCache wraps shortenings of data storage with cache of passed size and time to live of entries.
+func withCache(repo api.Storager, size int, ttl time.Duration) *cachedStorage {
+	return &cachedStorage{
+		CachedRepository: NewCachedRepository(repo, size, ttl),
+		HistoryStore:     repo,
+		JobStore:         repo,
+		StatsStore:       repo,
+		APIKeyStore:      repo,
+		SessionStore:     repo,
+		AccountStore:     repo,
+		Conn:             repo,
+	}
+}
+
+// Close logs cache statistics and closes data storage.
+func (s *cachedStorage) Close() {
+	logger.Log.Infof("Cache hits: %d, misses: %d", s.Hits(), s.Misses())
+	s.Conn.Close()
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Alena-Kurushkina/shortener/internal/api"
+	"github.com/Alena-Kurushkina/shortener/internal/repository/storagetest"
+	"github.com/Alena-Kurushkina/shortener/internal/sherr"
+)
+
+func TestCachedRepositoryConformance(t *testing.T) {
+	storagetest.Run(t, func() api.Storager {
+		repo, err := newMemoryRepository()
+		require.NoError(t, err)
+		return withCache(repo, 100, time.Minute)
+	})
+}
+
+func TestCachedRepository(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("found, missing and deleted results are cached", func(t *testing.T) {
+		m := api.NewMockLinkStore(gomock.NewController(t))
+		m.EXPECT().Select(gomock.Any(), "found").Return(api.Redirect{OriginalURL: "http://site.ru"}, nil).Times(1)
+		m.EXPECT().Select(gomock.Any(), "missing").Return(api.Redirect{}, sherr.ErrNotFound).Times(1)
+		m.EXPECT().Select(gomock.Any(), "deleted").Return(api.Redirect{}, sherr.ErrDBRecordDeleted).Times(1)
+
+		c := NewCachedRepository(m, 10, time.Minute)
+		for i := 0; i < 3; i++ {
+			longURL, err := c.Select(ctx, "found")
+			require.NoError(t, err)
+			assert.Equal(t, "http://site.ru", longURL.OriginalURL)
+
+			_, err = c.Select(ctx, "missing")
+			assert.ErrorIs(t, err, sherr.ErrNotFound)
+
+			_, err = c.Select(ctx, "deleted")
+			assert.ErrorIs(t, err, sherr.ErrDBRecordDeleted)
+		}
+		assert.Equal(t, int64(6), c.Hits())
+		assert.Equal(t, int64(3), c.Misses())
+
+		c.publish()
+		assert.JSONEq(t, `{"hits": 6, "misses": 3}`, expvar.Get("cache").String())
+	})
+
+	t.Run("other errors are not cached", func(t *testing.T) {
+		m := api.NewMockLinkStore(gomock.NewController(t))
+		m.EXPECT().Select(gomock.Any(), "key").Return(api.Redirect{}, errors.New("connection lost")).Times(2)
+
+		c := NewCachedRepository(m, 10, time.Minute)
+		for i := 0; i < 2; i++ {
+			_, err := c.Select(ctx, "key")
+			assert.Error(t, err)
+		}
+	})
+
+	t.Run("modifications invalidate entries", func(t *testing.T) {
+		user := uuid.NewV4()
+		m := api.NewMockLinkStore(gomock.NewController(t))
+		gomock.InOrder(
+			m.EXPECT().Select(gomock.Any(), "key").Return(api.Redirect{}, sherr.ErrNotFound),
+			m.EXPECT().Insert(gomock.Any(), user, "key", "http://site.ru", api.LinkOptions{}).Return(nil),
+			m.EXPECT().Select(gomock.Any(), "key").Return(api.Redirect{OriginalURL: "http://site.ru"}, nil),
+			m.EXPECT().DeleteRecords(gomock.Any(), gomock.Any()).Return(nil, nil),
+			m.EXPECT().Select(gomock.Any(), "key").Return(api.Redirect{}, sherr.ErrDBRecordDeleted),
+		)
+
+		c := NewCachedRepository(m, 10, time.Minute)
+
+		_, err := c.Select(ctx, "key")
+		assert.ErrorIs(t, err, sherr.ErrNotFound)
+
+		require.NoError(t, c.Insert(ctx, user, "key", "http://site.ru", api.LinkOptions{}))
+		longURL, err := c.Select(ctx, "key")
+		require.NoError(t, err)
+		assert.Equal(t, "http://site.ru", longURL.OriginalURL)
+
+		_, err = c.DeleteRecords(ctx, []api.DeleteItem{{UserID: user, IDs: []string{"key"}}})
+		require.NoError(t, err)
+		_, err = c.Select(ctx, "key")
+		assert.ErrorIs(t, err, sherr.ErrDBRecordDeleted)
+	})
+
+	t.Run("least recently used entry is evicted", func(t *testing.T) {
+		m := api.NewMockLinkStore(gomock.NewController(t))
+		m.EXPECT().Select(gomock.Any(), "a").Return(api.Redirect{OriginalURL: "http://a.ru"}, nil).Times(2)
+		m.EXPECT().Select(gomock.Any(), "b").Return(api.Redirect{OriginalURL: "http://b.ru"}, nil).Times(1)
+		m.EXPECT().Select(gomock.Any(), "c").Return(api.Redirect{OriginalURL: "http://c.ru"}, nil).Times(1)
+
+		c := NewCachedRepository(m, 2, time.Minute)
+		for _, key := range []string{"a", "b", "b", "c", "b", "a"} {
+			_, err := c.Select(ctx, key)
+			require.NoError(t, err)
+		}
+	})
+
+	t.Run("expired entry is reloaded", func(t *testing.T) {
+		m := api.NewMockLinkStore(gomock.NewController(t))
+		m.EXPECT().Select(gomock.Any(), "key").Return(api.Redirect{OriginalURL: "http://site.ru"}, nil).Times(2)
+
+		c := NewCachedRepository(m, 10, time.Millisecond)
+		_, err := c.Select(ctx, "key")
+		require.NoError(t, err)
+
+		time.Sleep(5 * time.Millisecond)
+
+		_, err = c.Select(ctx, "key")
+		require.NoError(t, err)
+	})
+
+	t.Run("entry of shortening is dropped when shortening expires", func(t *testing.T) {
+		expiresAt := time.Now().Add(5 * time.Millisecond)
+		m := api.NewMockLinkStore(gomock.NewController(t))
+		gomock.InOrder(
+			m.EXPECT().Select(gomock.Any(), "key").Return(api.Redirect{OriginalURL: "http://site.ru", ExpiresAt: &expiresAt}, nil),
+			m.EXPECT().Select(gomock.Any(), "key").Return(api.Redirect{}, sherr.ErrLinkExpired),
+		)
+
+		c := NewCachedRepository(m, 10, time.Minute)
+		_, err := c.Select(ctx, "key")
+		require.NoError(t, err)
+
+		time.Sleep(10 * time.Millisecond)
+
+		_, err = c.Select(ctx, "key")
+		assert.ErrorIs(t, err, sherr.ErrLinkExpired)
+	})
+}
@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/Alena-Kurushkina/shortener/internal/logger"
+)
+
+// snapshotPath returns path to snapshot file of storage file.
+func snapshotPath(filename string) string {
+	return filename + ".snapshot"
+}
+
+// loadSnapshot reads records from snapshot file if it exists.
+// Snapshot keeps the latest state of every record including deleted ones.
+// Lines are read without length limit, so that records with long history are loaded.
+func (r *FileRepository) loadSnapshot() (err error) {
+	file, err := os.Open(snapshotPath(r.filename))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if tErr := file.Close(); tErr != nil {
+			err = tErr
+		}
+	}()
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		if len(line) != 0 {
+			rec := record{}
+			if jErr := json.Unmarshal(line, &rec); jErr != nil {
+				return fmt.Errorf("snapshot file is corrupted: %w", jErr)
+			}
+			r.put(rec)
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+	}
+}
+
+// compactPeriodically checks log size with passed interval and compacts it
+// when number of records in log reaches threshold.
+func (r *FileRepository) compactPeriodically(interval time.Duration) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.mu.RLock()
+			due := r.logRecords >= r.compactThreshold
+			r.mu.RUnlock()
+			if !due {
+				continue
+			}
+			if err := r.compact(); err != nil {
+				logger.Log.Errorf("Can't compact storage file: %s", err.Error())
+			}
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// compact writes snapshot of all records and starts new log of records appended meanwhile.
+// Records are copied with mutex read-locked and written to snapshot without lock,
+// so that storage isn't blocked by compaction; mutex is locked only to replace log.
+// Both files are replaced by atomic rename, so crash at any moment leaves
+// either old snapshot with full log or new snapshot with log which is safe to replay over it.
+// It must be called only by one goroutine at a time.
+func (r *FileRepository) compact() error {
+	r.mu.RLock()
+	records := r.snapshotRecords()
+	logRecords, logSize := r.logRecords, r.logSize
+	r.mu.RUnlock()
+
+	snapshot := snapshotPath(r.filename)
+	if err := writeSnapshot(snapshot+".tmp", records); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// records appended after copying are not in snapshot, so they are moved to new log
+	tail := make([]byte, r.logSize-logSize)
+	if _, err := r.file.ReadAt(tail, logSize); err != nil {
+		return err
+	}
+
+	logTmp := r.filename + ".tmp"
+	file, err := os.OpenFile(logTmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	if err = writeLogTail(file, tail); err != nil {
+		file.Close()
+		return err
+	}
+	if err = os.Rename(snapshot+".tmp", snapshot); err != nil {
+		file.Close()
+		return err
+	}
+	if err = os.Rename(logTmp, r.filename); err != nil {
+		file.Close()
+		return err
+	}
+	if err = syncDir(r.filename); err != nil {
+		logger.Log.Errorf("Can't sync storage directory: %s", err.Error())
+	}
+
+	if err = r.file.Close(); err != nil {
+		logger.Log.Errorf("Can't close storage file: %s", err.Error())
+	}
+	r.file = file
+	r.dirty = false
+
+	logger.Log.Infof("Storage file compacted, %d log records replaced by snapshot of %d records", logRecords, len(records))
+	r.logRecords -= logRecords
+	r.logSize = int64(len(tail))
+
+	return nil
+}
+
+// writeLogTail writes records appended during compaction to new log and syncs it to disk.
+func writeLogTail(file *os.File, tail []byte) error {
+	if _, err := file.Write(tail); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// snapshotRecords returns copies of all records.
+// It must be called with mutex locked or read-locked.
+func (r *FileRepository) snapshotRecords() []record {
+	records := make([]record, 0, len(r.db))
+	for userID, keys := range r.users {
+		for _, key := range keys {
+			rec, ok := r.db[key]
+			if !ok || !uuid.Equal(rec.UUID, userID) {
+				continue
+			}
+			records = append(records, *rec)
+		}
+	}
+	return records
+}
+
+// writeSnapshot writes records to file and syncs it to disk.
+func writeSnapshot(path string, records []record) (err error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if tErr := file.Close(); tErr != nil && err == nil {
+			err = tErr
+		}
+	}()
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, rec := range records {
+		if err = encoder.Encode(rec); err != nil {
+			return err
+		}
+	}
+	if err = writer.Flush(); err != nil {
+		return err
+	}
+
+	return file.Sync()
+}
+
+// syncDir flushes directory entry changes of file to disk.
+func syncDir(filename string) error {
+	dir, err := os.Open(filepath.Dir(filename))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	return dir.Sync()
+}
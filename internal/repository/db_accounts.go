@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/Alena-Kurushkina/shortener/internal/authenticator"
+	"github.com/Alena-Kurushkina/shortener/internal/sherr"
+)
+
+// InsertAccount saves account with hash of its password.
+// It returns ErrUsernameTaken if username or user id has account already.
+func (r DBRepository) InsertAccount(ctx context.Context, account authenticator.Account, passwordHash string) error {
+	res, err := r.database.ExecContext(ctx, `
+		INSERT INTO users (userUUID, username, password_hash, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING`,
+		account.UserID, account.Username, passwordHash, account.CreatedAt.UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sherr.ErrUsernameTaken
+	}
+	return nil
+}
+
+// scanAccount reads account with hash of its password from row of users.
+func scanAccount(row *sql.Row) (authenticator.Account, string, error) {
+	var (
+		account authenticator.Account
+		hash    string
+	)
+	err := row.Scan(&account.UserID, &account.Username, &hash, &account.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return authenticator.Account{}, "", sherr.ErrNotFound
+	}
+	if err != nil {
+		return authenticator.Account{}, "", err
+	}
+	account.CreatedAt = account.CreatedAt.UTC()
+	return account, hash, nil
+}
+
+// SelectAccount returns account with hash of its password by username or ErrNotFound.
+func (r DBRepository) SelectAccount(ctx context.Context, username string) (authenticator.Account, string, error) {
+	return scanAccount(r.database.QueryRowContext(ctx, `
+		SELECT userUUID, username, password_hash, created_at FROM users WHERE username = $1`,
+		username,
+	))
+}
+
+// SelectUserAccount returns account of user or ErrNotFound if user is anonymous.
+func (r DBRepository) SelectUserAccount(ctx context.Context, userID uuid.UUID) (authenticator.Account, error) {
+	account, _, err := scanAccount(r.database.QueryRowContext(ctx, `
+		SELECT userUUID, username, password_hash, created_at FROM users WHERE userUUID = $1`,
+		userID,
+	))
+	return account, err
+}
+
+// MergeUsers reassigns shortenings and API keys of user from to user to and revokes sessions of user from
+// in one transaction.
+// It returns number of reassigned shortenings.
+func (r DBRepository) MergeUsers(ctx context.Context, from, to uuid.UUID) (int, error) {
+	tx, err := r.database.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE shortening SET userUUID = $1 WHERE userUUID = $2`, to, from)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if _, err = tx.ExecContext(ctx, `UPDATE api_keys SET userUUID = $1 WHERE userUUID = $2`, to, from); err != nil {
+		return 0, err
+	}
+	if _, err = tx.ExecContext(ctx, `UPDATE sessions SET revoked_at = $1 WHERE userUUID = $2 AND revoked_at IS NULL`, time.Now().UTC(), from); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/Alena-Kurushkina/shortener/internal/authenticator"
+	"github.com/Alena-Kurushkina/shortener/internal/sherr"
+)
+
+// InsertAPIKey saves API key with hash of its secret.
+// Scopes are kept as JSON array, so that table has the same schema in every dialect.
+func (r DBRepository) InsertAPIKey(ctx context.Context, key authenticator.APIKey, hash string) error {
+	scopes, err := json.Marshal(key.Scopes)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.database.ExecContext(ctx, `
+		INSERT INTO api_keys (id, userUUID, key_hash, name, scopes, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		key.ID, key.UserID, hash, key.Name, string(scopes), key.CreatedAt.UTC(),
+	)
+	return err
+}
+
+// scanAPIKey reads API key from row of api_keys.
+func scanAPIKey(row interface{ Scan(dest ...any) error }) (authenticator.APIKey, error) {
+	var (
+		key    authenticator.APIKey
+		scopes string
+	)
+	if err := row.Scan(&key.ID, &key.UserID, &key.Name, &scopes, &key.CreatedAt); err != nil {
+		return authenticator.APIKey{}, err
+	}
+	if err := json.Unmarshal([]byte(scopes), &key.Scopes); err != nil {
+		return authenticator.APIKey{}, err
+	}
+	key.CreatedAt = key.CreatedAt.UTC()
+	return key, nil
+}
+
+// SelectAPIKey returns active API key by hash of its secret.
+// It returns ErrNotFound if key is unknown or revoked.
+func (r DBRepository) SelectAPIKey(ctx context.Context, hash string) (authenticator.APIKey, error) {
+	row := r.database.QueryRowContext(ctx, `
+		SELECT id, userUUID, name, scopes, created_at
+		FROM api_keys
+		WHERE key_hash = $1 AND revoked_at IS NULL`,
+		hash,
+	)
+	key, err := scanAPIKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return authenticator.APIKey{}, sherr.ErrNotFound
+	}
+	return key, err
+}
+
+// SelectUserAPIKeys returns user's active API keys ordered by time of issuance.
+func (r DBRepository) SelectUserAPIKeys(ctx context.Context, userID uuid.UUID) (keys []authenticator.APIKey, err error) {
+	rows, err := r.database.QueryContext(ctx, `
+		SELECT id, userUUID, name, scopes, created_at
+		FROM api_keys
+		WHERE userUUID = $1 AND revoked_at IS NULL
+		ORDER BY created_at, id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if tErr := rows.Close(); tErr != nil {
+			err = tErr
+		}
+	}()
+
+	keys = make([]authenticator.APIKey, 0)
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey marks user's API key as revoked by its id.
+// It returns ErrNotFound if user has no such active key.
+func (r DBRepository) RevokeAPIKey(ctx context.Context, userID uuid.UUID, id string) error {
+	res, err := r.database.ExecContext(ctx, `
+		UPDATE api_keys SET revoked_at = $1
+		WHERE id = $2 AND userUUID = $3 AND revoked_at IS NULL`,
+		time.Now().UTC(), id, userID,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sherr.ErrNotFound
+	}
+	return nil
+}
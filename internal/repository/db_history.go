@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/Alena-Kurushkina/shortener/internal/api"
+	"github.com/Alena-Kurushkina/shortener/internal/sherr"
+)
+
+// UpdateOriginalURL makes user's shortening lead to another original URL and saves change to history
+// in one transaction.
+// It returns ErrNotFound if shortening doesn't belong to user, ErrDBRecordDeleted if it was deleted
+// and AlreadyExistError if original URL already has another shortening.
+func (r DBRepository) UpdateOriginalURL(ctx context.Context, userID uuid.UUID, key, originalURL string) error {
+	tx, err := r.database.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	selectQuery := `SELECT useruuid, originalURL, COALESCE(is_deleted, false) FROM shortening WHERE shortURL = $1`
+	// SQLite write transactions are exclusive already
+	if r.dialect == dialectPostgres {
+		selectQuery += ` FOR UPDATE`
+	}
+
+	var (
+		owner   uuid.UUID
+		oldURL  string
+		deleted bool
+	)
+	err = tx.QueryRowContext(ctx, selectQuery, key).Scan(&owner, &oldURL, &deleted)
+	if errors.Is(err, sql.ErrNoRows) || err == nil && !uuid.Equal(owner, userID) {
+		return sherr.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if deleted {
+		return sherr.ErrDBRecordDeleted
+	}
+	if oldURL == originalURL {
+		return nil
+	}
+
+	var existKey string
+	err = tx.QueryRowContext(ctx, `SELECT shortURL FROM shortening WHERE originalURL = $1`, originalURL).Scan(&existKey)
+	if err == nil {
+		return sherr.NewAlreadyExistError(originalURL, existKey)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `UPDATE shortening SET originalURL = $1 WHERE shortURL = $2`, originalURL, key); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO url_history (shortURL, old_url, new_url, changed_at) VALUES ($1, $2, $3, $4)`,
+		key, oldURL, originalURL, time.Now().UTC(),
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SelectHistory returns changes of original URL of user's shortening ordered by time.
+// It returns ErrNotFound if shortening doesn't belong to user.
+func (r DBRepository) SelectHistory(ctx context.Context, userID uuid.UUID, key string) (history []api.URLEdit, err error) {
+	if err = r.checkOwner(ctx, userID, key); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.database.QueryContext(ctx, `
+		SELECT old_url, new_url, changed_at
+		FROM url_history
+		WHERE shortURL = $1
+		ORDER BY changed_at
+	`, key)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if tErr := rows.Close(); tErr != nil {
+			err = tErr
+		}
+	}()
+
+	history = make([]api.URLEdit, 0)
+	for rows.Next() {
+		var v api.URLEdit
+		if err = rows.Scan(&v.OldURL, &v.NewURL, &v.ChangedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, v)
+	}
+
+	return history, rows.Err()
+}
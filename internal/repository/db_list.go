@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/Alena-Kurushkina/shortener/internal/api"
+)
+
+// likeEscaper escapes wildcard characters of LIKE pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SelectUserPage returns page of user's shortenings ordered by creation time
+// and cursor of the next page if it exists.
+// Page is selected by position after cursor, so its cost doesn't depend on number of previous pages.
+func (r DBRepository) SelectUserPage(ctx context.Context, id uuid.UUID, query api.ListQuery) (page []api.BatchElement, next *api.ListCursor, err error) {
+	args := []any{id.String()}
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	var sqlQuery strings.Builder
+	sqlQuery.WriteString(`
+		SELECT originalURL, shortURL, expires_at, redirect_code, query_passthrough, created_at, COALESCE(is_deleted, false)
+		FROM shortening
+		WHERE useruuid = $1`)
+	if query.Search != "" {
+		sqlQuery.WriteString(` AND lower(originalURL) LIKE ` + arg("%"+likeEscaper.Replace(strings.ToLower(query.Search))+"%") + ` ESCAPE '\'`)
+	}
+	if query.Deleted != nil {
+		sqlQuery.WriteString(` AND COALESCE(is_deleted, false) = ` + arg(*query.Deleted))
+	}
+	order, compare := "ASC", ">"
+	if query.Desc {
+		order, compare = "DESC", "<"
+	}
+	if query.After != nil {
+		sqlQuery.WriteString(` AND (created_at, shortURL) ` + compare + ` (` + arg(query.After.CreatedAt.UTC()) + `, ` + arg(query.After.ShortURL) + `)`)
+	}
+	sqlQuery.WriteString(` ORDER BY created_at ` + order + `, shortURL ` + order + ` LIMIT ` + arg(query.Limit+1))
+
+	rows, err := r.database.QueryContext(ctx, sqlQuery.String(), args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if tErr := rows.Close(); tErr != nil {
+			err = tErr
+		}
+	}()
+
+	page = make([]api.BatchElement, 0, query.Limit)
+	for rows.Next() {
+		var (
+			v         api.BatchElement
+			expiresAt sql.NullTime
+			createdAt sql.NullTime
+		)
+		if err = rows.Scan(&v.OriginalURL, &v.ShortURL, &expiresAt, &v.RedirectCode, &v.Passthrough, &createdAt, &v.Deleted); err != nil {
+			return nil, nil, err
+		}
+		if expiresAt.Valid {
+			v.ExpiresAt = &expiresAt.Time
+		}
+		if createdAt.Valid {
+			v.CreatedAt = &createdAt.Time
+		}
+
+		if len(page) == query.Limit {
+			last := page[len(page)-1]
+			next = &api.ListCursor{CreatedAt: *last.CreatedAt, ShortURL: last.ShortURL}
+			break
+		}
+		page = append(page, v)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return page, next, nil
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/Alena-Kurushkina/shortener/internal/api"
+)
+
+// QueueDeletion saves deletion request to durable queue.
+// Ids of records are kept as JSON array, so that queue has the same schema in every dialect.
+func (r DBRepository) QueueDeletion(ctx context.Context, item api.DeleteItem) error {
+	ids, err := json.Marshal(item.IDs)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.database.ExecContext(ctx, `
+		INSERT INTO delete_queue (job_id, userUUID, ids, queued_at)
+		VALUES ($1, $2, $3, $4)`,
+		item.JobID, item.UserID, string(ids), time.Now().UTC(),
+	)
+	return err
+}
+
+// SelectQueuedDeletions returns deletion requests from durable queue in order of queueing.
+func (r DBRepository) SelectQueuedDeletions(ctx context.Context) (items []api.DeleteItem, err error) {
+	rows, err := r.database.QueryContext(ctx, `
+		SELECT job_id, userUUID, ids
+		FROM delete_queue
+		ORDER BY queued_at
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if tErr := rows.Close(); tErr != nil {
+			err = tErr
+		}
+	}()
+
+	items = make([]api.DeleteItem, 0)
+	for rows.Next() {
+		var item api.DeleteItem
+		var ids string
+		if err = rows.Scan(&item.JobID, &item.UserID, &ids); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal([]byte(ids), &item.IDs); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// DequeueDeletions removes processed deletion requests from durable queue.
+func (r DBRepository) DequeueDeletions(ctx context.Context, jobIDs []string) error {
+	tx, err := r.database.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = execEach(ctx, tx, `DELETE FROM delete_queue WHERE job_id = $1`, jobIDs); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -3,10 +3,11 @@ package repository
 import (
 	"context"
 	"database/sql"
-	"strconv"
-	"strings"
+	"errors"
 	"sync"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	uuid "github.com/satori/go.uuid"
 
 	"github.com/Alena-Kurushkina/shortener/internal/api"
@@ -19,6 +20,18 @@ type DBRepository struct {
 	database      *sql.DB
 	selectStmt    *sql.Stmt
 	selectAllStmt *sql.Stmt
+	dialect       string
+	// isShortConflict reports whether error is violation of unique index of shortenings
+	isShortConflict func(err error) bool
+}
+
+// uniqueViolationCode is PostgreSQL error code of unique constraint violation.
+const uniqueViolationCode = "23505"
+
+// isPgShortConflict reports whether PostgreSQL error is violation of unique index of shortenings.
+func isPgShortConflict(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode && pgErr.ConstraintName == "short_idx"
 }
 
 // GetDB creates DBRepository object in first call, then returns it with no recreation.
@@ -26,72 +39,70 @@ var GetDB func() (api.Storager, error)
 
 // newDBRepository initializes data storage in database.
 func newDBRepository(ctx context.Context, connectionStr string) (dbRep api.Storager, err error) {
-
 	dbInit := func() (api.Storager, error) {
-		dbRep := &DBRepository{}
+		return openDBRepository(ctx, connectionStr)
+	}
 
-		db, err := sql.Open("pgx", connectionStr)
-		if err != nil {
-			return nil, err
-		}
-		logger.Log.Info("DB connection opened")
+	GetDB = sync.OnceValues(dbInit)
 
-		tx, err := db.BeginTx(ctx, nil)
-		if err != nil {
-			return nil, err
-		}
-		defer tx.Rollback()
-
-		tx.ExecContext(ctx, `
-			CREATE TABLE IF NOT EXISTS shortening(
-				id varchar(50) PRIMARY KEY default substring(md5(random()::text),0,20),
-				originalURL varchar(500) NOT NULL,
-				shortURL varchar(250) NOT NULL,
-				userUUID uuid,
-				is_deleted bool DEFAULT(false),
-				UNIQUE (originalURL)
-			);
-			CREATE UNIQUE INDEX IF NOT EXISTS short_idx on shortening (shortURL);
-		`)
-
-		err = tx.Commit()
-		if err != nil {
-			return nil, err
-		}
+	return GetDB()
+}
 
-		getDeletedFieldQuery, err := db.PrepareContext(ctx, `
-			SELECT originalURL, is_deleted 
-			FROM shortening 
-			WHERE shortURL LIKE $1
-		`)
-		if err != nil {
-			return nil, err
-		}
+// openDBRepository connects to PostgreSQL database, migrates schema and prepares statements.
+func openDBRepository(ctx context.Context, connectionStr string) (*DBRepository, error) {
+	db, err := sql.Open("pgx", connectionStr)
+	if err != nil {
+		return nil, err
+	}
+	logger.Log.Info("DB connection opened")
 
-		getShorteningQuery, err := db.PrepareContext(ctx, `
-			SELECT originalURL, shortURL
-			FROM shortening 
-			WHERE shortening.useruuid = $1
-		`)
-		if err != nil {
-			return nil, err
-		}
+	dbRep, err := prepareDBRepository(ctx, db, dialectPostgres)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	dbRep.isShortConflict = isPgShortConflict
 
-		dbRep.database = db
-		dbRep.selectStmt = getDeletedFieldQuery
-		dbRep.selectAllStmt = getShorteningQuery
+	return dbRep, nil
+}
+
+// prepareDBRepository migrates schema of opened database and prepares statements.
+func prepareDBRepository(ctx context.Context, db *sql.DB, dialect string) (*DBRepository, error) {
+	dbRep := &DBRepository{dialect: dialect}
 
-		return dbRep, err
+	if err := migrateUp(ctx, db, dialect); err != nil {
+		return nil, err
 	}
 
-	GetDB = sync.OnceValues(dbInit)
+	getDeletedFieldQuery, err := db.PrepareContext(ctx, `
+		SELECT originalURL, is_deleted, expires_at, redirect_code, query_passthrough
+		FROM shortening 
+		WHERE shortURL = $1
+	`)
+	if err != nil {
+		return nil, err
+	}
 
-	return GetDB()
+	getShorteningQuery, err := db.PrepareContext(ctx, `
+		SELECT originalURL, shortURL, expires_at, redirect_code, query_passthrough
+		FROM shortening 
+		WHERE shortening.useruuid = $1
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	dbRep.database = db
+	dbRep.selectStmt = getDeletedFieldQuery
+	dbRep.selectAllStmt = getShorteningQuery
+
+	return dbRep, err
 }
 
 // Insert saves short URL and original one to storage by user id.
-// It returns AlreadyExistError if short URL is already in storage.
-func (r DBRepository) Insert(ctx context.Context, userID uuid.UUID, insertedShortURL, insertedOriginalURL string) (err error) {
+// It returns AlreadyExistError if original URL is already in storage
+// and CollisionError if short URL is already used.
+func (r DBRepository) Insert(ctx context.Context, userID uuid.UUID, insertedShortURL, insertedOriginalURL string, opts api.LinkOptions) (err error) {
 	tx, err := r.database.BeginTx(ctx, nil)
 	if err != nil {
 		return err
@@ -99,14 +110,18 @@ func (r DBRepository) Insert(ctx context.Context, userID uuid.UUID, insertedShor
 	defer tx.Rollback()
 
 	sqlRow := tx.QueryRowContext(ctx,
-		`INSERT INTO shortening (userUUID, originalURL, shortURL) 
-		VALUES ($1, $2, $3) 
+		`INSERT INTO shortening (userUUID, originalURL, shortURL, expires_at, redirect_code, query_passthrough, created_at) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7) 
 		ON CONFLICT (originalurl) 
 			DO UPDATE SET originalurl = shortening.originalurl
 		RETURNING originalurl, shorturl;`,
 		userID,
 		insertedOriginalURL,
 		insertedShortURL,
+		utcTime(opts.ExpiresAt),
+		opts.RedirectCode,
+		opts.Passthrough,
+		time.Now().UTC(),
 	)
 
 	var (
@@ -114,6 +129,9 @@ func (r DBRepository) Insert(ctx context.Context, userID uuid.UUID, insertedShor
 		dbShortURL    string
 	)
 	err = sqlRow.Scan(&dbOriginalURL, &dbShortURL)
+	if r.isShortConflict(err) {
+		return sherr.NewCollisionError(insertedShortURL)
+	}
 	if err != nil {
 		return err
 	}
@@ -128,40 +146,226 @@ func (r DBRepository) Insert(ctx context.Context, userID uuid.UUID, insertedShor
 	return err
 }
 
-// DeleteRecords deletes records by their ids from storage.
-// It is getting array of DeleteItem on input.
-func (r DBRepository) DeleteRecords(ctx context.Context, deleteItems []api.DeleteItem) error {
-	param := ""
-	for _, v := range deleteItems {
-		for _, i := range v.IDs {
-			param = param + `(uuid('` + v.UserID.String() + `'), '` + i + `'),`
+// deleteChunkSize limits number of records marked as deleted or restored by one statement.
+const deleteChunkSize = 1000
+
+// A userShortening identifies record by user id and shortening.
+type userShortening struct {
+	userID uuid.UUID
+	id     string
+}
+
+// DeleteRecords marks records as deleted by their ids and user ids.
+// For every passed item it returns item with ids of records that are deleted.
+func (r DBRepository) DeleteRecords(ctx context.Context, deleteItems []api.DeleteItem) ([]api.DeleteItem, error) {
+	return r.updateUserRecords(ctx, deleteItems, `
+		UPDATE shortening
+		SET is_deleted = true, deleted_at = COALESCE(shortening.deleted_at, $3)
+		FROM unnest($1::uuid[], $2::varchar[]) AS data(id_user, shortening)
+		WHERE shortening.useruuid = data.id_user
+			AND shortening.shorturl = data.shortening
+		RETURNING shortening.useruuid, shortening.shorturl`,
+		time.Now().UTC(),
+	)
+}
+
+// RestoreRecords brings deleted records back by their ids and user ids.
+// For every passed item it returns item with ids of records that are restored.
+func (r DBRepository) RestoreRecords(ctx context.Context, restoreItems []api.DeleteItem) ([]api.DeleteItem, error) {
+	return r.updateUserRecords(ctx, restoreItems, `
+		UPDATE shortening
+		SET is_deleted = false, deleted_at = NULL
+		FROM unnest($1::uuid[], $2::varchar[]) AS data(id_user, shortening)
+		WHERE shortening.useruuid = data.id_user
+			AND shortening.shorturl = data.shortening
+			AND shortening.is_deleted
+		RETURNING shortening.useruuid, shortening.shorturl`,
+	)
+}
+
+// updateUserRecords executes update query for records identified by ids and user ids in one transaction.
+// Ids are passed to query as array parameters $1 and $2 in chunks of deleteChunkSize,
+// args are passed as following parameters. Query returns user ids and ids of updated records.
+// For every passed item it returns item with ids of records that are updated.
+func (r DBRepository) updateUserRecords(ctx context.Context, items []api.DeleteItem, query string, args ...any) ([]api.DeleteItem, error) {
+	tx, err := r.database.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	updated := make(map[userShortening]struct{})
+	users := make([]string, 0, deleteChunkSize)
+	ids := make([]string, 0, deleteChunkSize)
+
+	flush := func() error {
+		if len(ids) == 0 {
+			return nil
+		}
+		rows, err := tx.QueryContext(ctx, query, append([]any{users, ids}, args...)...)
+		if err != nil {
+			return err
 		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var v userShortening
+			if err = rows.Scan(&v.userID, &v.id); err != nil {
+				return err
+			}
+			updated[v] = struct{}{}
+		}
+
+		users, ids = users[:0], ids[:0]
+
+		return rows.Err()
 	}
-	param, _ = strings.CutSuffix(param, ",")
 
-	stmt := `UPDATE shortening
-		SET is_deleted=true
-		FROM (
-			VALUES` + param +
-		`) AS data(id_user, shortening)
-		WHERE shortening.useruuid=data.id_user
-			AND shortening.shorturl=data.shortening`
+	for _, v := range items {
+		for _, id := range v.IDs {
+			users = append(users, v.UserID.String())
+			ids = append(ids, id)
+			if len(ids) == deleteChunkSize {
+				if err = flush(); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if err = flush(); err != nil {
+		return nil, err
+	}
 
-	logger.Log.Info(stmt)
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	logger.Log.Infof("Rows affected while update: %d", len(updated))
+
+	result := make([]api.DeleteItem, 0, len(items))
+	for _, v := range items {
+		done := api.DeleteItem{UserID: v.UserID, IDs: make([]string, 0, len(v.IDs))}
+		for _, id := range v.IDs {
+			if _, ok := updated[userShortening{userID: v.UserID, id: id}]; ok {
+				done.IDs = append(done.IDs, id)
+			}
+		}
+		result = append(result, done)
+	}
 
-	sqlRes, err := r.database.ExecContext(ctx, stmt)
+	return result, nil
+}
 
+// DeleteExpired marks records which expiration time has passed by now as deleted.
+// It returns shortenings of deleted records.
+func (r DBRepository) DeleteExpired(ctx context.Context, now time.Time) ([]string, error) {
+	rows, err := r.database.QueryContext(ctx, `
+		UPDATE shortening
+		SET is_deleted = true, deleted_at = $1
+		WHERE expires_at <= $1 AND NOT is_deleted
+		RETURNING shorturl`,
+		now.UTC(),
+	)
 	if err != nil {
-		logger.Log.Errorf("Error while deletion: ", err.Error())
+		return nil, err
 	}
+	defer rows.Close()
 
-	sf, _ := sqlRes.RowsAffected()
-	logger.Log.Infof("Rows affected while deletion: %s", strconv.FormatInt(sf, 10))
+	expired := make([]string, 0)
+	for rows.Next() {
+		var key string
+		if err = rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		expired = append(expired, key)
+	}
 
-	return err
+	return expired, rows.Err()
+}
+
+// PurgeDeleted permanently removes records deleted before passed time together with their history and statistics.
+// It returns shortenings of removed records.
+func (r DBRepository) PurgeDeleted(ctx context.Context, before time.Time) ([]string, error) {
+	tx, err := r.database.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		DELETE FROM shortening
+		WHERE is_deleted AND deleted_at <= $1
+		RETURNING shorturl`,
+		before.UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	purged := make([]string, 0)
+	for rows.Next() {
+		var key string
+		if err = rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		purged = append(purged, key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for _, query := range []string{
+		`DELETE FROM click_stats WHERE shortURL = $1`,
+		`DELETE FROM click_visitors WHERE shortURL = $1`,
+		`DELETE FROM click_sources WHERE shortURL = $1`,
+		`DELETE FROM url_history WHERE shortURL = $1`,
+	} {
+		if err = execEach(ctx, tx, query, purged); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return purged, nil
+}
+
+// execEach executes prepared query for every key in transaction.
+func execEach(ctx context.Context, tx *sql.Tx, query string, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, key := range keys {
+		if _, err = stmt.ExecContext(ctx, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// utcTime converts optional time to UTC, so that times are stored and compared in one time zone.
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
 }
 
 // InsertBatch saves array of BatchElement to storage.
+// Elements which original URL is already in storage get existing shortening.
+// It returns CollisionError if shortening of some element is already used.
 func (r DBRepository) InsertBatch(ctx context.Context, userID uuid.UUID, batch []api.BatchElement) (err error) {
 	tx, err := r.database.BeginTx(ctx, nil)
 	if err != nil {
@@ -170,8 +374,8 @@ func (r DBRepository) InsertBatch(ctx context.Context, userID uuid.UUID, batch [
 	defer tx.Rollback()
 
 	stmt, err := tx.PrepareContext(ctx, `
-		INSERT INTO shortening (id, userUUID, originalURL, shortURL) 
-		VALUES ($1, $2, $3, $4) 
+		INSERT INTO shortening (id, userUUID, originalURL, shortURL, expires_at, redirect_code, query_passthrough, created_at) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) 
 		ON CONFLICT (originalurl) 
 			DO UPDATE SET originalurl = shortening.originalurl
 		RETURNING originalurl, shorturl;
@@ -180,13 +384,22 @@ func (r DBRepository) InsertBatch(ctx context.Context, userID uuid.UUID, batch [
 		return err
 	}
 
-	for _, v := range batch {
-		_, err = stmt.ExecContext(ctx,
+	now := time.Now().UTC()
+	for k, v := range batch {
+		var dbOriginalURL string
+		err = stmt.QueryRowContext(ctx,
 			v.CorrelarionID,
 			userID,
 			v.OriginalURL,
 			v.ShortURL,
-		)
+			utcTime(v.ExpiresAt),
+			v.RedirectCode,
+			v.Passthrough,
+			now,
+		).Scan(&dbOriginalURL, &batch[k].ShortURL)
+		if r.isShortConflict(err) {
+			return sherr.NewCollisionError(v.ShortURL)
+		}
 		if err != nil {
 			return err
 		}
@@ -209,25 +422,36 @@ func (r *DBRepository) Ping(ctx context.Context) error {
 	return r.database.PingContext(ctx)
 }
 
-// Select returns longURL from storage by it shortening.
-func (r DBRepository) Select(ctx context.Context, key string) (string, error) {
+// Select returns longURL and redirect options from storage by it shortening.
+// It returns ErrDBRecordDeleted if shortening was deleted and ErrLinkExpired if it is expired.
+func (r DBRepository) Select(ctx context.Context, key string) (api.Redirect, error) {
 	row := r.selectStmt.QueryRowContext(ctx,
 		key,
 	)
 	var (
-		longURL string
-		deleted bool
+		redirect  api.Redirect
+		deleted   bool
+		expiresAt sql.NullTime
 	)
 
-	err := row.Scan(&longURL, &deleted)
+	err := row.Scan(&redirect.OriginalURL, &deleted, &expiresAt, &redirect.RedirectCode, &redirect.Passthrough)
+	if errors.Is(err, sql.ErrNoRows) {
+		return api.Redirect{}, sherr.ErrNotFound
+	}
 	if err != nil {
-		return "", err
+		return api.Redirect{}, err
 	}
 	if deleted {
-		return "", sherr.ErrDBRecordDeleted
+		return api.Redirect{}, sherr.ErrDBRecordDeleted
+	}
+	if expiresAt.Valid {
+		if isExpired(&expiresAt.Time, time.Now()) {
+			return api.Redirect{}, sherr.ErrLinkExpired
+		}
+		redirect.ExpiresAt = utcTime(&expiresAt.Time)
 	}
 
-	return longURL, nil
+	return redirect, nil
 }
 
 // SelectUserAll returns all user's pairs of long URL and shortening from storage.
@@ -248,11 +472,17 @@ func (r DBRepository) SelectUserAll(ctx context.Context, id uuid.UUID) (records
 
 	// пробегаем по всем записям
 	for rows.Next() {
-		var v api.BatchElement
-		err = rows.Scan(&v.OriginalURL, &v.ShortURL)
+		var (
+			v         api.BatchElement
+			expiresAt sql.NullTime
+		)
+		err = rows.Scan(&v.OriginalURL, &v.ShortURL, &expiresAt, &v.RedirectCode, &v.Passthrough)
 		if err != nil {
 			return nil, err
 		}
+		if expiresAt.Valid {
+			v.ExpiresAt = &expiresAt.Time
+		}
 
 		records = append(records, v)
 	}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Alena-Kurushkina/shortener/internal/authenticator"
+	"github.com/Alena-Kurushkina/shortener/internal/sherr"
+)
+
+// InsertSession saves session with hash of its refresh token.
+func (r DBRepository) InsertSession(ctx context.Context, session authenticator.Session, hash string) error {
+	_, err := r.database.ExecContext(ctx, `
+		INSERT INTO sessions (id, userUUID, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)`,
+		session.ID, session.UserID, hash, session.ExpiresAt.UTC(), time.Now().UTC(),
+	)
+	return err
+}
+
+// SelectSession returns session by hash of its current refresh token.
+// It returns ErrNotFound if token is unknown or was rotated.
+func (r DBRepository) SelectSession(ctx context.Context, hash string) (authenticator.Session, error) {
+	var (
+		session   authenticator.Session
+		revokedAt sql.NullTime
+	)
+	err := r.database.QueryRowContext(ctx, `
+		SELECT id, userUUID, expires_at, revoked_at
+		FROM sessions
+		WHERE token_hash = $1`,
+		hash,
+	).Scan(&session.ID, &session.UserID, &session.ExpiresAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return authenticator.Session{}, sherr.ErrNotFound
+	}
+	if err != nil {
+		return authenticator.Session{}, err
+	}
+
+	session.ExpiresAt = session.ExpiresAt.UTC()
+	if revokedAt.Valid {
+		at := revokedAt.Time.UTC()
+		session.RevokedAt = &at
+	}
+	return session, nil
+}
+
+// RotateSession replaces refresh token of session and prolongs it.
+// Condition on old hash makes concurrent refreshes by the same token succeed only once.
+// It returns ErrNotFound if session is revoked or oldHash is not its current token.
+func (r DBRepository) RotateSession(ctx context.Context, id, oldHash, newHash string, expiresAt time.Time) error {
+	res, err := r.database.ExecContext(ctx, `
+		UPDATE sessions SET token_hash = $1, expires_at = $2
+		WHERE id = $3 AND token_hash = $4 AND revoked_at IS NULL`,
+		newHash, expiresAt.UTC(), id, oldHash,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sherr.ErrNotFound
+	}
+	return nil
+}
+
+// RevokeSession marks session as revoked. It returns ErrNotFound if session is unknown.
+// Session revoked earlier keeps its time of revocation.
+func (r DBRepository) RevokeSession(ctx context.Context, id string) error {
+	res, err := r.database.ExecContext(ctx, `
+		UPDATE sessions SET revoked_at = COALESCE(revoked_at, $1)
+		WHERE id = $2`,
+		time.Now().UTC(), id,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sherr.ErrNotFound
+	}
+	return nil
+}
+
+// SelectRevokedSessions returns ids of sessions revoked after since.
+func (r DBRepository) SelectRevokedSessions(ctx context.Context, since time.Time) (ids []string, err error) {
+	rows, err := r.database.QueryContext(ctx, `
+		SELECT id FROM sessions WHERE revoked_at > $1`,
+		since.UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if tErr := rows.Close(); tErr != nil {
+			err = tErr
+		}
+	}()
+
+	ids = make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// PurgeSessions removes sessions which expired or were revoked before time before.
+func (r DBRepository) PurgeSessions(ctx context.Context, before time.Time) error {
+	_, err := r.database.ExecContext(ctx, `
+		DELETE FROM sessions WHERE expires_at < $1 OR revoked_at < $2`,
+		before.UTC(), before.UTC(),
+	)
+	return err
+}
@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/Alena-Kurushkina/shortener/internal/api"
+	"github.com/Alena-Kurushkina/shortener/internal/sherr"
+)
+
+// checkOwner returns ErrNotFound if shortening doesn't exist or doesn't belong to user.
+func (r DBRepository) checkOwner(ctx context.Context, userID uuid.UUID, key string) error {
+	var owner uuid.UUID
+	err := r.database.QueryRowContext(ctx, `SELECT useruuid FROM shortening WHERE shortURL = $1`, key).Scan(&owner)
+	if errors.Is(err, sql.ErrNoRows) || err == nil && !uuid.Equal(owner, userID) {
+		return sherr.ErrNotFound
+	}
+	return err
+}
+
+// Kinds of click sources in click_sources table.
+const (
+	sourceReferrer  = "referrer"
+	sourceUserAgent = "user_agent"
+)
+
+// SaveClicks adds clicks to counters of shortenings in one transaction.
+// Clicks are counted before writing, so that every counter is updated once.
+func (r DBRepository) SaveClicks(ctx context.Context, clicks []api.Click) error {
+	counters := make(clickCounters)
+	counters.add(clicks)
+
+	tx, err := r.database.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	daysStmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO click_stats (shortURL, day, clicks)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (shortURL, day)
+			DO UPDATE SET clicks = click_stats.clicks + excluded.clicks
+	`)
+	if err != nil {
+		return err
+	}
+	defer daysStmt.Close()
+
+	visitorsStmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO click_visitors (shortURL, day, ip_hash)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (shortURL, day, ip_hash) DO NOTHING
+	`)
+	if err != nil {
+		return err
+	}
+	defer visitorsStmt.Close()
+
+	sourcesStmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO click_sources (shortURL, kind, value, clicks)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (shortURL, kind, value)
+			DO UPDATE SET clicks = click_sources.clicks + excluded.clicks
+	`)
+	if err != nil {
+		return err
+	}
+	defer sourcesStmt.Close()
+
+	for key, v := range counters {
+		for day, dv := range v.Days {
+			if _, err = daysStmt.ExecContext(ctx, key, day, dv.Clicks); err != nil {
+				return err
+			}
+			for hash := range dv.Visitors {
+				if _, err = visitorsStmt.ExecContext(ctx, key, day, hash); err != nil {
+					return err
+				}
+			}
+		}
+		for kind, sources := range map[string]map[string]int64{sourceReferrer: v.Referrers, sourceUserAgent: v.UserAgents} {
+			for value, n := range sources {
+				if _, err = sourcesStmt.ExecContext(ctx, key, kind, value, n); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// SelectStats returns aggregated clicks by user's shortening.
+// It returns ErrNotFound if shortening doesn't belong to user.
+func (r DBRepository) SelectStats(ctx context.Context, userID uuid.UUID, key string) (api.ClickStats, error) {
+	if err := r.checkOwner(ctx, userID, key); err != nil {
+		return api.ClickStats{}, err
+	}
+
+	days, err := r.selectDayClicks(ctx, key)
+	if err != nil {
+		return api.ClickStats{}, err
+	}
+	referrers, err := r.selectTopSources(ctx, key, sourceReferrer)
+	if err != nil {
+		return api.ClickStats{}, err
+	}
+	userAgents, err := r.selectTopSources(ctx, key, sourceUserAgent)
+	if err != nil {
+		return api.ClickStats{}, err
+	}
+
+	return api.ClickStats{Days: days, Referrers: referrers, UserAgents: userAgents}, nil
+}
+
+// selectDayClicks returns daily counters of clicks and visitors by shortening ordered by day.
+func (r DBRepository) selectDayClicks(ctx context.Context, key string) (days []api.DayClicks, err error) {
+	rows, err := r.database.QueryContext(ctx, `
+		SELECT s.day, s.clicks, (
+			SELECT count(*) FROM click_visitors v
+			WHERE v.shortURL = s.shortURL AND v.day = s.day
+		)
+		FROM click_stats s
+		WHERE s.shortURL = $1
+		ORDER BY s.day
+	`, key)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if tErr := rows.Close(); tErr != nil {
+			err = tErr
+		}
+	}()
+
+	days = make([]api.DayClicks, 0)
+	for rows.Next() {
+		var v api.DayClicks
+		if err = rows.Scan(&v.Day, &v.Clicks, &v.Visitors); err != nil {
+			return nil, err
+		}
+		v.Day = clickDay(v.Day)
+		days = append(days, v)
+	}
+
+	return days, rows.Err()
+}
+
+// selectTopSources returns api.TopSources sources of kind with the most clicks by shortening
+// ordered by clicks and value.
+func (r DBRepository) selectTopSources(ctx context.Context, key, kind string) (sources []api.SourceClicks, err error) {
+	rows, err := r.database.QueryContext(ctx, `
+		SELECT value, clicks
+		FROM click_sources
+		WHERE shortURL = $1 AND kind = $2
+		ORDER BY clicks DESC, value
+		LIMIT $3
+	`, key, kind, api.TopSources)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if tErr := rows.Close(); tErr != nil {
+			err = tErr
+		}
+	}()
+
+	sources = make([]api.SourceClicks, 0)
+	for rows.Next() {
+		var v api.SourceClicks
+		if err = rows.Scan(&v.Value, &v.Clicks); err != nil {
+			return nil, err
+		}
+		sources = append(sources, v)
+	}
+
+	return sources, rows.Err()
+}
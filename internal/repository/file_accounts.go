@@ -0,0 +1,199 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/Alena-Kurushkina/shortener/internal/authenticator"
+)
+
+// A fileAccount sets representation of account in accounts file.
+type fileAccount struct {
+	UUID      uuid.UUID `json:"uuid"`
+	Username  string    `json:"username"`
+	Hash      string    `json:"password_hash"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// accountsPath returns path to file of accounts of storage file.
+func accountsPath(filename string) string {
+	return filename + ".accounts"
+}
+
+// loadAccounts reads accounts from accounts file if it exists.
+func (r *FileRepository) loadAccounts() error {
+	data, err := os.ReadFile(accountsPath(r.filename))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var accounts []fileAccount
+	if err = json.Unmarshal(data, &accounts); err != nil {
+		return err
+	}
+	for _, v := range accounts {
+		account := authenticator.Account{UserID: v.UUID, Username: v.Username, CreatedAt: v.CreatedAt}
+		if err = r.accounts.insert(account, v.Hash); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeAccounts replaces accounts file with current accounts.
+// It must be called with accountsMu locked.
+func (r *FileRepository) writeAccounts() error {
+	accounts := make([]fileAccount, 0, len(r.accounts.accounts))
+	for _, v := range r.accounts.accounts {
+		accounts = append(accounts, fileAccount{UUID: v.UserID, Username: v.Username, Hash: v.hash, CreatedAt: v.CreatedAt})
+	}
+	data, err := json.Marshal(accounts)
+	if err != nil {
+		return err
+	}
+
+	return writeFileSynced(accountsPath(r.filename), data)
+}
+
+// InsertAccount saves account with hash of its password to accounts file.
+// It returns ErrUsernameTaken if username or user id has account already.
+func (r *FileRepository) InsertAccount(ctx context.Context, account authenticator.Account, passwordHash string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.accountsMu.Lock()
+	defer r.accountsMu.Unlock()
+
+	if err := r.accounts.insert(account, passwordHash); err != nil {
+		return err
+	}
+	if err := r.writeAccounts(); err != nil {
+		r.accounts.remove(account)
+		return err
+	}
+
+	return nil
+}
+
+// SelectAccount returns account with hash of its password by username or ErrNotFound.
+func (r *FileRepository) SelectAccount(ctx context.Context, username string) (authenticator.Account, string, error) {
+	if err := ctx.Err(); err != nil {
+		return authenticator.Account{}, "", err
+	}
+
+	r.accountsMu.RLock()
+	defer r.accountsMu.RUnlock()
+
+	return r.accounts.find(username)
+}
+
+// SelectUserAccount returns account of user or ErrNotFound if user is anonymous.
+func (r *FileRepository) SelectUserAccount(ctx context.Context, userID uuid.UUID) (authenticator.Account, error) {
+	if err := ctx.Err(); err != nil {
+		return authenticator.Account{}, err
+	}
+
+	r.accountsMu.RLock()
+	defer r.accountsMu.RUnlock()
+
+	return r.accounts.user(userID)
+}
+
+// MergeUsers reassigns shortenings and API keys of user from to user to and revokes sessions of user from.
+// Shortenings are written to storage file as records of new owner.
+// It returns number of reassigned shortenings.
+func (r *FileRepository) MergeUsers(ctx context.Context, from, to uuid.UUID) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := r.mergeRecords(from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = r.mergeKeys(from, to); err != nil {
+		// shortenings are merged already, keys are reassigned in file by the next write
+		return n, err
+	}
+	if err = r.revokeUserSessions(from); err != nil {
+		return n, err
+	}
+
+	return n, nil
+}
+
+// mergeKeys reassigns API keys of user from to user to in keys file.
+func (r *FileRepository) mergeKeys(from, to uuid.UUID) error {
+	r.keysMu.Lock()
+	defer r.keysMu.Unlock()
+
+	if !r.keys.merge(from, to) {
+		return nil
+	}
+	return r.writeAPIKeys()
+}
+
+// revokeUserSessions marks active sessions of user as revoked in sessions file.
+func (r *FileRepository) revokeUserSessions(userID uuid.UUID) error {
+	r.sessionsMu.Lock()
+	defer r.sessionsMu.Unlock()
+
+	sessions := r.sessions.revokeUser(userID, time.Now())
+	if len(sessions) == 0 {
+		return nil
+	}
+	if err := r.writeSessions(); err != nil {
+		// sessions stay active in file, so they stay active in memory as well
+		for hash, v := range sessions {
+			r.sessions.put(v, hash)
+		}
+		return err
+	}
+	return nil
+}
+
+// mergeRecords writes records of user from as records of user to.
+// Tombstone applies only to record of the same user, so deleted record is followed by tombstone of new owner.
+func (r *FileRepository) mergeRecords(from, to uuid.UUID) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	records := make([]record, 0, len(r.users[from]))
+	for _, key := range r.users[from] {
+		v, ok := r.db[key]
+		if !ok || !uuid.Equal(v.UUID, from) {
+			continue
+		}
+		moved := *v
+		moved.UUID = to
+		moved.DeletedFlag = false
+		moved.DeletedAt = nil
+		records = append(records, moved)
+		if v.DeletedFlag {
+			records = append(records, record{UUID: to, ShortURL: key, DeletedFlag: true, DeletedAt: v.DeletedAt})
+		}
+		n++
+	}
+	if n == 0 {
+		return 0, nil
+	}
+
+	if err := r.appendRecords(records); err != nil {
+		return 0, err
+	}
+	delete(r.users, from)
+
+	return n, nil
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/Alena-Kurushkina/shortener/internal/authenticator"
+)
+
+// A fileAPIKey sets representation of API key in keys file.
+type fileAPIKey struct {
+	ID        string    `json:"id"`
+	UUID      uuid.UUID `json:"uuid"`
+	Hash      string    `json:"hash"`
+	Name      string    `json:"name,omitempty"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// apiKeysPath returns path to file of API keys of storage file.
+func apiKeysPath(filename string) string {
+	return filename + ".keys"
+}
+
+// loadAPIKeys reads API keys from keys file if it exists.
+func (r *FileRepository) loadAPIKeys() error {
+	data, err := os.ReadFile(apiKeysPath(r.filename))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var keys []fileAPIKey
+	if err = json.Unmarshal(data, &keys); err != nil {
+		return err
+	}
+	for _, v := range keys {
+		r.keys[v.Hash] = authenticator.APIKey{ID: v.ID, Name: v.Name, Scopes: v.Scopes, CreatedAt: v.CreatedAt, UserID: v.UUID}
+	}
+
+	return nil
+}
+
+// writeAPIKeys replaces keys file with current API keys.
+// Keys are few and rarely change, so the whole file is rewritten on every change.
+// It must be called with keysMu locked.
+func (r *FileRepository) writeAPIKeys() error {
+	keys := make([]fileAPIKey, 0, len(r.keys))
+	for hash, v := range r.keys {
+		keys = append(keys, fileAPIKey{ID: v.ID, UUID: v.UserID, Hash: hash, Name: v.Name, Scopes: v.Scopes, CreatedAt: v.CreatedAt})
+	}
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+
+	return writeFileSynced(apiKeysPath(r.filename), data)
+}
+
+// InsertAPIKey saves API key with hash of its secret to keys file.
+func (r *FileRepository) InsertAPIKey(ctx context.Context, key authenticator.APIKey, hash string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.keysMu.Lock()
+	defer r.keysMu.Unlock()
+
+	r.keys.insert(key, hash)
+	if err := r.writeAPIKeys(); err != nil {
+		delete(r.keys, hash)
+		return err
+	}
+
+	return nil
+}
+
+// SelectAPIKey returns active API key by hash of its secret.
+// It returns ErrNotFound if key is unknown or revoked.
+func (r *FileRepository) SelectAPIKey(ctx context.Context, hash string) (authenticator.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return authenticator.APIKey{}, err
+	}
+
+	r.keysMu.RLock()
+	defer r.keysMu.RUnlock()
+
+	return r.keys.find(hash)
+}
+
+// SelectUserAPIKeys returns user's active API keys ordered by time of issuance.
+func (r *FileRepository) SelectUserAPIKeys(ctx context.Context, userID uuid.UUID) ([]authenticator.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.keysMu.RLock()
+	defer r.keysMu.RUnlock()
+
+	return r.keys.user(userID), nil
+}
+
+// RevokeAPIKey removes user's API key by its id from keys file.
+// It returns ErrNotFound if user has no such active key.
+func (r *FileRepository) RevokeAPIKey(ctx context.Context, userID uuid.UUID, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.keysMu.Lock()
+	defer r.keysMu.Unlock()
+
+	hash, key, err := r.keys.revoke(userID, id)
+	if err != nil {
+		return err
+	}
+	if err = r.writeAPIKeys(); err != nil {
+		// key stays active in file, so it stays active in memory as well
+		r.keys[hash] = key
+		return err
+	}
+
+	return nil
+}
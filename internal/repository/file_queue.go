@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/Alena-Kurushkina/shortener/internal/api"
+)
+
+// A queuedDeletion sets representation of deletion request in queue file.
+type queuedDeletion struct {
+	JobID string    `json:"job_id"`
+	UUID  uuid.UUID `json:"uuid"`
+	IDs   []string  `json:"ids"`
+}
+
+// queuePath returns path to file of deletion queue of storage file.
+func queuePath(filename string) string {
+	return filename + ".queue"
+}
+
+// loadQueue reads deletion requests from queue file if it exists.
+func (r *FileRepository) loadQueue() error {
+	data, err := os.ReadFile(queuePath(r.filename))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var queue []queuedDeletion
+	if err = json.Unmarshal(data, &queue); err != nil {
+		return err
+	}
+	for _, v := range queue {
+		r.queue = append(r.queue, api.DeleteItem{JobID: v.JobID, UserID: v.UUID, IDs: v.IDs})
+	}
+
+	return nil
+}
+
+// writeQueue replaces queue file with current deletion requests by atomic rename
+// and syncs it to disk, so that accepted requests survive crash.
+// It must be called with queueMu locked.
+func (r *FileRepository) writeQueue() error {
+	queue := make([]queuedDeletion, 0, len(r.queue))
+	for _, v := range r.queue {
+		queue = append(queue, queuedDeletion{JobID: v.JobID, UUID: v.UserID, IDs: v.IDs})
+	}
+	data, err := json.Marshal(queue)
+	if err != nil {
+		return err
+	}
+
+	return writeFileSynced(queuePath(r.filename), data)
+}
+
+// writeFileSynced replaces file with data by atomic rename and syncs it to disk.
+func writeFileSynced(path string, data []byte) error {
+	file, err := os.OpenFile(path+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+// QueueDeletion saves deletion request to queue file.
+func (r *FileRepository) QueueDeletion(ctx context.Context, item api.DeleteItem) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.queueMu.Lock()
+	defer r.queueMu.Unlock()
+
+	r.queue = append(r.queue, item)
+	if err := r.writeQueue(); err != nil {
+		r.queue = r.queue[:len(r.queue)-1]
+		return err
+	}
+
+	return nil
+}
+
+// SelectQueuedDeletions returns deletion requests from queue in order of queueing.
+func (r *FileRepository) SelectQueuedDeletions(ctx context.Context) ([]api.DeleteItem, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.queueMu.Lock()
+	defer r.queueMu.Unlock()
+
+	return append(make([]api.DeleteItem, 0, len(r.queue)), r.queue...), nil
+}
+
+// DequeueDeletions removes processed deletion requests from queue file.
+func (r *FileRepository) DequeueDeletions(ctx context.Context, jobIDs []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.queueMu.Lock()
+	defer r.queueMu.Unlock()
+
+	r.queue = dequeue(r.queue, jobIDs)
+
+	return r.writeQueue()
+}
@@ -2,166 +2,714 @@ package repository
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"sync"
+	"time"
 
 	uuid "github.com/satori/go.uuid"
 
 	"github.com/Alena-Kurushkina/shortener/internal/api"
+	"github.com/Alena-Kurushkina/shortener/internal/config"
+	"github.com/Alena-Kurushkina/shortener/internal/logger"
+	"github.com/Alena-Kurushkina/shortener/internal/sherr"
+)
+
+// Fsync policies of storage file.
+const (
+	// SyncAlways makes file synced after every write.
+	SyncAlways = "always"
+	// SyncInterval makes file synced periodically.
+	SyncInterval = "interval"
+	// SyncNever leaves syncing to operating system.
+	SyncNever = "never"
 )
 
 // A FileRepository represents a file data storage.
+// Storage file is append-only log of records in JSON lines format.
+// Log is periodically compacted into snapshot file which is loaded before log on start.
 type FileRepository struct {
-	db       map[string]string
-	filename string
+	mu        sync.RWMutex
+	db        map[string]*record
+	originals map[string]string
+	users     map[uuid.UUID][]string
+	filename  string
+
+	file       *os.File
+	syncPolicy string
+	dirty      bool
+	done       chan struct{}
+	wg         sync.WaitGroup
+	closeOnce  sync.Once
+
+	logRecords       int
+	logSize          int64
+	compactThreshold int
+
+	statsMu sync.Mutex
+	stats   clickCounters
+
+	queueMu sync.Mutex
+	queue   []api.DeleteItem
+
+	keysMu sync.RWMutex
+	keys   apiKeyIndex
+
+	sessionsMu sync.Mutex
+	sessions   *sessionIndex
+
+	accountsMu sync.RWMutex
+	accounts   *accountIndex
 }
 
 // newFileRepository initializes data storage in file.
-func newFileRepository(filename string) (db api.Storager, err error) {
-	// open storage file to read
-	file, err := os.OpenFile(filename, os.O_RDONLY|os.O_CREATE, 0666)
+func newFileRepository(cfg *config.Config) (api.Storager, error) {
+	switch cfg.FileSyncPolicy {
+	case SyncAlways, SyncInterval, SyncNever:
+	default:
+		return nil, fmt.Errorf("unknown file sync policy %q", cfg.FileSyncPolicy)
+	}
+
+	repo := &FileRepository{
+		db:               make(map[string]*record),
+		originals:        make(map[string]string),
+		users:            make(map[uuid.UUID][]string),
+		filename:         cfg.FileStoragePath,
+		syncPolicy:       cfg.FileSyncPolicy,
+		done:             make(chan struct{}),
+		compactThreshold: cfg.FileCompactThreshold,
+		stats:            make(clickCounters),
+		keys:             make(apiKeyIndex),
+		sessions:         newSessionIndex(),
+		accounts:         newAccountIndex(),
+	}
+
+	if err := repo.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := repo.loadStats(); err != nil {
+		return nil, err
+	}
+	if err := repo.loadQueue(); err != nil {
+		return nil, err
+	}
+	if err := repo.loadAPIKeys(); err != nil {
+		return nil, err
+	}
+	if err := repo.loadSessions(); err != nil {
+		return nil, err
+	}
+	if err := repo.loadAccounts(); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(cfg.FileStoragePath, os.O_RDWR|os.O_CREATE, 0666)
 	if err != nil {
 		return nil, err
 	}
-	defer func() {
-		if tErr := file.Close(); tErr != nil {
-			err = tErr
-		}
-	}()
+	repo.file = file
+
+	if err = repo.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	// all writes go to the end of file
+	if _, err = file.Seek(0, io.SeekEnd); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if repo.syncPolicy == SyncInterval {
+		repo.wg.Add(1)
+		go repo.syncPeriodically(cfg.FileSyncInterval.Duration)
+	}
+	if repo.compactThreshold > 0 {
+		repo.wg.Add(1)
+		go repo.compactPeriodically(cfg.FileCompactInterval.Duration)
+	}
+
+	return repo, nil
+}
 
-	// scan all lines from file
-	scanner := bufio.NewScanner(file)
-	rmap := make(map[string]string)
-	record := record{}
+// load reads all records from storage file and applies them over loaded snapshot.
+// Last line which is not terminated by newline is a trace of interrupted write,
+// it is cut off from file.
+func (r *FileRepository) load() error {
+	reader := bufio.NewReader(r.file)
 
-	for scanner.Scan() {
-		data := scanner.Bytes()
-		err = json.Unmarshal(data, &record)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			r.logSize = offset
+			if len(line) != 0 {
+				logger.Log.Infof("Torn record at offset %d is cut off from storage file", offset)
+				return r.file.Truncate(offset)
+			}
+			return nil
+		}
 		if err != nil {
-			return nil, err
+			return err
 		}
-		rmap[record.ShortURL] = record.OriginalURL
-	}
-	if scanner.Err() != nil {
-		return nil, scanner.Err()
+
+		rec := record{}
+		if err = json.Unmarshal(line, &rec); err != nil {
+			return fmt.Errorf("storage file is corrupted at offset %d: %w", offset, err)
+		}
+		r.apply(rec)
+		r.logRecords++
+
+		offset += int64(len(line))
 	}
+}
+
+// syncPeriodically flushes written data to disk with passed interval.
+func (r *FileRepository) syncPeriodically(interval time.Duration) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-	db = &FileRepository{
-		db:       rmap,
-		filename: filename,
+	for {
+		select {
+		case <-ticker.C:
+			r.mu.Lock()
+			r.sync()
+			r.mu.Unlock()
+		case <-r.done:
+			return
+		}
 	}
+}
 
-	return db, err
+// sync flushes file to disk if there were writes after previous sync.
+// It must be called with mutex locked.
+func (r *FileRepository) sync() {
+	if !r.dirty {
+		return
+	}
+	if err := r.file.Sync(); err != nil {
+		logger.Log.Errorf("Can't sync storage file: %s", err.Error())
+		return
+	}
+	r.dirty = false
 }
 
-// Close satisfies interface.
-func (r *FileRepository) Close() {}
+// Close syncs and closes storage file. Repeated calls do nothing.
+func (r *FileRepository) Close() {
+	r.closeOnce.Do(func() {
+		close(r.done)
+		r.wg.Wait()
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if r.syncPolicy != SyncNever {
+			r.sync()
+		}
+		if err := r.file.Close(); err != nil {
+			logger.Log.Errorf("Can't close storage file: %s", err.Error())
+		}
+	})
+}
 
 // Ping satisfies interface.
 func (r *FileRepository) Ping(_ context.Context) error { return nil }
 
 // A record sets data representation in file.
+// Record with DeletedFlag set is a tombstone which marks shortening as deleted,
+// record with PurgedFlag set removes shortening permanently.
 type record struct {
-	UUID        uuid.UUID `json:"uuid"`
-	ShortURL    string    `json:"short_url"`
-	OriginalURL string    `json:"original_url"`
+	UUID        uuid.UUID  `json:"uuid"`
+	ShortURL    string     `json:"short_url"`
+	OriginalURL string     `json:"original_url"`
+	DeletedFlag bool       `json:"is_deleted,omitempty"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	PurgedFlag  bool       `json:"is_purged,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	Redirect    int        `json:"redirect_code,omitempty"`
+	Passthrough bool       `json:"query_passthrough,omitempty"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+	// History keeps previous changes of original URL,
+	// change is written to file as new record with the whole history
+	History []api.URLEdit `json:"history,omitempty"`
 }
 
-// InsertBatch adds array of data to storage.
-func (r FileRepository) InsertBatch(_ context.Context, userID uuid.UUID, batch []api.BatchElement) (err error) {
-	// open file
-	file, err := os.OpenFile(r.filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0666)
-	if err != nil {
-		return err
+// apply puts record read from file or just written to file into local maps.
+// It must be called with mutex locked.
+func (r *FileRepository) apply(rec record) {
+	if rec.PurgedFlag {
+		r.remove(rec)
+		return
 	}
-	defer func() {
-		if tErr := file.Close(); tErr != nil {
-			err = tErr
+	if rec.DeletedFlag {
+		if v, ok := r.db[rec.ShortURL]; ok && uuid.Equal(v.UUID, rec.UUID) && !v.DeletedFlag {
+			v.DeletedFlag = true
+			v.DeletedAt = deletionTime(rec.DeletedAt)
 		}
-	}()
+		return
+	}
+	r.put(rec)
+}
 
-	writer := bufio.NewWriter(file)
+// deletionTime returns time of deletion written to file.
+// Records deleted before the time was kept are considered deleted at the moment of loading.
+func deletionTime(t *time.Time) *time.Time {
+	if t != nil {
+		return t
+	}
+	now := time.Now()
+	return &now
+}
 
-	for _, v := range batch {
-		r.db[v.ShortURL] = v.OriginalURL
+// put saves record in local maps replacing previous record with the same shortening.
+// It must be called with mutex locked.
+func (r *FileRepository) put(rec record) {
+	if rec.DeletedFlag {
+		rec.DeletedAt = deletionTime(rec.DeletedAt)
+	}
+
+	v, ok := r.db[rec.ShortURL]
+	if !ok || !uuid.Equal(v.UUID, rec.UUID) {
+		r.users[rec.UUID] = append(r.users[rec.UUID], rec.ShortURL)
+	}
+	if ok && r.originals[v.OriginalURL] == rec.ShortURL {
+		delete(r.originals, v.OriginalURL)
+	}
+	r.db[rec.ShortURL] = &rec
+	r.originals[rec.OriginalURL] = rec.ShortURL
+}
+
+// remove deletes record from local maps.
+// It must be called with mutex locked.
+func (r *FileRepository) remove(rec record) {
+	v, ok := r.db[rec.ShortURL]
+	if !ok || !uuid.Equal(v.UUID, rec.UUID) {
+		return
+	}
+	delete(r.db, rec.ShortURL)
+	if r.originals[v.OriginalURL] == rec.ShortURL {
+		delete(r.originals, v.OriginalURL)
+	}
 
-		// encode data
-		rec := record{UUID: userID, OriginalURL: v.OriginalURL, ShortURL: v.ShortURL}
-		data, errm := json.Marshal(&rec)
-		if errm != nil {
-			return errm
+	keys := r.users[rec.UUID][:0]
+	for _, key := range r.users[rec.UUID] {
+		if key != rec.ShortURL {
+			keys = append(keys, key)
 		}
-		data = append(data, '\n')
+	}
+	r.users[rec.UUID] = keys
+}
 
-		// write data to buffer
-		if _, err = writer.Write(data); err != nil {
+// appendRecords encodes records and writes them to the end of storage file with one write call,
+// then puts them into local maps.
+// It must be called with mutex locked.
+func (r *FileRepository) appendRecords(records []record) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, rec := range records {
+		if err := encoder.Encode(&rec); err != nil {
 			return err
 		}
 	}
 
-	// write buffer to file
-	if err = writer.Flush(); err != nil {
+	n, err := r.file.Write(buf.Bytes())
+	r.logSize += int64(n)
+	if err != nil {
 		return err
 	}
+	r.dirty = true
 
-	return err
-}
+	if r.syncPolicy == SyncAlways {
+		if err := r.file.Sync(); err != nil {
+			return err
+		}
+		r.dirty = false
+	}
 
-// Insert adds data to storage.
-func (r FileRepository) Insert(_ context.Context, userID uuid.UUID, key, value string) (err error) {
-	// write data to local map
-	r.db[key] = value
+	for _, rec := range records {
+		r.apply(rec)
+	}
+	r.logRecords += len(records)
 
-	// open file
-	file, err := os.OpenFile(r.filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0666)
-	if err != nil {
+	return nil
+}
+
+// InsertBatch adds array of data to storage.
+// Elements which original URL is already in storage get existing shortening.
+// It returns CollisionError if shortening of some element is already used.
+func (r *FileRepository) InsertBatch(ctx context.Context, userID uuid.UUID, batch []api.BatchElement) error {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
-	defer func() {
-		if tErr := file.Close(); tErr != nil {
-			err = tErr
-		}
-	}()
 
-	writer := bufio.NewWriter(file)
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-	// encode data
-	rec := record{UUID: userID, OriginalURL: value, ShortURL: key}
-	data, err := json.Marshal(&rec)
-	if err != nil {
-		return err
+	now := time.Now()
+	records := make([]record, 0, len(batch))
+	added := make(map[string]string, len(batch))
+	shorts := make(map[string]struct{}, len(batch))
+	for k, v := range batch {
+		if existKey, ok := r.originals[v.OriginalURL]; ok {
+			batch[k].ShortURL = existKey
+			continue
+		}
+		if existKey, ok := added[v.OriginalURL]; ok {
+			batch[k].ShortURL = existKey
+			continue
+		}
+		if _, ok := shorts[v.ShortURL]; ok {
+			return sherr.NewCollisionError(v.ShortURL)
+		}
+		if _, ok := r.db[v.ShortURL]; ok {
+			return sherr.NewCollisionError(v.ShortURL)
+		}
+		added[v.OriginalURL] = v.ShortURL
+		shorts[v.ShortURL] = struct{}{}
+		records = append(records, record{
+			UUID:        userID,
+			OriginalURL: v.OriginalURL,
+			ShortURL:    v.ShortURL,
+			ExpiresAt:   v.ExpiresAt,
+			Redirect:    v.RedirectCode,
+			Passthrough: v.Passthrough,
+			CreatedAt:   &now,
+		})
+	}
+	if len(records) == 0 {
+		return nil
 	}
-	data = append(data, '\n')
 
-	// write data to buffer
-	if _, err = writer.Write(data); err != nil {
+	return r.appendRecords(records)
+}
+
+// Insert adds data to storage.
+// It returns AlreadyExistError if original URL is already in storage
+// and CollisionError if shortening is already used.
+func (r *FileRepository) Insert(ctx context.Context, userID uuid.UUID, key, value string, opts api.LinkOptions) error {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
 
-	// write buffer to file
-	if err = writer.Flush(); err != nil {
-		return err
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existKey, ok := r.originals[value]; ok {
+		return sherr.NewAlreadyExistError(value, existKey)
+	}
+	if _, ok := r.db[key]; ok {
+		return sherr.NewCollisionError(key)
 	}
 
-	return err
+	now := time.Now()
+
+	return r.appendRecords([]record{{
+		UUID:        userID,
+		OriginalURL: value,
+		ShortURL:    key,
+		ExpiresAt:   opts.ExpiresAt,
+		Redirect:    opts.RedirectCode,
+		Passthrough: opts.Passthrough,
+		CreatedAt:   &now,
+	}})
 }
 
 // Select returns data from storage.
-func (r FileRepository) Select(_ context.Context, key string) (string, error) {
-	if v, ok := r.db[key]; ok {
-		return v, nil
+// It returns ErrDBRecordDeleted if shortening was deleted and ErrLinkExpired if it is expired.
+func (r *FileRepository) Select(ctx context.Context, key string) (api.Redirect, error) {
+	if err := ctx.Err(); err != nil {
+		return api.Redirect{}, err
 	}
-	return "", fmt.Errorf("can't find value of key")
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	v, ok := r.db[key]
+	if !ok {
+		return api.Redirect{}, sherr.ErrNotFound
+	}
+	if v.DeletedFlag {
+		return api.Redirect{}, sherr.ErrDBRecordDeleted
+	}
+	if isExpired(v.ExpiresAt, time.Now()) {
+		return api.Redirect{}, sherr.ErrLinkExpired
+	}
+	return api.Redirect{OriginalURL: v.OriginalURL, RedirectCode: v.Redirect, Passthrough: v.Passthrough, ExpiresAt: utcTime(v.ExpiresAt)}, nil
 }
 
-// SelectUserAll returns data from storage.
-func (r FileRepository) SelectUserAll(ctx context.Context, id uuid.UUID) ([]api.BatchElement, error) {
-	return []api.BatchElement{}, nil
+// SelectUserAll returns all user's pairs of long URL and shortening from storage.
+func (r *FileRepository) SelectUserAll(ctx context.Context, id uuid.UUID) ([]api.BatchElement, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	records := make([]api.BatchElement, 0, len(r.users[id]))
+	for _, key := range r.users[id] {
+		v, ok := r.db[key]
+		if !ok || !uuid.Equal(v.UUID, id) {
+			continue
+		}
+		records = append(records, api.BatchElement{
+			OriginalURL:  v.OriginalURL,
+			ShortURL:     v.ShortURL,
+			ExpiresAt:    v.ExpiresAt,
+			RedirectCode: v.Redirect,
+			Passthrough:  v.Passthrough,
+		})
+	}
+
+	return records, nil
 }
 
-// DeleteRecords deletes data from storage.
-func (r FileRepository) DeleteRecords(ctx context.Context, deletedItems []api.DeleteItem) error {
-	return nil
+// SelectUserPage returns page of user's shortenings ordered by creation time
+// and cursor of the next page if it exists.
+// Records written before creation time was kept go first.
+func (r *FileRepository) SelectUserPage(ctx context.Context, id uuid.UUID, query api.ListQuery) ([]api.BatchElement, *api.ListCursor, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	records := make([]listedRecord, 0, len(r.users[id]))
+	for _, key := range r.users[id] {
+		v, ok := r.db[key]
+		if !ok || !uuid.Equal(v.UUID, id) {
+			continue
+		}
+		rec := listedRecord{
+			BatchElement: api.BatchElement{
+				OriginalURL:  v.OriginalURL,
+				ShortURL:     v.ShortURL,
+				ExpiresAt:    v.ExpiresAt,
+				RedirectCode: v.Redirect,
+				Passthrough:  v.Passthrough,
+				Deleted:      v.DeletedFlag,
+			},
+		}
+		if v.CreatedAt != nil {
+			rec.createdAt = *v.CreatedAt
+		}
+		records = append(records, rec)
+	}
+
+	page, next := pageRecords(records, query)
+
+	return page, next, nil
+}
+
+// DeleteRecords marks user's records as deleted and writes tombstones to storage file.
+// Records which don't belong to user are skipped.
+// For every passed item it returns item with ids of records that are deleted.
+func (r *FileRepository) DeleteRecords(ctx context.Context, deleteItems []api.DeleteItem) ([]api.DeleteItem, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	deleted := make([]api.DeleteItem, 0, len(deleteItems))
+	tombstones := make([]record, 0, len(deleteItems))
+	for _, item := range deleteItems {
+		done := api.DeleteItem{UserID: item.UserID, IDs: make([]string, 0, len(item.IDs))}
+		for _, key := range item.IDs {
+			v, ok := r.db[key]
+			if !ok || !uuid.Equal(v.UUID, item.UserID) {
+				continue
+			}
+			done.IDs = append(done.IDs, key)
+			if !v.DeletedFlag {
+				tombstones = append(tombstones, record{UUID: item.UserID, ShortURL: key, DeletedFlag: true, DeletedAt: &now})
+			}
+		}
+		deleted = append(deleted, done)
+	}
+	if len(tombstones) == 0 {
+		return deleted, nil
+	}
+
+	if err := r.appendRecords(tombstones); err != nil {
+		return nil, err
+	}
+
+	return deleted, nil
+}
+
+// DeleteExpired writes tombstones of records which expiration time has passed by now.
+// It returns shortenings of deleted records.
+func (r *FileRepository) DeleteExpired(ctx context.Context, now time.Time) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	expired := make([]string, 0)
+	tombstones := make([]record, 0)
+	for key, v := range r.db {
+		if !v.DeletedFlag && isExpired(v.ExpiresAt, now) {
+			expired = append(expired, key)
+			tombstones = append(tombstones, record{UUID: v.UUID, ShortURL: key, DeletedFlag: true, DeletedAt: &now})
+		}
+	}
+	if len(tombstones) == 0 {
+		return expired, nil
+	}
+
+	if err := r.appendRecords(tombstones); err != nil {
+		return nil, err
+	}
+
+	return expired, nil
+}
+
+// RestoreRecords brings user's deleted records back by writing their copies without deletion mark.
+// Records which don't belong to user or aren't deleted are skipped.
+// For every passed item it returns item with ids of records that are restored.
+func (r *FileRepository) RestoreRecords(ctx context.Context, restoreItems []api.DeleteItem) ([]api.DeleteItem, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	restored := make([]api.DeleteItem, 0, len(restoreItems))
+	records := make([]record, 0, len(restoreItems))
+	seen := make(map[string]struct{})
+	for _, item := range restoreItems {
+		done := api.DeleteItem{UserID: item.UserID, IDs: make([]string, 0, len(item.IDs))}
+		for _, key := range item.IDs {
+			v, ok := r.db[key]
+			if !ok || !uuid.Equal(v.UUID, item.UserID) || !v.DeletedFlag {
+				continue
+			}
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			done.IDs = append(done.IDs, key)
+
+			rec := *v
+			rec.DeletedFlag = false
+			rec.DeletedAt = nil
+			records = append(records, rec)
+		}
+		restored = append(restored, done)
+	}
+	if len(records) == 0 {
+		return restored, nil
+	}
+
+	if err := r.appendRecords(records); err != nil {
+		return nil, err
+	}
+
+	return restored, nil
+}
+
+// PurgeDeleted permanently removes records deleted before passed time together with their history and statistics.
+// Removal is written to storage file and takes effect in snapshot on the next compaction.
+// It returns shortenings of removed records.
+func (r *FileRepository) PurgeDeleted(ctx context.Context, before time.Time) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	purged := make([]string, 0)
+	records := make([]record, 0)
+	for key, v := range r.db {
+		if !v.DeletedFlag || v.DeletedAt == nil || v.DeletedAt.After(before) {
+			continue
+		}
+		purged = append(purged, key)
+		records = append(records, record{UUID: v.UUID, ShortURL: key, PurgedFlag: true})
+	}
+	if len(records) == 0 {
+		return purged, nil
+	}
+
+	if err := r.appendRecords(records); err != nil {
+		return nil, err
+	}
+
+	r.statsMu.Lock()
+	defer r.statsMu.Unlock()
+
+	for _, key := range purged {
+		delete(r.stats, key)
+	}
+	if err := r.writeStats(); err != nil {
+		return nil, err
+	}
+
+	return purged, nil
+}
+
+// UpdateOriginalURL makes user's shortening lead to another original URL and saves change to history.
+// It returns ErrNotFound if shortening doesn't belong to user, ErrDBRecordDeleted if it was deleted
+// and AlreadyExistError if original URL already has another shortening.
+func (r *FileRepository) UpdateOriginalURL(ctx context.Context, userID uuid.UUID, key, originalURL string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	v, ok := r.db[key]
+	if !ok || !uuid.Equal(v.UUID, userID) {
+		return sherr.ErrNotFound
+	}
+	if v.DeletedFlag {
+		return sherr.ErrDBRecordDeleted
+	}
+	if v.OriginalURL == originalURL {
+		return nil
+	}
+	if existKey, ok := r.originals[originalURL]; ok {
+		return sherr.NewAlreadyExistError(originalURL, existKey)
+	}
+
+	edited := *v
+	edited.OriginalURL = originalURL
+	edited.History = append(append(make([]api.URLEdit, 0, len(v.History)+1), v.History...),
+		api.URLEdit{OldURL: v.OriginalURL, NewURL: originalURL, ChangedAt: time.Now()})
+
+	return r.appendRecords([]record{edited})
+}
+
+// SelectHistory returns changes of original URL of user's shortening ordered by time.
+// It returns ErrNotFound if shortening doesn't belong to user.
+func (r *FileRepository) SelectHistory(ctx context.Context, userID uuid.UUID, key string) ([]api.URLEdit, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	v, ok := r.db[key]
+	if !ok || !uuid.Equal(v.UUID, userID) {
+		return nil, sherr.ErrNotFound
+	}
+
+	return append(make([]api.URLEdit, 0, len(v.History)), v.History...), nil
 }
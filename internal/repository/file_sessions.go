@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/Alena-Kurushkina/shortener/internal/authenticator"
+)
+
+// A fileSession sets representation of session in sessions file.
+type fileSession struct {
+	ID        string     `json:"id"`
+	UUID      uuid.UUID  `json:"uuid"`
+	Hash      string     `json:"hash"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// sessionsPath returns path to file of sessions of storage file.
+func sessionsPath(filename string) string {
+	return filename + ".sessions"
+}
+
+// loadSessions reads sessions from sessions file if it exists.
+func (r *FileRepository) loadSessions() error {
+	data, err := os.ReadFile(sessionsPath(r.filename))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var sessions []fileSession
+	if err = json.Unmarshal(data, &sessions); err != nil {
+		return err
+	}
+	for _, v := range sessions {
+		r.sessions.put(authenticator.Session{ID: v.ID, UserID: v.UUID, ExpiresAt: v.ExpiresAt, RevokedAt: v.RevokedAt}, v.Hash)
+	}
+
+	return nil
+}
+
+// writeSessions replaces sessions file with current sessions.
+// It must be called with sessionsMu locked.
+func (r *FileRepository) writeSessions() error {
+	sessions := make([]fileSession, 0, len(r.sessions.sessions))
+	for hash, v := range r.sessions.sessions {
+		sessions = append(sessions, fileSession{ID: v.ID, UUID: v.UserID, Hash: hash, ExpiresAt: v.ExpiresAt, RevokedAt: v.RevokedAt})
+	}
+	data, err := json.Marshal(sessions)
+	if err != nil {
+		return err
+	}
+
+	return writeFileSynced(sessionsPath(r.filename), data)
+}
+
+// InsertSession saves session with hash of its refresh token to sessions file.
+func (r *FileRepository) InsertSession(ctx context.Context, session authenticator.Session, hash string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.sessionsMu.Lock()
+	defer r.sessionsMu.Unlock()
+
+	r.sessions.put(session, hash)
+	if err := r.writeSessions(); err != nil {
+		r.sessions.remove(session.ID)
+		return err
+	}
+
+	return nil
+}
+
+// SelectSession returns session by hash of its current refresh token.
+// It returns ErrNotFound if token is unknown or was rotated.
+func (r *FileRepository) SelectSession(ctx context.Context, hash string) (authenticator.Session, error) {
+	if err := ctx.Err(); err != nil {
+		return authenticator.Session{}, err
+	}
+
+	r.sessionsMu.Lock()
+	defer r.sessionsMu.Unlock()
+
+	return r.sessions.find(hash)
+}
+
+// RotateSession replaces refresh token of session and prolongs it in sessions file.
+// It returns ErrNotFound if session is revoked or oldHash is not its current token.
+func (r *FileRepository) RotateSession(ctx context.Context, id, oldHash, newHash string, expiresAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.sessionsMu.Lock()
+	defer r.sessionsMu.Unlock()
+
+	session, err := r.sessions.rotate(id, oldHash, newHash, expiresAt)
+	if err != nil {
+		return err
+	}
+	if err = r.writeSessions(); err != nil {
+		// old token stays valid in file, so it stays valid in memory as well
+		r.sessions.put(session, oldHash)
+		return err
+	}
+
+	return nil
+}
+
+// RevokeSession marks session as revoked in sessions file. It returns ErrNotFound if session is unknown.
+func (r *FileRepository) RevokeSession(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.sessionsMu.Lock()
+	defer r.sessionsMu.Unlock()
+
+	hash, session, err := r.sessions.revoke(id, time.Now())
+	if err != nil {
+		return err
+	}
+	if err = r.writeSessions(); err != nil {
+		r.sessions.put(session, hash)
+		return err
+	}
+
+	return nil
+}
+
+// SelectRevokedSessions returns ids of sessions revoked after since.
+func (r *FileRepository) SelectRevokedSessions(ctx context.Context, since time.Time) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.sessionsMu.Lock()
+	defer r.sessionsMu.Unlock()
+
+	return r.sessions.revokedSince(since), nil
+}
+
+// PurgeSessions removes sessions which expired or were revoked before time before from sessions file.
+// If file can't be written, purged sessions are removed from it by the next write.
+func (r *FileRepository) PurgeSessions(ctx context.Context, before time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.sessionsMu.Lock()
+	defer r.sessionsMu.Unlock()
+
+	if r.sessions.purge(before) == 0 {
+		return nil
+	}
+	return r.writeSessions()
+}
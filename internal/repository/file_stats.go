@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/Alena-Kurushkina/shortener/internal/api"
+	"github.com/Alena-Kurushkina/shortener/internal/logger"
+	"github.com/Alena-Kurushkina/shortener/internal/sherr"
+)
+
+// statsPath returns path to file of click counters of storage file.
+func statsPath(filename string) string {
+	return filename + ".stats"
+}
+
+// loadStats reads click counters from stats file if it exists.
+// Stats file is a log of counters added by SaveClicks, one JSON object per line.
+// Log is replaced by one line of loaded counters, so that it doesn't grow between restarts;
+// torn line of interrupted write is dropped.
+func (r *FileRepository) loadStats() error {
+	file, err := os.Open(statsPath(r.filename))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	lines, torn := 0, false
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) != 0 {
+				logger.Log.Info("Torn line is cut off from stats file")
+				torn = true
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		delta := make(clickCounters)
+		if err = json.Unmarshal(line, &delta); err != nil {
+			return fmt.Errorf("stats file is corrupted at line %d: %w", lines+1, err)
+		}
+		r.stats.merge(delta)
+		lines++
+	}
+
+	if lines <= 1 && !torn {
+		return nil
+	}
+	return r.writeStats()
+}
+
+// writeStats replaces stats file with one line of current click counters.
+// It must be called with statsMu locked.
+func (r *FileRepository) writeStats() error {
+	data, err := json.Marshal(r.stats)
+	if err != nil {
+		return err
+	}
+
+	return writeFileSynced(statsPath(r.filename), append(data, '\n'))
+}
+
+// appendStats adds line of counters to stats file and flushes it to disk.
+// It must be called with statsMu locked.
+func (r *FileRepository) appendStats(delta clickCounters) error {
+	data, err := json.Marshal(delta)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(statsPath(r.filename), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// SaveClicks adds clicks to counters of shortenings. Only counters of clicks are appended to stats file,
+// so that cost of saving doesn't depend on collected statistics.
+func (r *FileRepository) SaveClicks(ctx context.Context, clicks []api.Click) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	delta := make(clickCounters)
+	delta.add(clicks)
+
+	r.statsMu.Lock()
+	defer r.statsMu.Unlock()
+
+	if err := r.appendStats(delta); err != nil {
+		return err
+	}
+	r.stats.merge(delta)
+
+	return nil
+}
+
+// SelectStats returns aggregated clicks by user's shortening.
+// It returns ErrNotFound if shortening doesn't belong to user.
+func (r *FileRepository) SelectStats(ctx context.Context, userID uuid.UUID, key string) (api.ClickStats, error) {
+	if err := ctx.Err(); err != nil {
+		return api.ClickStats{}, err
+	}
+
+	r.mu.RLock()
+	v, ok := r.db[key]
+	r.mu.RUnlock()
+	if !ok || !uuid.Equal(v.UUID, userID) {
+		return api.ClickStats{}, sherr.ErrNotFound
+	}
+
+	r.statsMu.Lock()
+	defer r.statsMu.Unlock()
+
+	return r.stats.stats(key), nil
+}
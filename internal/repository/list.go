@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Alena-Kurushkina/shortener/internal/api"
+)
+
+// A listedRecord is user's shortening with fields which define its place in list.
+type listedRecord struct {
+	api.BatchElement
+	createdAt time.Time
+}
+
+// before reports whether record goes before cursor position in ascending order.
+func (r listedRecord) before(c api.ListCursor) bool {
+	if !r.createdAt.Equal(c.CreatedAt) {
+		return r.createdAt.Before(c.CreatedAt)
+	}
+	return r.ShortURL < c.ShortURL
+}
+
+// matchesQuery reports whether record satisfies filters of query.
+func matchesQuery(rec listedRecord, query api.ListQuery) bool {
+	if query.Deleted != nil && rec.Deleted != *query.Deleted {
+		return false
+	}
+	if query.Search != "" && !strings.Contains(strings.ToLower(rec.OriginalURL), strings.ToLower(query.Search)) {
+		return false
+	}
+	return true
+}
+
+// pageRecords selects page of records in memory.
+// It returns cursor of the last record of page if there are more records after it.
+func pageRecords(records []listedRecord, query api.ListQuery) ([]api.BatchElement, *api.ListCursor) {
+	sort.Slice(records, func(i, j int) bool {
+		if query.Desc {
+			return records[j].before(api.ListCursor{CreatedAt: records[i].createdAt, ShortURL: records[i].ShortURL})
+		}
+		return records[i].before(api.ListCursor{CreatedAt: records[j].createdAt, ShortURL: records[j].ShortURL})
+	})
+
+	page := make([]api.BatchElement, 0, query.Limit)
+	var last listedRecord
+	for _, rec := range records {
+		if !matchesQuery(rec, query) {
+			continue
+		}
+		if query.After != nil {
+			atCursor := rec.createdAt.Equal(query.After.CreatedAt) && rec.ShortURL == query.After.ShortURL
+			if atCursor || rec.before(*query.After) != query.Desc {
+				continue
+			}
+		}
+		if len(page) == query.Limit {
+			return page, &api.ListCursor{CreatedAt: last.createdAt, ShortURL: last.ShortURL}
+		}
+		if !rec.createdAt.IsZero() {
+			createdAt := rec.createdAt
+			rec.CreatedAt = &createdAt
+		}
+		page = append(page, rec.BatchElement)
+		last = rec
+	}
+
+	return page, nil
+}
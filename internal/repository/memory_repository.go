@@ -2,57 +2,540 @@ package repository
 
 import (
 	"context"
-	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
 
 	uuid "github.com/satori/go.uuid"
 
 	"github.com/Alena-Kurushkina/shortener/internal/api"
+	"github.com/Alena-Kurushkina/shortener/internal/authenticator"
+	"github.com/Alena-Kurushkina/shortener/internal/sherr"
 )
 
+// shardCount defines number of independently locked parts of memory storage.
+const shardCount = 32
+
+// A memoryRecord represents shortening kept in memory.
+type memoryRecord struct {
+	userID      uuid.UUID
+	originalURL string
+	createdAt   time.Time
+	expiresAt   *time.Time
+	redirect    int
+	passthrough bool
+	deleted     bool
+	deletedAt   time.Time
+}
+
+// A memoryShard keeps part of records selected by hash of shortening.
+type memoryShard struct {
+	mu      sync.RWMutex
+	records map[string]*memoryRecord
+}
+
 // A MemoryRepository represents a memory data storage.
+// Records are spread across shards so that concurrent reads of different shortenings don't contend.
+// Writes are serialized by mu which also guards indexes of original URLs and users.
 type MemoryRepository struct {
-	db map[string]string
+	shards [shardCount]*memoryShard
+
+	mu        sync.RWMutex
+	originals map[string]string
+	users     map[uuid.UUID][]string
+	history   map[string][]api.URLEdit
+
+	statsMu sync.Mutex
+	stats   clickCounters
+
+	queueMu sync.Mutex
+	queue   []api.DeleteItem
+
+	keysMu sync.RWMutex
+	keys   apiKeyIndex
+
+	sessionsMu sync.Mutex
+	sessions   *sessionIndex
+
+	accountsMu sync.RWMutex
+	accounts   *accountIndex
 }
 
 // newMemoryRepository initializes data storage in memory.
 func newMemoryRepository() (api.Storager, error) {
-	db := MemoryRepository{
-		db: make(map[string]string),
+	db := &MemoryRepository{
+		originals: make(map[string]string),
+		users:     make(map[uuid.UUID][]string),
+		history:   make(map[string][]api.URLEdit),
+		stats:     make(clickCounters),
+		keys:      make(apiKeyIndex),
+		sessions:  newSessionIndex(),
+		accounts:  newAccountIndex(),
 	}
-	return &db, nil
+	for i := range db.shards {
+		db.shards[i] = &memoryShard{records: make(map[string]*memoryRecord)}
+	}
+	return db, nil
+}
+
+// shard returns shard which keeps shortening.
+func (r *MemoryRepository) shard(key string) *memoryShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return r.shards[h.Sum32()%shardCount]
+}
+
+// get returns record by shortening.
+func (r *MemoryRepository) get(key string) (*memoryRecord, bool) {
+	s := r.shard(key)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	v, ok := s.records[key]
+	return v, ok
+}
+
+// put saves record by shortening and updates indexes.
+// It must be called with mu locked.
+func (r *MemoryRepository) put(key string, rec *memoryRecord) {
+	s := r.shard(key)
+	s.mu.Lock()
+	s.records[key] = rec
+	s.mu.Unlock()
+
+	r.originals[rec.originalURL] = key
+	r.users[rec.userID] = append(r.users[rec.userID], key)
 }
 
 // Insert adds data to storage.
-func (r MemoryRepository) Insert(_ context.Context, id uuid.UUID, key, value string) error {
-	r.db[key] = value
+// It returns AlreadyExistError if original URL is already in storage
+// and CollisionError if shortening is already used.
+func (r *MemoryRepository) Insert(ctx context.Context, userID uuid.UUID, key, value string, opts api.LinkOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existKey, ok := r.originals[value]; ok {
+		return sherr.NewAlreadyExistError(value, existKey)
+	}
+	if _, ok := r.get(key); ok {
+		return sherr.NewCollisionError(key)
+	}
+
+	r.put(key, &memoryRecord{
+		userID:      userID,
+		originalURL: value,
+		createdAt:   time.Now(),
+		expiresAt:   opts.ExpiresAt,
+		redirect:    opts.RedirectCode,
+		passthrough: opts.Passthrough,
+	})
 
 	return nil
 }
 
 // InsertBatch adds array of data to storage.
-func (r MemoryRepository) InsertBatch(_ context.Context, id uuid.UUID, batch []api.BatchElement) error {
+// Elements which original URL is already in storage get existing shortening.
+// It returns CollisionError if shortening of some element is already used.
+// Batch is inserted entirely or not inserted at all.
+func (r *MemoryRepository) InsertBatch(ctx context.Context, userID uuid.UUID, batch []api.BatchElement) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seen := make(map[string]struct{}, len(batch))
 	for _, v := range batch {
-		r.db[v.ShortURL] = v.OriginalURL
+		if _, ok := r.originals[v.OriginalURL]; ok {
+			continue
+		}
+		if _, ok := seen[v.ShortURL]; ok {
+			return sherr.NewCollisionError(v.ShortURL)
+		}
+		if _, ok := r.get(v.ShortURL); ok {
+			return sherr.NewCollisionError(v.ShortURL)
+		}
+		seen[v.ShortURL] = struct{}{}
+	}
+
+	now := time.Now()
+	for k, v := range batch {
+		if existKey, ok := r.originals[v.OriginalURL]; ok {
+			batch[k].ShortURL = existKey
+			continue
+		}
+		r.put(v.ShortURL, &memoryRecord{
+			userID:      userID,
+			originalURL: v.OriginalURL,
+			createdAt:   now,
+			expiresAt:   v.ExpiresAt,
+			redirect:    v.RedirectCode,
+			passthrough: v.Passthrough,
+		})
 	}
 
 	return nil
 }
 
 // Select returns data from storage.
-func (r MemoryRepository) Select(_ context.Context, key string) (string, error) {
-	if v, ok := r.db[key]; ok {
-		return v, nil
+// It returns ErrDBRecordDeleted if shortening was deleted and ErrLinkExpired if it is expired.
+func (r *MemoryRepository) Select(ctx context.Context, key string) (api.Redirect, error) {
+	if err := ctx.Err(); err != nil {
+		return api.Redirect{}, err
+	}
+
+	s := r.shard(key)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	v, ok := s.records[key]
+	if !ok {
+		return api.Redirect{}, sherr.ErrNotFound
+	}
+	if v.deleted {
+		return api.Redirect{}, sherr.ErrDBRecordDeleted
+	}
+	if isExpired(v.expiresAt, time.Now()) {
+		return api.Redirect{}, sherr.ErrLinkExpired
+	}
+	return api.Redirect{OriginalURL: v.originalURL, RedirectCode: v.redirect, Passthrough: v.passthrough, ExpiresAt: utcTime(v.expiresAt)}, nil
+}
+
+// SelectUserAll returns all user's pairs of long URL and shortening from storage.
+func (r *MemoryRepository) SelectUserAll(ctx context.Context, id uuid.UUID) ([]api.BatchElement, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	records := make([]api.BatchElement, 0, len(r.users[id]))
+	for _, key := range r.users[id] {
+		v, ok := r.get(key)
+		if !ok {
+			continue
+		}
+		records = append(records, api.BatchElement{
+			OriginalURL:  v.originalURL,
+			ShortURL:     key,
+			ExpiresAt:    v.expiresAt,
+			RedirectCode: v.redirect,
+			Passthrough:  v.passthrough,
+		})
 	}
-	return "", fmt.Errorf("can't find value of key")
+
+	return records, nil
 }
 
-// SelectUserAll returns data from storage.
-func (r MemoryRepository) SelectUserAll(ctx context.Context, id uuid.UUID) ([]api.BatchElement, error) {
-	return []api.BatchElement{}, nil
+// SelectUserPage returns page of user's shortenings ordered by creation time
+// and cursor of the next page if it exists.
+func (r *MemoryRepository) SelectUserPage(ctx context.Context, id uuid.UUID, query api.ListQuery) ([]api.BatchElement, *api.ListCursor, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	records := make([]listedRecord, 0, len(r.users[id]))
+	for _, key := range r.users[id] {
+		v, ok := r.get(key)
+		if !ok {
+			continue
+		}
+		records = append(records, listedRecord{
+			BatchElement: api.BatchElement{
+				OriginalURL:  v.originalURL,
+				ShortURL:     key,
+				ExpiresAt:    v.expiresAt,
+				RedirectCode: v.redirect,
+				Passthrough:  v.passthrough,
+				Deleted:      v.deleted,
+			},
+			createdAt: v.createdAt,
+		})
+	}
+
+	page, next := pageRecords(records, query)
+
+	return page, next, nil
 }
 
-// DeleteRecords delete data from storage.
-func (r MemoryRepository) DeleteRecords(ctx context.Context, deleteItems []api.DeleteItem) error {
+// DeleteRecords marks user's records as deleted.
+// Records which don't belong to user are skipped.
+// For every passed item it returns item with ids of records that are deleted.
+func (r *MemoryRepository) DeleteRecords(ctx context.Context, deleteItems []api.DeleteItem) ([]api.DeleteItem, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	deleted := make([]api.DeleteItem, 0, len(deleteItems))
+	for _, item := range deleteItems {
+		done := api.DeleteItem{UserID: item.UserID, IDs: make([]string, 0, len(item.IDs))}
+		for _, key := range item.IDs {
+			s := r.shard(key)
+			s.mu.Lock()
+			if v, ok := s.records[key]; ok && uuid.Equal(v.userID, item.UserID) {
+				if !v.deleted {
+					v.deleted = true
+					v.deletedAt = now
+				}
+				done.IDs = append(done.IDs, key)
+			}
+			s.mu.Unlock()
+		}
+		deleted = append(deleted, done)
+	}
+
+	return deleted, nil
+}
+
+// DeleteExpired marks records which expiration time has passed by now as deleted.
+// It returns shortenings of deleted records.
+func (r *MemoryRepository) DeleteExpired(ctx context.Context, now time.Time) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	expired := make([]string, 0)
+	for _, s := range r.shards {
+		s.mu.Lock()
+		for key, v := range s.records {
+			if !v.deleted && isExpired(v.expiresAt, now) {
+				v.deleted = true
+				v.deletedAt = now
+				expired = append(expired, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+
+	return expired, nil
+}
+
+// RestoreRecords brings user's deleted records back.
+// Records which don't belong to user or aren't deleted are skipped.
+// For every passed item it returns item with ids of records that are restored.
+func (r *MemoryRepository) RestoreRecords(ctx context.Context, restoreItems []api.DeleteItem) ([]api.DeleteItem, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	restored := make([]api.DeleteItem, 0, len(restoreItems))
+	for _, item := range restoreItems {
+		done := api.DeleteItem{UserID: item.UserID, IDs: make([]string, 0, len(item.IDs))}
+		for _, key := range item.IDs {
+			s := r.shard(key)
+			s.mu.Lock()
+			if v, ok := s.records[key]; ok && uuid.Equal(v.userID, item.UserID) && v.deleted {
+				v.deleted = false
+				v.deletedAt = time.Time{}
+				done.IDs = append(done.IDs, key)
+			}
+			s.mu.Unlock()
+		}
+		restored = append(restored, done)
+	}
+
+	return restored, nil
+}
+
+// PurgeDeleted permanently removes records deleted before passed time together with their history and statistics.
+// It returns shortenings of removed records.
+func (r *MemoryRepository) PurgeDeleted(ctx context.Context, before time.Time) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	purged := make([]string, 0)
+	owners := make(map[uuid.UUID]struct{})
+	for _, s := range r.shards {
+		s.mu.Lock()
+		for key, v := range s.records {
+			if !v.deleted || v.deletedAt.After(before) {
+				continue
+			}
+			delete(s.records, key)
+			if r.originals[v.originalURL] == key {
+				delete(r.originals, v.originalURL)
+			}
+			delete(r.history, key)
+			owners[v.userID] = struct{}{}
+			purged = append(purged, key)
+		}
+		s.mu.Unlock()
+	}
+	if len(purged) == 0 {
+		return purged, nil
+	}
+
+	// drop purged shortenings from users' indexes
+	for userID := range owners {
+		keys := r.users[userID][:0]
+		for _, key := range r.users[userID] {
+			if _, ok := r.get(key); ok {
+				keys = append(keys, key)
+			}
+		}
+		r.users[userID] = keys
+	}
+
+	r.statsMu.Lock()
+	for _, key := range purged {
+		delete(r.stats, key)
+	}
+	r.statsMu.Unlock()
+
+	return purged, nil
+}
+
+// UpdateOriginalURL makes user's shortening lead to another original URL and saves change to history.
+// It returns ErrNotFound if shortening doesn't belong to user, ErrDBRecordDeleted if it was deleted
+// and AlreadyExistError if original URL already has another shortening.
+func (r *MemoryRepository) UpdateOriginalURL(ctx context.Context, userID uuid.UUID, key, originalURL string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.records[key]
+	if !ok || !uuid.Equal(v.userID, userID) {
+		return sherr.ErrNotFound
+	}
+	if v.deleted {
+		return sherr.ErrDBRecordDeleted
+	}
+	if v.originalURL == originalURL {
+		return nil
+	}
+	if existKey, ok := r.originals[originalURL]; ok {
+		return sherr.NewAlreadyExistError(originalURL, existKey)
+	}
+
+	r.history[key] = append(r.history[key], api.URLEdit{OldURL: v.originalURL, NewURL: originalURL, ChangedAt: time.Now()})
+	delete(r.originals, v.originalURL)
+	r.originals[originalURL] = key
+	v.originalURL = originalURL
+
+	return nil
+}
+
+// SelectHistory returns changes of original URL of user's shortening ordered by time.
+// It returns ErrNotFound if shortening doesn't belong to user.
+func (r *MemoryRepository) SelectHistory(ctx context.Context, userID uuid.UUID, key string) ([]api.URLEdit, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if v, ok := r.get(key); !ok || !uuid.Equal(v.userID, userID) {
+		return nil, sherr.ErrNotFound
+	}
+
+	return append(make([]api.URLEdit, 0, len(r.history[key])), r.history[key]...), nil
+}
+
+// SaveClicks adds clicks to counters of shortenings.
+func (r *MemoryRepository) SaveClicks(ctx context.Context, clicks []api.Click) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.statsMu.Lock()
+	defer r.statsMu.Unlock()
+
+	r.stats.add(clicks)
+
+	return nil
+}
+
+// SelectStats returns aggregated clicks by user's shortening.
+// It returns ErrNotFound if shortening doesn't belong to user.
+func (r *MemoryRepository) SelectStats(ctx context.Context, userID uuid.UUID, key string) (api.ClickStats, error) {
+	if err := ctx.Err(); err != nil {
+		return api.ClickStats{}, err
+	}
+
+	// owner of record is changed by MergeUsers with mu locked
+	r.mu.RLock()
+	v, ok := r.get(key)
+	owned := ok && uuid.Equal(v.userID, userID)
+	r.mu.RUnlock()
+	if !owned {
+		return api.ClickStats{}, sherr.ErrNotFound
+	}
+
+	r.statsMu.Lock()
+	defer r.statsMu.Unlock()
+
+	return r.stats.stats(key), nil
+}
+
+// QueueDeletion saves deletion request to queue.
+// Memory storage loses records on restart, so the queue is kept in memory as well.
+func (r *MemoryRepository) QueueDeletion(ctx context.Context, item api.DeleteItem) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.queueMu.Lock()
+	defer r.queueMu.Unlock()
+
+	r.queue = append(r.queue, item)
+
+	return nil
+}
+
+// SelectQueuedDeletions returns deletion requests from queue in order of queueing.
+func (r *MemoryRepository) SelectQueuedDeletions(ctx context.Context) ([]api.DeleteItem, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.queueMu.Lock()
+	defer r.queueMu.Unlock()
+
+	return append(make([]api.DeleteItem, 0, len(r.queue)), r.queue...), nil
+}
+
+// DequeueDeletions removes processed deletion requests from queue.
+func (r *MemoryRepository) DequeueDeletions(ctx context.Context, jobIDs []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.queueMu.Lock()
+	defer r.queueMu.Unlock()
+
+	r.queue = dequeue(r.queue, jobIDs)
+
 	return nil
 }
 
@@ -61,3 +544,204 @@ func (r *MemoryRepository) Close() {}
 
 // Ping satisfies the interface.
 func (r *MemoryRepository) Ping(_ context.Context) error { return nil }
+
+// InsertAPIKey saves API key with hash of its secret.
+func (r *MemoryRepository) InsertAPIKey(ctx context.Context, key authenticator.APIKey, hash string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.keysMu.Lock()
+	defer r.keysMu.Unlock()
+
+	r.keys.insert(key, hash)
+	return nil
+}
+
+// SelectAPIKey returns active API key by hash of its secret.
+// It returns ErrNotFound if key is unknown or revoked.
+func (r *MemoryRepository) SelectAPIKey(ctx context.Context, hash string) (authenticator.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return authenticator.APIKey{}, err
+	}
+
+	r.keysMu.RLock()
+	defer r.keysMu.RUnlock()
+
+	return r.keys.find(hash)
+}
+
+// SelectUserAPIKeys returns user's active API keys ordered by time of issuance.
+func (r *MemoryRepository) SelectUserAPIKeys(ctx context.Context, userID uuid.UUID) ([]authenticator.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.keysMu.RLock()
+	defer r.keysMu.RUnlock()
+
+	return r.keys.user(userID), nil
+}
+
+// RevokeAPIKey revokes user's API key by its id.
+// It returns ErrNotFound if user has no such active key.
+func (r *MemoryRepository) RevokeAPIKey(ctx context.Context, userID uuid.UUID, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.keysMu.Lock()
+	defer r.keysMu.Unlock()
+
+	_, _, err := r.keys.revoke(userID, id)
+	return err
+}
+
+// InsertSession saves session with hash of its refresh token.
+func (r *MemoryRepository) InsertSession(ctx context.Context, session authenticator.Session, hash string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.sessionsMu.Lock()
+	defer r.sessionsMu.Unlock()
+
+	r.sessions.put(session, hash)
+	return nil
+}
+
+// SelectSession returns session by hash of its current refresh token.
+// It returns ErrNotFound if token is unknown or was rotated.
+func (r *MemoryRepository) SelectSession(ctx context.Context, hash string) (authenticator.Session, error) {
+	if err := ctx.Err(); err != nil {
+		return authenticator.Session{}, err
+	}
+
+	r.sessionsMu.Lock()
+	defer r.sessionsMu.Unlock()
+
+	return r.sessions.find(hash)
+}
+
+// RotateSession replaces refresh token of session and prolongs it.
+// It returns ErrNotFound if session is revoked or oldHash is not its current token.
+func (r *MemoryRepository) RotateSession(ctx context.Context, id, oldHash, newHash string, expiresAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.sessionsMu.Lock()
+	defer r.sessionsMu.Unlock()
+
+	_, err := r.sessions.rotate(id, oldHash, newHash, expiresAt)
+	return err
+}
+
+// RevokeSession marks session as revoked. It returns ErrNotFound if session is unknown.
+func (r *MemoryRepository) RevokeSession(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.sessionsMu.Lock()
+	defer r.sessionsMu.Unlock()
+
+	_, _, err := r.sessions.revoke(id, time.Now())
+	return err
+}
+
+// SelectRevokedSessions returns ids of sessions revoked after since.
+func (r *MemoryRepository) SelectRevokedSessions(ctx context.Context, since time.Time) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.sessionsMu.Lock()
+	defer r.sessionsMu.Unlock()
+
+	return r.sessions.revokedSince(since), nil
+}
+
+// PurgeSessions removes sessions which expired or were revoked before time before.
+func (r *MemoryRepository) PurgeSessions(ctx context.Context, before time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.sessionsMu.Lock()
+	defer r.sessionsMu.Unlock()
+
+	r.sessions.purge(before)
+	return nil
+}
+
+// InsertAccount saves account with hash of its password.
+// It returns ErrUsernameTaken if username or user id has account already.
+func (r *MemoryRepository) InsertAccount(ctx context.Context, account authenticator.Account, passwordHash string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.accountsMu.Lock()
+	defer r.accountsMu.Unlock()
+
+	return r.accounts.insert(account, passwordHash)
+}
+
+// SelectAccount returns account with hash of its password by username or ErrNotFound.
+func (r *MemoryRepository) SelectAccount(ctx context.Context, username string) (authenticator.Account, string, error) {
+	if err := ctx.Err(); err != nil {
+		return authenticator.Account{}, "", err
+	}
+
+	r.accountsMu.RLock()
+	defer r.accountsMu.RUnlock()
+
+	return r.accounts.find(username)
+}
+
+// SelectUserAccount returns account of user or ErrNotFound if user is anonymous.
+func (r *MemoryRepository) SelectUserAccount(ctx context.Context, userID uuid.UUID) (authenticator.Account, error) {
+	if err := ctx.Err(); err != nil {
+		return authenticator.Account{}, err
+	}
+
+	r.accountsMu.RLock()
+	defer r.accountsMu.RUnlock()
+
+	return r.accounts.user(userID)
+}
+
+// MergeUsers reassigns shortenings and API keys of user from to user to and revokes sessions of user from.
+// It returns number of reassigned shortenings.
+func (r *MemoryRepository) MergeUsers(ctx context.Context, from, to uuid.UUID) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for _, key := range r.users[from] {
+		s := r.shard(key)
+		s.mu.Lock()
+		if v, ok := s.records[key]; ok && uuid.Equal(v.userID, from) {
+			v.userID = to
+			r.users[to] = append(r.users[to], key)
+			n++
+		}
+		s.mu.Unlock()
+	}
+	delete(r.users, from)
+
+	r.keysMu.Lock()
+	r.keys.merge(from, to)
+	r.keysMu.Unlock()
+
+	r.sessionsMu.Lock()
+	r.sessions.revokeUser(from, time.Now())
+	r.sessionsMu.Unlock()
+
+	return n, nil
+}
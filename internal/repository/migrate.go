@@ -0,0 +1,234 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Alena-Kurushkina/shortener/internal/logger"
+	"github.com/Alena-Kurushkina/shortener/internal/sherr"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// SQL dialects of supported databases.
+const (
+	dialectPostgres = "postgres"
+	dialectSQLite   = "sqlite"
+)
+
+// migrationName matches migration file name like 0001_create_table.up.sql.
+// Script which differs in some dialect has variant like 0001_create_table.sqlite.up.sql
+// which is used instead of common script for that dialect.
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+?)(?:\.(postgres|sqlite))?\.(up|down)\.sql$`)
+
+// A migration is a pair of SQL scripts which move database schema to version and back.
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// loadMigrations reads embedded migration files of dialect and returns them ordered by version.
+func loadMigrations(dialect string) ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*migration)
+	for _, entry := range entries {
+		parts := migrationName.FindStringSubmatch(entry.Name())
+		if parts == nil {
+			return nil, fmt.Errorf("invalid migration file name %s", entry.Name())
+		}
+		version, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		if parts[3] != "" && parts[3] != dialect {
+			continue
+		}
+		script, err := migrationFiles.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: parts[2]}
+			byVersion[version] = m
+		}
+		// dialect variant takes precedence over common script
+		target := &m.up
+		if parts[4] == "down" {
+			target = &m.down
+		}
+		if *target == "" || parts[3] != "" {
+			*target = string(script)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %d must have both up and down scripts", m.version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+
+	for i, m := range migrations {
+		if m.version != i+1 {
+			return nil, fmt.Errorf("migration %d is missing", i+1)
+		}
+	}
+
+	return migrations, nil
+}
+
+// schemaVersion returns version of database schema.
+// Version 0 means that no migrations were applied.
+func schemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_version(
+			version integer PRIMARY KEY,
+			applied_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return 0, err
+	}
+
+	var version sql.NullInt64
+	if err = db.QueryRowContext(ctx, `SELECT max(version) FROM schema_version`).Scan(&version); err != nil {
+		return 0, err
+	}
+
+	return int(version.Int64), nil
+}
+
+// applyMigration runs script and records new schema version in one transaction.
+func applyMigration(ctx context.Context, db *sql.DB, script, versionStmt string, version int) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, versionStmt, version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// migrateUp applies all migrations which are newer than database schema.
+// It returns ErrUnknownSchemaVersion if database schema is newer than the latest known migration.
+func migrateUp(ctx context.Context, db *sql.DB, dialect string) error {
+	migrations, err := loadMigrations(dialect)
+	if err != nil {
+		return err
+	}
+	current, err := schemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+	if current > len(migrations) {
+		return fmt.Errorf("%w: database has version %d, the latest known is %d", sherr.ErrUnknownSchemaVersion, current, len(migrations))
+	}
+
+	for _, m := range migrations[current:] {
+		if err = applyMigration(ctx, db, m.up, `INSERT INTO schema_version (version) VALUES ($1)`, m.version); err != nil {
+			return fmt.Errorf("migration %d_%s failed: %w", m.version, m.name, err)
+		}
+		logger.Log.Infof("Migration %d_%s applied", m.version, m.name)
+	}
+
+	return nil
+}
+
+// migrateDown reverts the latest applied migration.
+func migrateDown(ctx context.Context, db *sql.DB, dialect string) error {
+	migrations, err := loadMigrations(dialect)
+	if err != nil {
+		return err
+	}
+	current, err := schemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+	if current == 0 {
+		return nil
+	}
+	if current > len(migrations) {
+		return fmt.Errorf("%w: database has version %d, the latest known is %d", sherr.ErrUnknownSchemaVersion, current, len(migrations))
+	}
+
+	m := migrations[current-1]
+	if err = applyMigration(ctx, db, m.down, `DELETE FROM schema_version WHERE version = $1`, m.version); err != nil {
+		return fmt.Errorf("migration %d_%s revert failed: %w", m.version, m.name, err)
+	}
+	logger.Log.Infof("Migration %d_%s reverted", m.version, m.name)
+
+	return nil
+}
+
+// openDatabase opens PostgreSQL or SQLite database depending on connection string
+// and returns it with its SQL dialect.
+func openDatabase(connectionStr string) (*sql.DB, string, error) {
+	if path, ok := strings.CutPrefix(connectionStr, sqliteScheme); ok {
+		db, err := openSQLite(path)
+		return db, dialectSQLite, err
+	}
+	db, err := sql.Open("pgx", connectionStr)
+	return db, dialectPostgres, err
+}
+
+// Migrate runs migration command against database defined by connection string.
+// Command up applies all new migrations, down reverts the latest one,
+// status prints current and the latest known schema versions to out.
+func Migrate(ctx context.Context, connectionStr, command string, out io.Writer) error {
+	db, dialect, err := openDatabase(connectionStr)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch command {
+	case "up":
+		err = migrateUp(ctx, db, dialect)
+	case "down":
+		err = migrateDown(ctx, db, dialect)
+	case "status":
+	default:
+		return fmt.Errorf("unknown migrate command %q, use up, down or status", command)
+	}
+	if err != nil {
+		return err
+	}
+
+	migrations, err := loadMigrations(dialect)
+	if err != nil {
+		return err
+	}
+	current, err := schemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Schema version: %d, latest known: %d\n", current, len(migrations))
+
+	return nil
+}
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS shortening(
+	id varchar(50) PRIMARY KEY default substring(md5(random()::text),0,20),
+	originalURL varchar(500) NOT NULL,
+	shortURL varchar(250) NOT NULL,
+	userUUID uuid,
+	is_deleted bool DEFAULT(false),
+	UNIQUE (originalURL)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS short_idx on shortening (shortURL);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS user_created_idx;
+ALTER TABLE shortening DROP COLUMN IF EXISTS created_at;
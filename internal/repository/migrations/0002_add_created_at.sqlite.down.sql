@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS shortening_created_at;
+DROP INDEX IF EXISTS user_created_idx;
+ALTER TABLE shortening DROP COLUMN created_at;
@@ -0,0 +1,10 @@
+-- SQLite can't add column with non-constant default, so creation time is set by trigger.
+-- SQLite compares times as text, so they are kept in the format used for time parameters.
+ALTER TABLE shortening ADD COLUMN created_at timestamp NOT NULL DEFAULT 0;
+UPDATE shortening SET created_at = strftime('%Y-%m-%d %H:%M:%S+00:00', 'now');
+CREATE TRIGGER IF NOT EXISTS shortening_created_at AFTER INSERT ON shortening
+	WHEN NEW.created_at = 0
+	BEGIN
+		UPDATE shortening SET created_at = strftime('%Y-%m-%d %H:%M:%S+00:00', 'now') WHERE rowid = NEW.rowid;
+	END;
+CREATE INDEX IF NOT EXISTS user_created_idx on shortening (userUUID, created_at);
@@ -0,0 +1,2 @@
+ALTER TABLE shortening ADD COLUMN IF NOT EXISTS created_at timestamptz NOT NULL DEFAULT now();
+CREATE INDEX IF NOT EXISTS user_created_idx on shortening (userUUID, created_at);
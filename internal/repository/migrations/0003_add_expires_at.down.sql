@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS expires_idx;
+ALTER TABLE shortening DROP COLUMN IF EXISTS expires_at;
@@ -0,0 +1,2 @@
+ALTER TABLE shortening ADD COLUMN expires_at timestamp;
+CREATE INDEX IF NOT EXISTS expires_idx on shortening (expires_at) WHERE expires_at IS NOT NULL AND NOT is_deleted;
@@ -0,0 +1,2 @@
+ALTER TABLE shortening ADD COLUMN IF NOT EXISTS expires_at timestamptz;
+CREATE INDEX IF NOT EXISTS expires_idx on shortening (expires_at) WHERE expires_at IS NOT NULL AND NOT is_deleted;
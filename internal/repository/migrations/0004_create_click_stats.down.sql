@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS click_sources;
+DROP TABLE IF EXISTS click_visitors;
+DROP TABLE IF EXISTS click_stats;
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS click_stats(
+	shortURL varchar(250) NOT NULL,
+	day date NOT NULL,
+	clicks bigint NOT NULL DEFAULT 0,
+	PRIMARY KEY (shortURL, day)
+);
+CREATE TABLE IF NOT EXISTS click_visitors(
+	shortURL varchar(250) NOT NULL,
+	day date NOT NULL,
+	ip_hash varchar(64) NOT NULL,
+	PRIMARY KEY (shortURL, day, ip_hash)
+);
+CREATE TABLE IF NOT EXISTS click_sources(
+	shortURL varchar(250) NOT NULL,
+	kind varchar(16) NOT NULL,
+	value varchar(256) NOT NULL,
+	clicks bigint NOT NULL DEFAULT 0,
+	PRIMARY KEY (shortURL, kind, value)
+);
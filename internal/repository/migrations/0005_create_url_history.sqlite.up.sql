@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS url_history(
+	shortURL varchar(250) NOT NULL,
+	old_url varchar(500) NOT NULL,
+	new_url varchar(500) NOT NULL,
+	changed_at timestamp NOT NULL
+);
+CREATE INDEX IF NOT EXISTS history_short_idx on url_history (shortURL, changed_at);
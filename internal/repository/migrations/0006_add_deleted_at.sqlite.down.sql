@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS deleted_idx;
+ALTER TABLE shortening DROP COLUMN deleted_at;
@@ -0,0 +1,4 @@
+ALTER TABLE shortening ADD COLUMN IF NOT EXISTS deleted_at timestamptz;
+-- time of earlier deletions is unknown, retention period of them starts now
+UPDATE shortening SET deleted_at = now() WHERE is_deleted AND deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS deleted_idx on shortening (deleted_at) WHERE is_deleted;
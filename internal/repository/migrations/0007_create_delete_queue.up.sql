@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS delete_queue(
+	job_id varchar(36) PRIMARY KEY,
+	userUUID uuid NOT NULL,
+	ids text NOT NULL,
+	queued_at timestamptz NOT NULL
+);
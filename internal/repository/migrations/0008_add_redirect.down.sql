@@ -0,0 +1,2 @@
+ALTER TABLE shortening DROP COLUMN IF EXISTS query_passthrough;
+ALTER TABLE shortening DROP COLUMN IF EXISTS redirect_code;
@@ -0,0 +1,2 @@
+ALTER TABLE shortening DROP COLUMN query_passthrough;
+ALTER TABLE shortening DROP COLUMN redirect_code;
@@ -0,0 +1,2 @@
+ALTER TABLE shortening ADD COLUMN redirect_code integer NOT NULL DEFAULT 0;
+ALTER TABLE shortening ADD COLUMN query_passthrough boolean NOT NULL DEFAULT false;
@@ -0,0 +1,2 @@
+ALTER TABLE shortening ADD COLUMN IF NOT EXISTS redirect_code integer NOT NULL DEFAULT 0;
+ALTER TABLE shortening ADD COLUMN IF NOT EXISTS query_passthrough boolean NOT NULL DEFAULT false;
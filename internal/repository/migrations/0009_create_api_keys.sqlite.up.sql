@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS api_keys(
+	id varchar(36) PRIMARY KEY,
+	userUUID uuid NOT NULL,
+	key_hash varchar(64) NOT NULL UNIQUE,
+	name text NOT NULL DEFAULT '',
+	scopes text NOT NULL,
+	created_at timestamp NOT NULL,
+	revoked_at timestamp
+);
+CREATE INDEX IF NOT EXISTS api_keys_user_idx ON api_keys (userUUID);
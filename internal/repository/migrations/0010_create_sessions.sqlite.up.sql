@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS sessions(
+	id varchar(36) PRIMARY KEY,
+	userUUID uuid NOT NULL,
+	token_hash varchar(64) NOT NULL UNIQUE,
+	expires_at timestamp NOT NULL,
+	created_at timestamp NOT NULL,
+	revoked_at timestamp
+);
+CREATE INDEX IF NOT EXISTS sessions_revoked_idx ON sessions (revoked_at);
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS users(
+	userUUID uuid PRIMARY KEY,
+	username varchar(64) NOT NULL UNIQUE,
+	password_hash text NOT NULL,
+	created_at timestamp NOT NULL
+);
@@ -3,6 +3,9 @@ package repository
 
 import (
 	"context"
+	"sort"
+	"strings"
+	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 
@@ -12,15 +15,176 @@ import (
 )
 
 // NewRepository defines data storage depending on passed config parameters.
+// Storage is wrapped with cache if cache size is set, counters of cache are published by expvar.
 func NewRepository(ctx context.Context, config *config.Config) (api.Storager, error) {
+	repo, err := newStorage(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	if config.CacheSize > 0 {
+		logger.Log.Infof("Cache of %d shortenings is used", config.CacheSize)
+		cached := withCache(repo, config.CacheSize, config.CacheTTL.Duration)
+		cached.publish()
+		return cached, nil
+	}
+	return repo, nil
+}
+
+// newStorage creates data storage depending on passed config parameters.
+func newStorage(ctx context.Context, config *config.Config) (api.Storager, error) {
+	if strings.HasPrefix(config.ConnectionStr, sqliteScheme) {
+		logger.Log.Info("SQLite database is used as data storage")
+		return newSQLiteRepository(ctx, config.ConnectionStr)
+	}
 	if config.ConnectionStr != "" {
 		logger.Log.Info("Database is used as data storage")
 		return newDBRepository(ctx, config.ConnectionStr)
 	}
 	if config.FileStoragePath != "" {
 		logger.Log.Info("File is used as data storage")
-		return newFileRepository(config.FileStoragePath)
+		return newFileRepository(config)
 	}
 	logger.Log.Info("Memory is used as data storage")
 	return newMemoryRepository()
 }
+
+// isExpired reports whether shortening with expiration time expiresAt is expired by now.
+// Shortening with no expiration time never expires.
+func isExpired(expiresAt *time.Time, now time.Time) bool {
+	return expiresAt != nil && !now.Before(*expiresAt)
+}
+
+// clickDay returns beginning of UTC day of click time.
+func clickDay(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// A dayCounter keeps number of clicks by shortening during one day and hashes of addresses of its visitors.
+type dayCounter struct {
+	Clicks   int64               `json:"clicks"`
+	Visitors map[string]struct{} `json:"visitors,omitempty"`
+}
+
+// A shorteningCounters keeps aggregated clicks by one shortening.
+type shorteningCounters struct {
+	Days       map[time.Time]*dayCounter `json:"days"`
+	Referrers  map[string]int64          `json:"referrers,omitempty"`
+	UserAgents map[string]int64          `json:"user_agents,omitempty"`
+}
+
+// clickCounters keeps aggregated clicks by shortenings.
+type clickCounters map[string]*shorteningCounters
+
+// shortening returns counters of shortening, creating them if they don't exist.
+func (c clickCounters) shortening(key string) *shorteningCounters {
+	counters, ok := c[key]
+	if !ok {
+		counters = &shorteningCounters{
+			Days:       make(map[time.Time]*dayCounter),
+			Referrers:  make(map[string]int64),
+			UserAgents: make(map[string]int64),
+		}
+		c[key] = counters
+	}
+	return counters
+}
+
+// day returns counter of day, creating it if it doesn't exist.
+func (c *shorteningCounters) day(day time.Time) *dayCounter {
+	counter, ok := c.Days[day]
+	if !ok {
+		counter = &dayCounter{Visitors: make(map[string]struct{})}
+		c.Days[day] = counter
+	}
+	return counter
+}
+
+// add counts clicks.
+func (c clickCounters) add(clicks []api.Click) {
+	for _, v := range clicks {
+		counters := c.shortening(v.ShortURL)
+		day := counters.day(clickDay(v.Time))
+		day.Clicks++
+		if v.IPHash != "" {
+			day.Visitors[v.IPHash] = struct{}{}
+		}
+		counters.Referrers[v.Referrer]++
+		counters.UserAgents[v.UserAgent]++
+	}
+}
+
+// merge adds counters of other to c.
+func (c clickCounters) merge(other clickCounters) {
+	for key, v := range other {
+		counters := c.shortening(key)
+		for day, dv := range v.Days {
+			counter := counters.day(day)
+			counter.Clicks += dv.Clicks
+			for hash := range dv.Visitors {
+				counter.Visitors[hash] = struct{}{}
+			}
+		}
+		for referrer, n := range v.Referrers {
+			counters.Referrers[referrer] += n
+		}
+		for userAgent, n := range v.UserAgents {
+			counters.UserAgents[userAgent] += n
+		}
+	}
+}
+
+// stats returns aggregated clicks by shortening.
+func (c clickCounters) stats(key string) api.ClickStats {
+	counters, ok := c[key]
+	if !ok {
+		return api.ClickStats{Days: []api.DayClicks{}, Referrers: []api.SourceClicks{}, UserAgents: []api.SourceClicks{}}
+	}
+
+	days := make([]api.DayClicks, 0, len(counters.Days))
+	for day, v := range counters.Days {
+		days = append(days, api.DayClicks{Day: day, Clicks: v.Clicks, Visitors: int64(len(v.Visitors))})
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Day.Before(days[j].Day) })
+
+	return api.ClickStats{
+		Days:       days,
+		Referrers:  topSources(counters.Referrers),
+		UserAgents: topSources(counters.UserAgents),
+	}
+}
+
+// topSources returns api.TopSources counters with the most clicks ordered by clicks and value.
+func topSources(counters map[string]int64) []api.SourceClicks {
+	result := make([]api.SourceClicks, 0, len(counters))
+	for value, clicks := range counters {
+		result = append(result, api.SourceClicks{Value: value, Clicks: clicks})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Clicks != result[j].Clicks {
+			return result[i].Clicks > result[j].Clicks
+		}
+		return result[i].Value < result[j].Value
+	})
+	if len(result) > api.TopSources {
+		result = result[:api.TopSources]
+	}
+	return result
+}
+
+// dequeue returns queued deletion requests without requests of passed jobs.
+func dequeue(queue []api.DeleteItem, jobIDs []string) []api.DeleteItem {
+	processed := make(map[string]struct{}, len(jobIDs))
+	for _, id := range jobIDs {
+		processed[id] = struct{}{}
+	}
+
+	rest := queue[:0]
+	for _, item := range queue {
+		if _, ok := processed[item.JobID]; !ok {
+			rest = append(rest, item)
+		}
+	}
+
+	return rest
+}
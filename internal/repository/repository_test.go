@@ -0,0 +1,387 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Alena-Kurushkina/shortener/internal/api"
+	"github.com/Alena-Kurushkina/shortener/internal/authenticator"
+	"github.com/Alena-Kurushkina/shortener/internal/config"
+	"github.com/Alena-Kurushkina/shortener/internal/repository/storagetest"
+	"github.com/Alena-Kurushkina/shortener/internal/sherr"
+)
+
+func TestMemoryRepository(t *testing.T) {
+	storagetest.Run(t, func() api.Storager {
+		repo, err := newMemoryRepository()
+		require.NoError(t, err)
+		return repo
+	})
+}
+
+// TestMemoryRepositoryMergeDuringStats is meaningful with -race,
+// owner of record is read by SelectStats while MergeUsers changes it.
+func TestMemoryRepositoryMergeDuringStats(t *testing.T) {
+	ctx := context.Background()
+	from, to := uuid.NewV4(), uuid.NewV4()
+
+	repo, err := newMemoryRepository()
+	require.NoError(t, err)
+	defer repo.Close()
+	require.NoError(t, repo.Insert(ctx, from, "short1", "http://site.ru/1", api.LinkOptions{}))
+
+	done := make(chan struct{})
+	go func(userID uuid.UUID) {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			_, _ = repo.SelectStats(ctx, userID, "short1")
+		}
+	}(from)
+	owner, other := from, to
+	for i := 0; i < 1000; i++ {
+		_, err = repo.MergeUsers(ctx, owner, other)
+		require.NoError(t, err)
+		owner, other = other, owner
+	}
+	<-done
+
+	_, err = repo.SelectStats(ctx, owner, "short1")
+	assert.NoError(t, err)
+}
+
+func TestFileRepository(t *testing.T) {
+	for _, policy := range []string{SyncAlways, SyncInterval, SyncNever} {
+		t.Run(policy, func(t *testing.T) {
+			storagetest.Run(t, func() api.Storager {
+				cfg := &config.Config{}
+				cfg.FileStoragePath = filepath.Join(t.TempDir(), "storage.json")
+				cfg.FileSyncPolicy = policy
+				cfg.FileSyncInterval.Duration = 10 * time.Millisecond
+				cfg.FileCompactInterval.Duration = 10 * time.Millisecond
+				cfg.FileCompactThreshold = 5
+
+				repo, err := newFileRepository(cfg)
+				require.NoError(t, err)
+				return repo
+			})
+		})
+	}
+}
+
+func TestFileRepositoryReload(t *testing.T) {
+	ctx := context.Background()
+	user := uuid.NewV4()
+
+	cfg := &config.Config{}
+	cfg.FileStoragePath = filepath.Join(t.TempDir(), "storage.json")
+	cfg.FileSyncPolicy = SyncAlways
+	cfg.FileCompactInterval.Duration = 10 * time.Millisecond
+	cfg.FileCompactThreshold = 3
+
+	repo, err := newFileRepository(cfg)
+	require.NoError(t, err)
+	require.NoError(t, repo.Insert(ctx, user, "short1", "http://site.ru/1", api.LinkOptions{}))
+	require.NoError(t, repo.Insert(ctx, user, "short2", "http://site.ru/2", api.LinkOptions{}))
+	_, err = repo.DeleteRecords(ctx, []api.DeleteItem{{UserID: user, IDs: []string{"short1"}}})
+	require.NoError(t, err)
+	require.NoError(t, repo.UpdateOriginalURL(ctx, user, "short2", "http://site.ru/2new"))
+
+	// wait for compaction
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(snapshotPath(cfg.FileStoragePath))
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, repo.Insert(ctx, user, "short3", "http://site.ru/3", api.LinkOptions{}))
+	require.NoError(t, repo.SaveClicks(ctx, []api.Click{{ShortURL: "short3", Time: time.Now(), Referrer: "blog.ru", IPHash: "ip"}}))
+	require.NoError(t, repo.Insert(ctx, user, "short5", "http://site.ru/5", api.LinkOptions{}))
+	require.NoError(t, repo.Insert(ctx, user, "short6", "http://site.ru/6", api.LinkOptions{}))
+	_, err = repo.DeleteRecords(ctx, []api.DeleteItem{{UserID: user, IDs: []string{"short5", "short6"}}})
+	require.NoError(t, err)
+	purged, err := repo.PurgeDeleted(ctx, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"short1", "short5", "short6"}, purged)
+	restored, err := repo.RestoreRecords(ctx, []api.DeleteItem{{UserID: user, IDs: []string{"short6"}}})
+	require.NoError(t, err)
+	assert.Empty(t, restored[0].IDs)
+	require.NoError(t, repo.Insert(ctx, user, "short7", "http://site.ru/7", api.LinkOptions{}))
+	_, err = repo.DeleteRecords(ctx, []api.DeleteItem{{UserID: user, IDs: []string{"short7"}}})
+	require.NoError(t, err)
+	queued := api.DeleteItem{JobID: "job", UserID: user, IDs: []string{"short2"}}
+	require.NoError(t, repo.QueueDeletion(ctx, queued))
+	key := authenticator.APIKey{ID: "key", Scopes: []string{authenticator.ScopeRead}, CreatedAt: time.Now().UTC(), UserID: user}
+	require.NoError(t, repo.InsertAPIKey(ctx, key, "hash"))
+	require.NoError(t, repo.InsertAPIKey(ctx, authenticator.APIKey{ID: "revoked", UserID: user}, "revoked hash"))
+	require.NoError(t, repo.RevokeAPIKey(ctx, user, "revoked"))
+	session := authenticator.Session{ID: "session", UserID: user, ExpiresAt: time.Now().Add(time.Hour).UTC()}
+	require.NoError(t, repo.InsertSession(ctx, session, "session hash"))
+	require.NoError(t, repo.RotateSession(ctx, session.ID, "session hash", "rotated hash", session.ExpiresAt))
+	require.NoError(t, repo.InsertSession(ctx, authenticator.Session{ID: "revoked", UserID: user, ExpiresAt: session.ExpiresAt}, "revoked session hash"))
+	require.NoError(t, repo.RevokeSession(ctx, "revoked"))
+	anonymous := uuid.NewV4()
+	require.NoError(t, repo.Insert(ctx, anonymous, "short8", "http://site.ru/8", api.LinkOptions{}))
+	require.NoError(t, repo.InsertSession(ctx, authenticator.Session{ID: "anonymous", UserID: anonymous, ExpiresAt: session.ExpiresAt}, "anonymous session hash"))
+	account := authenticator.Account{UserID: user, Username: "alice", CreatedAt: time.Now().UTC()}
+	require.NoError(t, repo.InsertAccount(ctx, account, "password hash"))
+	merged, err := repo.MergeUsers(ctx, anonymous, user)
+	require.NoError(t, err)
+	assert.Equal(t, 1, merged)
+	repo.Close()
+	assert.NotPanics(t, repo.Close)
+
+	// simulate interrupted write
+	file, err := os.OpenFile(cfg.FileStoragePath, os.O_WRONLY|os.O_APPEND, 0666)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"uuid":"` + user.String() + `","short_u`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	repo, err = newFileRepository(cfg)
+	require.NoError(t, err)
+	defer repo.Close()
+
+	for _, key := range []string{"short1", "short5", "short6"} {
+		_, err = repo.Select(ctx, key)
+		assert.ErrorIs(t, err, sherr.ErrNotFound)
+	}
+	_, err = repo.Select(ctx, "short7")
+	assert.ErrorIs(t, err, sherr.ErrDBRecordDeleted)
+	restored, err = repo.RestoreRecords(ctx, []api.DeleteItem{{UserID: user, IDs: []string{"short7"}}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"short7"}, restored[0].IDs)
+
+	records, err := repo.SelectUserAll(ctx, user)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []api.BatchElement{
+		{OriginalURL: "http://site.ru/2new", ShortURL: "short2"},
+		{OriginalURL: "http://site.ru/3", ShortURL: "short3"},
+		{OriginalURL: "http://site.ru/7", ShortURL: "short7"},
+		{OriginalURL: "http://site.ru/8", ShortURL: "short8"},
+	}, records)
+	records, err = repo.SelectUserAll(ctx, anonymous)
+	require.NoError(t, err)
+	assert.Empty(t, records)
+
+	gotAccount, hash, err := repo.SelectAccount(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, account, gotAccount)
+	assert.Equal(t, "password hash", hash)
+
+	items, err := repo.SelectQueuedDeletions(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []api.DeleteItem{queued}, items)
+
+	keys, err := repo.SelectUserAPIKeys(ctx, user)
+	require.NoError(t, err)
+	assert.Equal(t, []authenticator.APIKey{key}, keys)
+
+	_, err = repo.SelectSession(ctx, "session hash")
+	assert.ErrorIs(t, err, sherr.ErrNotFound)
+	got, err := repo.SelectSession(ctx, "rotated hash")
+	require.NoError(t, err)
+	assert.Equal(t, session, got)
+	ids, err := repo.SelectRevokedSessions(ctx, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"revoked", "anonymous"}, ids)
+
+	history, err := repo.SelectHistory(ctx, user, "short2")
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, "http://site.ru/2", history[0].OldURL)
+
+	stats, err := repo.SelectStats(ctx, user, "short3")
+	require.NoError(t, err)
+	require.Len(t, stats.Days, 1)
+	assert.Equal(t, int64(1), stats.Days[0].Clicks)
+	assert.Equal(t, int64(1), stats.Days[0].Visitors)
+	assert.Equal(t, []api.SourceClicks{{Value: "blog.ru", Clicks: 1}}, stats.Referrers)
+
+	require.NoError(t, repo.Insert(ctx, user, "short4", "http://site.ru/4", api.LinkOptions{}))
+	longURL, err := repo.Select(ctx, "short4")
+	require.NoError(t, err)
+	assert.Equal(t, "http://site.ru/4", longURL.OriginalURL)
+}
+
+// TestDBRepository runs against database defined by TEST_DATABASE_DSN environment variable.
+// Tables are truncated before every subtest.
+// Without TEST_DATABASE_DSN the test is skipped, so queries specific to PostgreSQL
+// (unnest of uuid arrays, SELECT ... FOR UPDATE, detection of short_idx conflicts)
+// are not checked by default, TestSQLiteRepository covers only their SQLite versions.
+func TestFileRepositoryWritesDuringCompaction(t *testing.T) {
+	ctx := context.Background()
+	user := uuid.NewV4()
+
+	cfg := &config.Config{}
+	cfg.FileStoragePath = filepath.Join(t.TempDir(), "storage.json")
+	cfg.FileSyncPolicy = SyncNever
+	cfg.FileCompactInterval.Duration = time.Millisecond
+	cfg.FileCompactThreshold = 10
+
+	repo, err := newFileRepository(cfg)
+	require.NoError(t, err)
+	for i := 0; i < 500; i++ {
+		key := "short" + strconv.Itoa(i)
+		require.NoError(t, repo.Insert(ctx, user, key, "http://site.ru/"+key, api.LinkOptions{}))
+		if i%3 == 0 {
+			require.NoError(t, repo.UpdateOriginalURL(ctx, user, key, "http://site.ru/new/"+key))
+		}
+	}
+	repo.Close()
+
+	// records written while snapshot was written are kept in new log
+	repo, err = newFileRepository(cfg)
+	require.NoError(t, err)
+	defer repo.Close()
+
+	records, err := repo.SelectUserAll(ctx, user)
+	require.NoError(t, err)
+	assert.Len(t, records, 500)
+	for i := 0; i < 500; i += 3 {
+		key := "short" + strconv.Itoa(i)
+		redirect, err := repo.Select(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, "http://site.ru/new/"+key, redirect.OriginalURL)
+	}
+}
+
+func TestFileRepositoryLongSnapshotRecord(t *testing.T) {
+	ctx := context.Background()
+	user := uuid.NewV4()
+
+	cfg := &config.Config{}
+	cfg.FileStoragePath = filepath.Join(t.TempDir(), "storage.json")
+	cfg.FileSyncPolicy = SyncAlways
+
+	// record is longer than default token of bufio.Scanner
+	rec := record{UUID: user, ShortURL: "short1", OriginalURL: "http://site.ru/1"}
+	for i := 0; i < 1000; i++ {
+		rec.History = append(rec.History, api.URLEdit{OldURL: "http://site.ru/" + strings.Repeat("x", 100), ChangedAt: time.Now().UTC()})
+	}
+	data, err := json.Marshal(rec)
+	require.NoError(t, err)
+	require.Greater(t, len(data), 64*1024)
+	require.NoError(t, os.WriteFile(snapshotPath(cfg.FileStoragePath), append(data, '\n'), 0666))
+
+	repo, err := newFileRepository(cfg)
+	require.NoError(t, err)
+	defer repo.Close()
+
+	history, err := repo.SelectHistory(ctx, user, "short1")
+	require.NoError(t, err)
+	assert.Len(t, history, 1000)
+}
+
+func TestFileRepositoryStatsLog(t *testing.T) {
+	ctx := context.Background()
+	user := uuid.NewV4()
+
+	cfg := &config.Config{}
+	cfg.FileStoragePath = filepath.Join(t.TempDir(), "storage.json")
+	cfg.FileSyncPolicy = SyncAlways
+
+	repo, err := newFileRepository(cfg)
+	require.NoError(t, err)
+	require.NoError(t, repo.Insert(ctx, user, "short1", "http://site.ru/1", api.LinkOptions{}))
+	day := time.Date(2024, time.March, 1, 10, 0, 0, 0, time.UTC)
+	for _, hash := range []string{"ip1", "ip2", "ip1"} {
+		require.NoError(t, repo.SaveClicks(ctx, []api.Click{{ShortURL: "short1", Time: day, IPHash: hash}}))
+	}
+	repo.Close()
+
+	// every batch is appended as line of counters
+	data, err := os.ReadFile(statsPath(cfg.FileStoragePath))
+	require.NoError(t, err)
+	assert.Equal(t, 3, strings.Count(string(data), "\n"))
+
+	// simulate interrupted write
+	file, err := os.OpenFile(statsPath(cfg.FileStoragePath), os.O_WRONLY|os.O_APPEND, 0666)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"short1":{"da`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	repo, err = newFileRepository(cfg)
+	require.NoError(t, err)
+	defer repo.Close()
+
+	// log is replaced by one line of loaded counters
+	data, err = os.ReadFile(statsPath(cfg.FileStoragePath))
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(data), "\n"))
+
+	require.NoError(t, repo.SaveClicks(ctx, []api.Click{{ShortURL: "short1", Time: day, IPHash: "ip3"}}))
+	stats, err := repo.SelectStats(ctx, user, "short1")
+	require.NoError(t, err)
+	require.Len(t, stats.Days, 1)
+	assert.Equal(t, int64(4), stats.Days[0].Clicks)
+	assert.Equal(t, int64(3), stats.Days[0].Visitors)
+}
+
+func TestDBRepository(t *testing.T) {
+	dsn, ok := os.LookupEnv("TEST_DATABASE_DSN")
+	if !ok {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	storagetest.Run(t, func() api.Storager {
+		repo, err := openDBRepository(context.Background(), dsn)
+		require.NoError(t, err)
+
+		_, err = repo.database.Exec("TRUNCATE shortening, click_stats, click_visitors, click_sources, url_history, delete_queue, api_keys, sessions, users")
+		require.NoError(t, err)
+
+		return repo
+	})
+}
+
+func TestSQLiteRepository(t *testing.T) {
+	storagetest.Run(t, func() api.Storager {
+		repo, err := newSQLiteRepository(context.Background(), sqliteScheme+filepath.Join(t.TempDir(), "shortener.db"))
+		require.NoError(t, err)
+		return repo
+	})
+}
+
+func TestSQLiteMigrateDown(t *testing.T) {
+	ctx := context.Background()
+	dsn := sqliteScheme + filepath.Join(t.TempDir(), "shortener.db")
+
+	var out strings.Builder
+	require.NoError(t, Migrate(ctx, dsn, "up", &out))
+
+	migrations, err := loadMigrations(dialectSQLite)
+	require.NoError(t, err)
+	for range migrations {
+		require.NoError(t, Migrate(ctx, dsn, "down", &out))
+	}
+	require.NoError(t, Migrate(ctx, dsn, "up", &out))
+
+	out.Reset()
+	require.NoError(t, Migrate(ctx, dsn, "status", &out))
+	assert.Contains(t, out.String(), "Schema version: "+strconv.Itoa(len(migrations)))
+}
+
+func TestLoadMigrations(t *testing.T) {
+	for _, dialect := range []string{dialectPostgres, dialectSQLite} {
+		migrations, err := loadMigrations(dialect)
+		require.NoError(t, err)
+		require.NotEmpty(t, migrations)
+
+		for i, m := range migrations {
+			assert.Equal(t, i+1, m.version)
+			assert.NotEmpty(t, m.name)
+			assert.NotEmpty(t, m.up)
+			assert.NotEmpty(t, m.down)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/Alena-Kurushkina/shortener/internal/authenticator"
+	"github.com/Alena-Kurushkina/shortener/internal/sherr"
+)
+
+// A sessionIndex keeps sessions of memory and file storages by hashes of their current refresh tokens.
+type sessionIndex struct {
+	sessions map[string]authenticator.Session
+	// hashes maps session id to hash of its current refresh token
+	hashes map[string]string
+}
+
+// newSessionIndex returns empty index.
+func newSessionIndex() *sessionIndex {
+	return &sessionIndex{
+		sessions: make(map[string]authenticator.Session),
+		hashes:   make(map[string]string),
+	}
+}
+
+// put adds session to index or replaces it.
+func (idx *sessionIndex) put(session authenticator.Session, hash string) {
+	if old, ok := idx.hashes[session.ID]; ok {
+		delete(idx.sessions, old)
+	}
+	if session.RevokedAt != nil {
+		at := *session.RevokedAt
+		session.RevokedAt = &at
+	}
+	idx.sessions[hash] = session
+	idx.hashes[session.ID] = hash
+}
+
+// remove deletes session from index.
+func (idx *sessionIndex) remove(id string) {
+	delete(idx.sessions, idx.hashes[id])
+	delete(idx.hashes, id)
+}
+
+// find returns session by hash of its current refresh token or ErrNotFound.
+func (idx *sessionIndex) find(hash string) (authenticator.Session, error) {
+	session, ok := idx.sessions[hash]
+	if !ok {
+		return authenticator.Session{}, sherr.ErrNotFound
+	}
+	return session, nil
+}
+
+// rotate replaces refresh token of active session. It returns session before rotation
+// or ErrNotFound if session is revoked or oldHash is not its current token.
+func (idx *sessionIndex) rotate(id, oldHash, newHash string, expiresAt time.Time) (authenticator.Session, error) {
+	session, ok := idx.sessions[oldHash]
+	if !ok || session.ID != id || session.RevokedAt != nil {
+		return authenticator.Session{}, sherr.ErrNotFound
+	}
+
+	rotated := session
+	rotated.ExpiresAt = expiresAt
+	idx.put(rotated, newHash)
+	return session, nil
+}
+
+// revoke marks session as revoked at time at. It returns session before revocation with its hash or ErrNotFound.
+// Session revoked earlier keeps its time of revocation.
+func (idx *sessionIndex) revoke(id string, at time.Time) (string, authenticator.Session, error) {
+	hash, ok := idx.hashes[id]
+	if !ok {
+		return "", authenticator.Session{}, sherr.ErrNotFound
+	}
+
+	session := idx.sessions[hash]
+	if session.RevokedAt == nil {
+		revoked := session
+		revoked.RevokedAt = &at
+		idx.put(revoked, hash)
+	}
+	return hash, session, nil
+}
+
+// revokeUser marks active sessions of user as revoked at time at.
+// It returns sessions before revocation by hashes of their refresh tokens.
+func (idx *sessionIndex) revokeUser(userID uuid.UUID, at time.Time) map[string]authenticator.Session {
+	sessions := make(map[string]authenticator.Session)
+	for hash, v := range idx.sessions {
+		if !uuid.Equal(v.UserID, userID) || v.RevokedAt != nil {
+			continue
+		}
+		sessions[hash] = v
+		revokedAt := at
+		v.RevokedAt = &revokedAt
+		idx.sessions[hash] = v
+	}
+	return sessions
+}
+
+// revokedSince returns ids of sessions revoked after since.
+func (idx *sessionIndex) revokedSince(since time.Time) []string {
+	ids := make([]string, 0)
+	for _, v := range idx.sessions {
+		if v.RevokedAt != nil && v.RevokedAt.After(since) {
+			ids = append(ids, v.ID)
+		}
+	}
+	return ids
+}
+
+// purge removes sessions which expired or were revoked before time before. It returns number of removed sessions.
+func (idx *sessionIndex) purge(before time.Time) int {
+	n := 0
+	for _, v := range idx.sessions {
+		if v.ExpiresAt.Before(before) || v.RevokedAt != nil && v.RevokedAt.Before(before) {
+			idx.remove(v.ID)
+			n++
+		}
+	}
+	return n
+}
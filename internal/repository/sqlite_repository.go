@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/Alena-Kurushkina/shortener/internal/api"
+	"github.com/Alena-Kurushkina/shortener/internal/logger"
+)
+
+// sqliteScheme is prefix of connection string which selects SQLite data storage,
+// for example sqlite:///var/lib/shortener/shortener.db.
+const sqliteScheme = "sqlite://"
+
+// A SQLiteRepository stores data in embedded SQLite database.
+// It shares schema migrations and statements with DBRepository
+// and overrides only operations which use PostgreSQL specific syntax.
+type SQLiteRepository struct {
+	*DBRepository
+}
+
+// openSQLite opens SQLite database file in WAL mode.
+// Write transactions take lock at the beginning and wait for concurrent writers instead of failing.
+func openSQLite(path string) (*sql.DB, error) {
+	params := url.Values{}
+	params.Set("_journal_mode", "WAL")
+	params.Set("_synchronous", "NORMAL")
+	params.Set("_busy_timeout", "5000")
+	params.Set("_txlock", "immediate")
+
+	return sql.Open("sqlite3", "file:"+path+"?"+params.Encode())
+}
+
+// newSQLiteRepository initializes data storage in SQLite database.
+func newSQLiteRepository(ctx context.Context, connectionStr string) (api.Storager, error) {
+	db, _, err := openDatabase(connectionStr)
+	if err != nil {
+		return nil, err
+	}
+	logger.Log.Info("SQLite database opened")
+
+	dbRep, err := prepareDBRepository(ctx, db, dialectSQLite)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	dbRep.isShortConflict = isSQLiteShortConflict
+
+	return &SQLiteRepository{DBRepository: dbRep}, nil
+}
+
+// isSQLiteShortConflict reports whether SQLite error is violation of unique index of shortenings.
+func isSQLiteShortConflict(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) &&
+		sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique &&
+		strings.Contains(sqliteErr.Error(), "shortening.shortURL")
+}
+
+// DeleteRecords marks records as deleted by their ids and user ids.
+// For every passed item it returns item with ids of records that are deleted.
+func (r SQLiteRepository) DeleteRecords(ctx context.Context, deleteItems []api.DeleteItem) ([]api.DeleteItem, error) {
+	return r.updateUserRecords(ctx, deleteItems, `
+		UPDATE shortening
+		SET is_deleted = true, deleted_at = COALESCE(deleted_at, $1)
+		WHERE useruuid = $2 AND shorturl = $3
+	`, time.Now().UTC())
+}
+
+// RestoreRecords brings deleted records back by their ids and user ids.
+// For every passed item it returns item with ids of records that are restored.
+func (r SQLiteRepository) RestoreRecords(ctx context.Context, restoreItems []api.DeleteItem) ([]api.DeleteItem, error) {
+	return r.updateUserRecords(ctx, restoreItems, `
+		UPDATE shortening
+		SET is_deleted = false, deleted_at = NULL
+		WHERE useruuid = $1 AND shorturl = $2 AND is_deleted
+	`)
+}
+
+// updateUserRecords executes update query for records identified by ids and user ids.
+// SQLite has no array parameters, so records are updated one by one in single transaction.
+// SQLite numbers parameters in order of their appearance in query, so args are passed as first parameters
+// and user id and id of record are passed as the last two.
+// For every passed item it returns item with ids of records that are updated.
+func (r SQLiteRepository) updateUserRecords(ctx context.Context, items []api.DeleteItem, query string, args ...any) ([]api.DeleteItem, error) {
+	tx, err := r.database.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	result := make([]api.DeleteItem, 0, len(items))
+	for _, v := range items {
+		done := api.DeleteItem{UserID: v.UserID, IDs: make([]string, 0, len(v.IDs))}
+		for _, id := range v.IDs {
+			res, err := stmt.ExecContext(ctx, append(args[:len(args):len(args)], v.UserID, id)...)
+			if err != nil {
+				return nil, err
+			}
+			if n, err := res.RowsAffected(); err == nil && n > 0 {
+				done.IDs = append(done.IDs, id)
+			}
+		}
+		result = append(result, done)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
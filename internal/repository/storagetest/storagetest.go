@@ -0,0 +1,920 @@
+// Package storagetest implements conformance tests for api.Storager implementations.
+// Every data storage must pass them to be interchangeable with the others.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Alena-Kurushkina/shortener/internal/api"
+	"github.com/Alena-Kurushkina/shortener/internal/authenticator"
+	"github.com/Alena-Kurushkina/shortener/internal/sherr"
+)
+
+// Run checks that storages made by newStorage behave as api.Storager is expected to.
+// Every subtest gets new empty storage and closes it at the end.
+func Run(t *testing.T, newStorage func() api.Storager) {
+	t.Helper()
+
+	run := func(name string, test func(t *testing.T, repo api.Storager)) {
+		t.Run(name, func(t *testing.T) {
+			repo := newStorage()
+			defer repo.Close()
+
+			test(t, repo)
+		})
+	}
+
+	run("insert and select", testInsertSelect)
+	run("select unknown shortening", testSelectUnknown)
+	run("insert existing original URL", testInsertDuplicate)
+	run("insert existing shortening", testInsertShortDuplicate)
+	run("insert shortening of deleted record", testInsertDeletedShort)
+	run("insert batch", testInsertBatch)
+	run("insert batch with existing original URL", testInsertBatchDuplicate)
+	run("insert batch with repeated shortening", testInsertBatchShortDuplicate)
+	run("select user all", testSelectUserAll)
+	run("select user page", testSelectUserPage)
+	run("delete records", testDeleteRecords)
+	run("delete records of another user", testDeleteForeignRecords)
+	run("delete many records", testDeleteManyRecords)
+	run("restore records", testRestoreRecords)
+	run("purge deleted records", testPurgeDeleted)
+	run("deletion queue", testDeletionQueue)
+	run("expiration", testExpiration)
+	run("redirect options", testRedirectOptions)
+	run("click statistics", testClickStats)
+	run("update original URL", testUpdateOriginalURL)
+	run("API keys", testAPIKeys)
+	run("sessions", testSessions)
+	run("accounts", testAccounts)
+	run("merge users", testMergeUsers)
+	run("canceled context", testCanceledContext)
+	run("concurrent access", testConcurrentAccess)
+}
+
+func testInsertSelect(t *testing.T, repo api.Storager) {
+	ctx := context.Background()
+
+	require.NoError(t, repo.Insert(ctx, uuid.NewV4(), "short1", "http://site.ru/1", api.LinkOptions{}))
+
+	longURL, err := repo.Select(ctx, "short1")
+	require.NoError(t, err)
+	assert.Equal(t, "http://site.ru/1", longURL.OriginalURL)
+}
+
+func testSelectUnknown(t *testing.T, repo api.Storager) {
+	_, err := repo.Select(context.Background(), "unknown")
+	assert.ErrorIs(t, err, sherr.ErrNotFound)
+}
+
+func testInsertDuplicate(t *testing.T, repo api.Storager) {
+	ctx := context.Background()
+
+	require.NoError(t, repo.Insert(ctx, uuid.NewV4(), "short1", "http://site.ru/1", api.LinkOptions{}))
+
+	err := repo.Insert(ctx, uuid.NewV4(), "short2", "http://site.ru/1", api.LinkOptions{})
+
+	var existError *sherr.AlreadyExistError
+	require.ErrorAs(t, err, &existError)
+	assert.Equal(t, "short1", existError.ExistShortStr)
+	assert.Equal(t, "http://site.ru/1", existError.ExistOriginalURL)
+
+	_, err = repo.Select(ctx, "short2")
+	assert.Error(t, err)
+}
+
+func testInsertShortDuplicate(t *testing.T, repo api.Storager) {
+	ctx := context.Background()
+
+	require.NoError(t, repo.Insert(ctx, uuid.NewV4(), "short1", "http://site.ru/1", api.LinkOptions{}))
+
+	err := repo.Insert(ctx, uuid.NewV4(), "short1", "http://site.ru/2", api.LinkOptions{})
+
+	var collision *sherr.CollisionError
+	require.ErrorAs(t, err, &collision)
+	assert.Equal(t, "short1", collision.ShortURL)
+
+	err = repo.InsertBatch(ctx, uuid.NewV4(), []api.BatchElement{
+		{CorrelarionID: uuid.NewV4().String(), OriginalURL: "http://site.ru/3", ShortURL: "short3"},
+		{CorrelarionID: uuid.NewV4().String(), OriginalURL: "http://site.ru/4", ShortURL: "short1"},
+	})
+	require.ErrorAs(t, err, &collision)
+	assert.Equal(t, "short1", collision.ShortURL)
+
+	longURL, err := repo.Select(ctx, "short1")
+	require.NoError(t, err)
+	assert.Equal(t, "http://site.ru/1", longURL.OriginalURL)
+
+	// batch is saved entirely or not saved at all
+	_, err = repo.Select(ctx, "short3")
+	assert.ErrorIs(t, err, sherr.ErrNotFound)
+}
+
+func testInsertDeletedShort(t *testing.T, repo api.Storager) {
+	ctx := context.Background()
+	user := uuid.NewV4()
+
+	require.NoError(t, repo.Insert(ctx, user, "alias", "http://site.ru/1", api.LinkOptions{}))
+	_, err := repo.DeleteRecords(ctx, []api.DeleteItem{{UserID: user, IDs: []string{"alias"}}})
+	require.NoError(t, err)
+
+	// shortening stays reserved after deletion, so alias can't point to another URL
+	err = repo.Insert(ctx, uuid.NewV4(), "alias", "http://site.ru/2", api.LinkOptions{})
+
+	var collision *sherr.CollisionError
+	require.ErrorAs(t, err, &collision)
+	assert.Equal(t, "alias", collision.ShortURL)
+}
+
+func testInsertBatch(t *testing.T, repo api.Storager) {
+	ctx := context.Background()
+
+	batch := []api.BatchElement{
+		{CorrelarionID: uuid.NewV4().String(), OriginalURL: "http://site.ru/1", ShortURL: "short1"},
+		{CorrelarionID: uuid.NewV4().String(), OriginalURL: "http://site.ru/2", ShortURL: "short2"},
+	}
+	require.NoError(t, repo.InsertBatch(ctx, uuid.NewV4(), batch))
+
+	for _, v := range batch {
+		longURL, err := repo.Select(ctx, v.ShortURL)
+		require.NoError(t, err)
+		assert.Equal(t, v.OriginalURL, longURL.OriginalURL)
+	}
+}
+
+func testInsertBatchDuplicate(t *testing.T, repo api.Storager) {
+	ctx := context.Background()
+
+	require.NoError(t, repo.Insert(ctx, uuid.NewV4(), "short1", "http://site.ru/1", api.LinkOptions{}))
+
+	batch := []api.BatchElement{
+		{CorrelarionID: uuid.NewV4().String(), OriginalURL: "http://site.ru/1", ShortURL: "short2"},
+		{CorrelarionID: uuid.NewV4().String(), OriginalURL: "http://site.ru/3", ShortURL: "short3"},
+	}
+	require.NoError(t, repo.InsertBatch(ctx, uuid.NewV4(), batch))
+
+	assert.Equal(t, "short1", batch[0].ShortURL)
+	assert.Equal(t, "short3", batch[1].ShortURL)
+
+	_, err := repo.Select(ctx, "short2")
+	assert.Error(t, err)
+}
+
+func testInsertBatchShortDuplicate(t *testing.T, repo api.Storager) {
+	ctx := context.Background()
+
+	batch := []api.BatchElement{
+		{CorrelarionID: uuid.NewV4().String(), OriginalURL: "http://site.ru/1", ShortURL: "short1"},
+		{CorrelarionID: uuid.NewV4().String(), OriginalURL: "http://site.ru/2", ShortURL: "short1"},
+	}
+	err := repo.InsertBatch(ctx, uuid.NewV4(), batch)
+
+	var collision *sherr.CollisionError
+	require.ErrorAs(t, err, &collision)
+	assert.Equal(t, "short1", collision.ShortURL)
+
+	// batch is not saved partially
+	_, err = repo.Select(ctx, "short1")
+	assert.ErrorIs(t, err, sherr.ErrNotFound)
+}
+
+func testSelectUserAll(t *testing.T, repo api.Storager) {
+	ctx := context.Background()
+	user, another := uuid.NewV4(), uuid.NewV4()
+
+	require.NoError(t, repo.Insert(ctx, user, "short1", "http://site.ru/1", api.LinkOptions{}))
+	require.NoError(t, repo.InsertBatch(ctx, user, []api.BatchElement{
+		{CorrelarionID: uuid.NewV4().String(), OriginalURL: "http://site.ru/2", ShortURL: "short2"},
+	}))
+	require.NoError(t, repo.Insert(ctx, another, "short3", "http://site.ru/3", api.LinkOptions{}))
+
+	records, err := repo.SelectUserAll(ctx, user)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []api.BatchElement{
+		{OriginalURL: "http://site.ru/1", ShortURL: "short1"},
+		{OriginalURL: "http://site.ru/2", ShortURL: "short2"},
+	}, records)
+
+	records, err = repo.SelectUserAll(ctx, uuid.NewV4())
+	require.NoError(t, err)
+	assert.Empty(t, records)
+}
+
+// listAll reads all pages of user's shortenings and returns their shortenings.
+func listAll(t *testing.T, repo api.Storager, user uuid.UUID, query api.ListQuery) []string {
+	t.Helper()
+
+	keys := make([]string, 0)
+	for {
+		page, next, err := repo.SelectUserPage(context.Background(), user, query)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(page), query.Limit)
+		for _, v := range page {
+			require.NotNil(t, v.CreatedAt)
+			keys = append(keys, v.ShortURL)
+		}
+		if next == nil {
+			return keys
+		}
+		require.Len(t, page, query.Limit)
+		query.After = next
+	}
+}
+
+func testSelectUserPage(t *testing.T, repo api.Storager) {
+	ctx := context.Background()
+	user := uuid.NewV4()
+
+	for i := 1; i <= 5; i++ {
+		key := "short" + strconv.Itoa(i)
+		require.NoError(t, repo.Insert(ctx, user, key, "http://site.ru/"+key, api.LinkOptions{}))
+	}
+	require.NoError(t, repo.InsertBatch(ctx, user, []api.BatchElement{
+		{CorrelarionID: uuid.NewV4().String(), OriginalURL: "http://Other.ru/100%_sale", ShortURL: "short6"},
+	}))
+	require.NoError(t, repo.Insert(ctx, uuid.NewV4(), "short7", "http://site.ru/short7", api.LinkOptions{}))
+	_, err := repo.DeleteRecords(ctx, []api.DeleteItem{{UserID: user, IDs: []string{"short2"}}})
+	require.NoError(t, err)
+
+	all := []string{"short1", "short2", "short3", "short4", "short5", "short6"}
+	assert.Equal(t, all, listAll(t, repo, user, api.ListQuery{Limit: 2}))
+	assert.Equal(t, all, listAll(t, repo, user, api.ListQuery{Limit: 3}))
+	assert.Equal(t, all, listAll(t, repo, user, api.ListQuery{Limit: 100}))
+	assert.Equal(t, []string{"short6", "short5", "short4", "short3", "short2", "short1"},
+		listAll(t, repo, user, api.ListQuery{Limit: 4, Desc: true}))
+
+	// wildcards of search are matched literally and case is ignored
+	assert.Equal(t, []string{"short6"}, listAll(t, repo, user, api.ListQuery{Limit: 2, Search: "other.RU/100%_"}))
+	assert.Empty(t, listAll(t, repo, user, api.ListQuery{Limit: 2, Search: "100_%"}))
+
+	deleted, notDeleted := true, false
+	assert.Equal(t, []string{"short2"}, listAll(t, repo, user, api.ListQuery{Limit: 2, Deleted: &deleted}))
+	assert.Equal(t, []string{"short1", "short3", "short4", "short5", "short6"},
+		listAll(t, repo, user, api.ListQuery{Limit: 2, Deleted: &notDeleted}))
+
+	page, next, err := repo.SelectUserPage(ctx, user, api.ListQuery{Limit: 1, Deleted: &deleted})
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	assert.True(t, page[0].Deleted)
+	assert.Equal(t, "http://site.ru/short2", page[0].OriginalURL)
+	assert.Nil(t, next)
+
+	page, next, err = repo.SelectUserPage(ctx, uuid.NewV4(), api.ListQuery{Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, page)
+	assert.Nil(t, next)
+}
+
+func testDeleteRecords(t *testing.T, repo api.Storager) {
+	ctx := context.Background()
+	user := uuid.NewV4()
+
+	require.NoError(t, repo.Insert(ctx, user, "short1", "http://site.ru/1", api.LinkOptions{}))
+	require.NoError(t, repo.Insert(ctx, user, "short2", "http://site.ru/2", api.LinkOptions{}))
+
+	deleted, err := repo.DeleteRecords(ctx, []api.DeleteItem{{UserID: user, IDs: []string{"short1", "unknown"}}})
+	require.NoError(t, err)
+	assert.Equal(t, []api.DeleteItem{{UserID: user, IDs: []string{"short1"}}}, deleted)
+
+	_, err = repo.Select(ctx, "short1")
+	assert.ErrorIs(t, err, sherr.ErrDBRecordDeleted)
+
+	longURL, err := repo.Select(ctx, "short2")
+	require.NoError(t, err)
+	assert.Equal(t, "http://site.ru/2", longURL.OriginalURL)
+
+	deleted, err = repo.DeleteRecords(ctx, nil)
+	require.NoError(t, err)
+	assert.Empty(t, deleted)
+}
+
+func testDeleteManyRecords(t *testing.T, repo api.Storager) {
+	ctx := context.Background()
+	user := uuid.NewV4()
+
+	const count = 2500
+
+	batch := make([]api.BatchElement, 0, count)
+	ids := make([]string, 0, count+1)
+	for i := 0; i < count; i++ {
+		key := "short" + strconv.Itoa(i)
+		batch = append(batch, api.BatchElement{
+			CorrelarionID: uuid.NewV4().String(),
+			OriginalURL:   "http://site.ru/" + key,
+			ShortURL:      key,
+		})
+		ids = append(ids, key)
+	}
+	require.NoError(t, repo.InsertBatch(ctx, user, batch))
+
+	// code with quote must be passed as data, not as part of statement
+	ids = append(ids, "x'); DROP TABLE shortening; --")
+
+	deleted, err := repo.DeleteRecords(ctx, []api.DeleteItem{{UserID: user, IDs: ids}})
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	assert.Equal(t, ids[:count], deleted[0].IDs)
+
+	for _, id := range []string{"short0", "short1000", "short2499"} {
+		_, err = repo.Select(ctx, id)
+		assert.ErrorIs(t, err, sherr.ErrDBRecordDeleted)
+	}
+}
+
+func testDeleteForeignRecords(t *testing.T, repo api.Storager) {
+	ctx := context.Background()
+
+	require.NoError(t, repo.Insert(ctx, uuid.NewV4(), "short1", "http://site.ru/1", api.LinkOptions{}))
+
+	another := uuid.NewV4()
+	deleted, err := repo.DeleteRecords(ctx, []api.DeleteItem{{UserID: another, IDs: []string{"short1"}}})
+	require.NoError(t, err)
+	assert.Equal(t, []api.DeleteItem{{UserID: another, IDs: []string{}}}, deleted)
+
+	longURL, err := repo.Select(ctx, "short1")
+	require.NoError(t, err)
+	assert.Equal(t, "http://site.ru/1", longURL.OriginalURL)
+}
+
+func testRestoreRecords(t *testing.T, repo api.Storager) {
+	ctx := context.Background()
+	user := uuid.NewV4()
+
+	require.NoError(t, repo.Insert(ctx, user, "short1", "http://site.ru/1", api.LinkOptions{}))
+	require.NoError(t, repo.Insert(ctx, user, "short2", "http://site.ru/2", api.LinkOptions{}))
+	_, err := repo.DeleteRecords(ctx, []api.DeleteItem{{UserID: user, IDs: []string{"short1"}}})
+	require.NoError(t, err)
+
+	// record of another user isn't restored
+	another := uuid.NewV4()
+	restored, err := repo.RestoreRecords(ctx, []api.DeleteItem{{UserID: another, IDs: []string{"short1"}}})
+	require.NoError(t, err)
+	assert.Equal(t, []api.DeleteItem{{UserID: another, IDs: []string{}}}, restored)
+
+	// record which isn't deleted isn't restored
+	restored, err = repo.RestoreRecords(ctx, []api.DeleteItem{{UserID: user, IDs: []string{"short1", "short2", "unknown"}}})
+	require.NoError(t, err)
+	assert.Equal(t, []api.DeleteItem{{UserID: user, IDs: []string{"short1"}}}, restored)
+
+	longURL, err := repo.Select(ctx, "short1")
+	require.NoError(t, err)
+	assert.Equal(t, "http://site.ru/1", longURL.OriginalURL)
+
+	// restored record can be deleted again
+	deleted, err := repo.DeleteRecords(ctx, []api.DeleteItem{{UserID: user, IDs: []string{"short1"}}})
+	require.NoError(t, err)
+	assert.Equal(t, []api.DeleteItem{{UserID: user, IDs: []string{"short1"}}}, deleted)
+	_, err = repo.Select(ctx, "short1")
+	assert.ErrorIs(t, err, sherr.ErrDBRecordDeleted)
+
+	restored, err = repo.RestoreRecords(ctx, nil)
+	require.NoError(t, err)
+	assert.Empty(t, restored)
+}
+
+func testPurgeDeleted(t *testing.T, repo api.Storager) {
+	ctx := context.Background()
+	user := uuid.NewV4()
+
+	require.NoError(t, repo.Insert(ctx, user, "short1", "http://site.ru/1", api.LinkOptions{}))
+	require.NoError(t, repo.Insert(ctx, user, "short2", "http://site.ru/2", api.LinkOptions{}))
+	require.NoError(t, repo.Insert(ctx, user, "short3", "http://site.ru/3", api.LinkOptions{}))
+	require.NoError(t, repo.UpdateOriginalURL(ctx, user, "short1", "http://site.ru/1new"))
+	require.NoError(t, repo.SaveClicks(ctx, []api.Click{{ShortURL: "short1", Time: time.Now()}}))
+
+	before := time.Now().Add(-time.Second)
+	_, err := repo.DeleteRecords(ctx, []api.DeleteItem{{UserID: user, IDs: []string{"short1", "short2"}}})
+	require.NoError(t, err)
+	after := time.Now().Add(time.Second)
+
+	// records deleted after passed time are kept
+	purged, err := repo.PurgeDeleted(ctx, before)
+	require.NoError(t, err)
+	assert.Empty(t, purged)
+
+	purged, err = repo.PurgeDeleted(ctx, after)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"short1", "short2"}, purged)
+
+	_, err = repo.Select(ctx, "short1")
+	assert.ErrorIs(t, err, sherr.ErrNotFound)
+	longURL, err := repo.Select(ctx, "short3")
+	require.NoError(t, err)
+	assert.Equal(t, "http://site.ru/3", longURL.OriginalURL)
+
+	records, err := repo.SelectUserAll(ctx, user)
+	require.NoError(t, err)
+	assert.Equal(t, []api.BatchElement{{OriginalURL: "http://site.ru/3", ShortURL: "short3"}}, records)
+
+	restored, err := repo.RestoreRecords(ctx, []api.DeleteItem{{UserID: user, IDs: []string{"short1"}}})
+	require.NoError(t, err)
+	assert.Equal(t, []api.DeleteItem{{UserID: user, IDs: []string{}}}, restored)
+
+	// shortening and original URL are free again, history and statistics of purged record are gone
+	require.NoError(t, repo.Insert(ctx, user, "short1", "http://site.ru/1new", api.LinkOptions{}))
+	history, err := repo.SelectHistory(ctx, user, "short1")
+	require.NoError(t, err)
+	assert.Empty(t, history)
+	stats, err := repo.SelectStats(ctx, user, "short1")
+	require.NoError(t, err)
+	assert.Empty(t, stats.Days)
+	assert.Empty(t, stats.Referrers)
+	assert.Empty(t, stats.UserAgents)
+
+	purged, err = repo.PurgeDeleted(ctx, after)
+	require.NoError(t, err)
+	assert.Empty(t, purged)
+}
+
+func testDeletionQueue(t *testing.T, repo api.Storager) {
+	ctx := context.Background()
+	user := uuid.NewV4()
+
+	items, err := repo.SelectQueuedDeletions(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, items)
+
+	queued := []api.DeleteItem{
+		{JobID: uuid.NewV4().String(), UserID: user, IDs: []string{"short1", "short2"}},
+		{JobID: uuid.NewV4().String(), UserID: uuid.NewV4(), IDs: []string{"short3"}},
+		{JobID: uuid.NewV4().String(), UserID: user, IDs: []string{"short4"}},
+	}
+	for _, item := range queued {
+		require.NoError(t, repo.QueueDeletion(ctx, item))
+	}
+
+	items, err = repo.SelectQueuedDeletions(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, queued, items)
+
+	require.NoError(t, repo.DequeueDeletions(ctx, []string{queued[0].JobID, queued[2].JobID, "unknown"}))
+	items, err = repo.SelectQueuedDeletions(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, queued[1:2], items)
+
+	require.NoError(t, repo.DequeueDeletions(ctx, nil))
+	require.NoError(t, repo.DequeueDeletions(ctx, []string{queued[1].JobID}))
+	items, err = repo.SelectQueuedDeletions(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, items)
+}
+
+func testRedirectOptions(t *testing.T, repo api.Storager) {
+	ctx := context.Background()
+	user := uuid.NewV4()
+
+	require.NoError(t, repo.Insert(ctx, user, "short1", "http://site.ru/1", api.LinkOptions{RedirectCode: 301, Passthrough: true}))
+	require.NoError(t, repo.Insert(ctx, user, "short2", "http://site.ru/2", api.LinkOptions{}))
+	require.NoError(t, repo.InsertBatch(ctx, user, []api.BatchElement{
+		{CorrelarionID: uuid.NewV4().String(), OriginalURL: "http://site.ru/3", ShortURL: "short3", RedirectCode: 308},
+	}))
+
+	redirect, err := repo.Select(ctx, "short1")
+	require.NoError(t, err)
+	assert.Equal(t, api.Redirect{OriginalURL: "http://site.ru/1", RedirectCode: 301, Passthrough: true}, redirect)
+
+	// zero code means redirect status defined by config
+	redirect, err = repo.Select(ctx, "short2")
+	require.NoError(t, err)
+	assert.Equal(t, api.Redirect{OriginalURL: "http://site.ru/2"}, redirect)
+
+	redirect, err = repo.Select(ctx, "short3")
+	require.NoError(t, err)
+	assert.Equal(t, api.Redirect{OriginalURL: "http://site.ru/3", RedirectCode: 308}, redirect)
+
+	records, err := repo.SelectUserAll(ctx, user)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []api.BatchElement{
+		{OriginalURL: "http://site.ru/1", ShortURL: "short1", RedirectCode: 301, Passthrough: true},
+		{OriginalURL: "http://site.ru/2", ShortURL: "short2"},
+		{OriginalURL: "http://site.ru/3", ShortURL: "short3", RedirectCode: 308},
+	}, records)
+}
+
+func testExpiration(t *testing.T, repo api.Storager) {
+	ctx := context.Background()
+	user := uuid.NewV4()
+	now := time.Now()
+	future, past := now.Add(time.Hour), now.Add(-time.Second)
+
+	require.NoError(t, repo.Insert(ctx, user, "short1", "http://site.ru/1", api.LinkOptions{ExpiresAt: &future}))
+	require.NoError(t, repo.Insert(ctx, user, "short2", "http://site.ru/2", api.LinkOptions{}))
+	require.NoError(t, repo.InsertBatch(ctx, user, []api.BatchElement{
+		{CorrelarionID: uuid.NewV4().String(), OriginalURL: "http://site.ru/3", ShortURL: "short3", ExpiresAt: &future},
+	}))
+	require.NoError(t, repo.Insert(ctx, user, "short4", "http://site.ru/4", api.LinkOptions{ExpiresAt: &past}))
+
+	longURL, err := repo.Select(ctx, "short1")
+	require.NoError(t, err)
+	assert.Equal(t, "http://site.ru/1", longURL.OriginalURL)
+	require.NotNil(t, longURL.ExpiresAt)
+	assert.WithinDuration(t, future, *longURL.ExpiresAt, time.Millisecond)
+
+	// expired shortening doesn't work before it is deleted
+	_, err = repo.Select(ctx, "short4")
+	assert.ErrorIs(t, err, sherr.ErrLinkExpired)
+
+	records, err := repo.SelectUserAll(ctx, user)
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	for _, v := range records {
+		switch v.ShortURL {
+		case "short2":
+			assert.Nil(t, v.ExpiresAt)
+		case "short4":
+			require.NotNil(t, v.ExpiresAt)
+			assert.WithinDuration(t, past, *v.ExpiresAt, time.Millisecond)
+		default:
+			require.NotNil(t, v.ExpiresAt)
+			assert.WithinDuration(t, future, *v.ExpiresAt, time.Millisecond)
+		}
+	}
+
+	expired, err := repo.DeleteExpired(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"short4"}, expired)
+
+	expired, err = repo.DeleteExpired(ctx, future.Add(time.Second))
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"short1", "short3"}, expired)
+
+	for _, key := range []string{"short1", "short3", "short4"} {
+		_, err = repo.Select(ctx, key)
+		assert.ErrorIs(t, err, sherr.ErrDBRecordDeleted)
+	}
+	longURL, err = repo.Select(ctx, "short2")
+	require.NoError(t, err)
+	assert.Equal(t, "http://site.ru/2", longURL.OriginalURL)
+
+	expired, err = repo.DeleteExpired(ctx, future.Add(time.Second))
+	require.NoError(t, err)
+	assert.Empty(t, expired)
+}
+
+func testClickStats(t *testing.T, repo api.Storager) {
+	ctx := context.Background()
+	user := uuid.NewV4()
+
+	require.NoError(t, repo.Insert(ctx, user, "short1", "http://site.ru/1", api.LinkOptions{}))
+	require.NoError(t, repo.Insert(ctx, user, "short2", "http://site.ru/2", api.LinkOptions{}))
+
+	day1 := time.Date(2024, time.March, 1, 10, 0, 0, 0, time.UTC)
+	day2 := time.Date(2024, time.March, 2, 23, 59, 0, 0, time.UTC)
+
+	require.NoError(t, repo.SaveClicks(ctx, []api.Click{
+		{ShortURL: "short1", Time: day1, Referrer: "blog.ru", UserAgent: "agent1", IPHash: "ip1"},
+		{ShortURL: "short1", Time: day1.Add(time.Hour), Referrer: "blog.ru", UserAgent: "agent2", IPHash: "ip1"},
+		{ShortURL: "short1", Time: day2, UserAgent: "agent1", IPHash: "ip1"},
+		{ShortURL: "short2", Time: day2, Referrer: "news.ru", UserAgent: "agent3", IPHash: "ip3"},
+	}))
+	// visitor of the same day is counted once across batches
+	require.NoError(t, repo.SaveClicks(ctx, []api.Click{
+		{ShortURL: "short1", Time: day2, Referrer: "blog.ru", UserAgent: "agent1", IPHash: "ip1"},
+		{ShortURL: "short1", Time: day2, UserAgent: "agent1", IPHash: "ip2"},
+	}))
+
+	stats, err := repo.SelectStats(ctx, user, "short1")
+	require.NoError(t, err)
+	require.Len(t, stats.Days, 2)
+	assert.True(t, stats.Days[0].Day.Equal(time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t, int64(2), stats.Days[0].Clicks)
+	assert.Equal(t, int64(1), stats.Days[0].Visitors)
+	assert.True(t, stats.Days[1].Day.Equal(time.Date(2024, time.March, 2, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t, int64(3), stats.Days[1].Clicks)
+	assert.Equal(t, int64(2), stats.Days[1].Visitors)
+	assert.Equal(t, []api.SourceClicks{{Value: "blog.ru", Clicks: 3}, {Value: "", Clicks: 2}}, stats.Referrers)
+	assert.Equal(t, []api.SourceClicks{{Value: "agent1", Clicks: 4}, {Value: "agent2", Clicks: 1}}, stats.UserAgents)
+
+	// only the most frequent sources are returned
+	many := make([]api.Click, 0, api.TopSources+1)
+	for i := 0; i <= api.TopSources; i++ {
+		many = append(many, api.Click{ShortURL: "short2", Time: day2, Referrer: "site" + strconv.Itoa(10+i) + ".ru"})
+	}
+	require.NoError(t, repo.SaveClicks(ctx, many))
+	stats, err = repo.SelectStats(ctx, user, "short2")
+	require.NoError(t, err)
+	require.Len(t, stats.Referrers, api.TopSources)
+	assert.Equal(t, api.SourceClicks{Value: "news.ru", Clicks: 1}, stats.Referrers[0])
+
+	require.NoError(t, repo.Insert(ctx, user, "short3", "http://site.ru/3", api.LinkOptions{}))
+	stats, err = repo.SelectStats(ctx, user, "short3")
+	require.NoError(t, err)
+	assert.Empty(t, stats.Days)
+	assert.Empty(t, stats.Referrers)
+
+	_, err = repo.SelectStats(ctx, uuid.NewV4(), "short1")
+	assert.ErrorIs(t, err, sherr.ErrNotFound)
+
+	_, err = repo.SelectStats(ctx, user, "unknown")
+	assert.ErrorIs(t, err, sherr.ErrNotFound)
+}
+
+func testUpdateOriginalURL(t *testing.T, repo api.Storager) {
+	ctx := context.Background()
+	user := uuid.NewV4()
+
+	require.NoError(t, repo.Insert(ctx, user, "short1", "http://site.ru/1", api.LinkOptions{}))
+	require.NoError(t, repo.Insert(ctx, user, "short2", "http://site.ru/2", api.LinkOptions{}))
+
+	longURL, err := repo.Select(ctx, "short1")
+	require.NoError(t, err)
+	assert.Equal(t, "http://site.ru/1", longURL.OriginalURL)
+
+	require.NoError(t, repo.UpdateOriginalURL(ctx, user, "short1", "http://site.ru/new"))
+	require.NoError(t, repo.UpdateOriginalURL(ctx, user, "short1", "http://site.ru/newer"))
+	// the same URL changes nothing
+	require.NoError(t, repo.UpdateOriginalURL(ctx, user, "short1", "http://site.ru/newer"))
+
+	longURL, err = repo.Select(ctx, "short1")
+	require.NoError(t, err)
+	assert.Equal(t, "http://site.ru/newer", longURL.OriginalURL)
+
+	history, err := repo.SelectHistory(ctx, user, "short1")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, "http://site.ru/1", history[0].OldURL)
+	assert.Equal(t, "http://site.ru/new", history[0].NewURL)
+	assert.Equal(t, "http://site.ru/new", history[1].OldURL)
+	assert.Equal(t, "http://site.ru/newer", history[1].NewURL)
+	assert.False(t, history[1].ChangedAt.Before(history[0].ChangedAt))
+
+	history, err = repo.SelectHistory(ctx, user, "short2")
+	require.NoError(t, err)
+	assert.Empty(t, history)
+
+	// previous original URL is free again
+	require.NoError(t, repo.Insert(ctx, user, "short3", "http://site.ru/1", api.LinkOptions{}))
+
+	err = repo.UpdateOriginalURL(ctx, user, "short1", "http://site.ru/2")
+	var existError *sherr.AlreadyExistError
+	require.ErrorAs(t, err, &existError)
+	assert.Equal(t, "short2", existError.ExistShortStr)
+
+	assert.ErrorIs(t, repo.UpdateOriginalURL(ctx, uuid.NewV4(), "short1", "http://site.ru/4"), sherr.ErrNotFound)
+	assert.ErrorIs(t, repo.UpdateOriginalURL(ctx, user, "unknown", "http://site.ru/4"), sherr.ErrNotFound)
+	_, err = repo.SelectHistory(ctx, uuid.NewV4(), "short1")
+	assert.ErrorIs(t, err, sherr.ErrNotFound)
+
+	_, err = repo.DeleteRecords(ctx, []api.DeleteItem{{UserID: user, IDs: []string{"short2"}}})
+	require.NoError(t, err)
+	assert.ErrorIs(t, repo.UpdateOriginalURL(ctx, user, "short2", "http://site.ru/4"), sherr.ErrDBRecordDeleted)
+
+	records, err := repo.SelectUserAll(ctx, user)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []api.BatchElement{
+		{OriginalURL: "http://site.ru/newer", ShortURL: "short1"},
+		{OriginalURL: "http://site.ru/2", ShortURL: "short2"},
+		{OriginalURL: "http://site.ru/1", ShortURL: "short3"},
+	}, records)
+}
+
+func testAPIKeys(t *testing.T, repo api.Storager) {
+	ctx := context.Background()
+	user, other := uuid.NewV4(), uuid.NewV4()
+	created := time.Date(2024, time.March, 1, 10, 0, 0, 0, time.UTC)
+
+	key1 := authenticator.APIKey{ID: uuid.NewV4().String(), Name: "backend", Scopes: []string{"create", "read"}, CreatedAt: created, UserID: user}
+	key2 := authenticator.APIKey{ID: uuid.NewV4().String(), Scopes: []string{"delete"}, CreatedAt: created.Add(time.Hour), UserID: user}
+	key3 := authenticator.APIKey{ID: uuid.NewV4().String(), Scopes: []string{"read"}, CreatedAt: created, UserID: other}
+	require.NoError(t, repo.InsertAPIKey(ctx, key2, "hash2"))
+	require.NoError(t, repo.InsertAPIKey(ctx, key1, "hash1"))
+	require.NoError(t, repo.InsertAPIKey(ctx, key3, "hash3"))
+
+	key, err := repo.SelectAPIKey(ctx, "hash1")
+	require.NoError(t, err)
+	assert.Equal(t, key1, key)
+	_, err = repo.SelectAPIKey(ctx, "unknown")
+	assert.ErrorIs(t, err, sherr.ErrNotFound)
+
+	keys, err := repo.SelectUserAPIKeys(ctx, user)
+	require.NoError(t, err)
+	assert.Equal(t, []authenticator.APIKey{key1, key2}, keys)
+
+	// key is revoked only by its owner
+	assert.ErrorIs(t, repo.RevokeAPIKey(ctx, other, key1.ID), sherr.ErrNotFound)
+	require.NoError(t, repo.RevokeAPIKey(ctx, user, key1.ID))
+	assert.ErrorIs(t, repo.RevokeAPIKey(ctx, user, key1.ID), sherr.ErrNotFound)
+
+	_, err = repo.SelectAPIKey(ctx, "hash1")
+	assert.ErrorIs(t, err, sherr.ErrNotFound)
+	keys, err = repo.SelectUserAPIKeys(ctx, user)
+	require.NoError(t, err)
+	assert.Equal(t, []authenticator.APIKey{key2}, keys)
+	keys, err = repo.SelectUserAPIKeys(ctx, uuid.NewV4())
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+}
+
+func testSessions(t *testing.T, repo api.Storager) {
+	ctx := context.Background()
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	session := authenticator.Session{ID: uuid.NewV4().String(), UserID: uuid.NewV4(), ExpiresAt: expires}
+	other := authenticator.Session{ID: uuid.NewV4().String(), UserID: uuid.NewV4(), ExpiresAt: expires}
+	require.NoError(t, repo.InsertSession(ctx, session, "hash1"))
+	require.NoError(t, repo.InsertSession(ctx, other, "other"))
+
+	got, err := repo.SelectSession(ctx, "hash1")
+	require.NoError(t, err)
+	assert.Equal(t, session, got)
+	_, err = repo.SelectSession(ctx, "unknown")
+	assert.ErrorIs(t, err, sherr.ErrNotFound)
+
+	// refresh token is rotated only once
+	prolonged := expires.Add(time.Hour)
+	require.NoError(t, repo.RotateSession(ctx, session.ID, "hash1", "hash2", prolonged))
+	assert.ErrorIs(t, repo.RotateSession(ctx, session.ID, "hash1", "hash3", prolonged), sherr.ErrNotFound)
+	_, err = repo.SelectSession(ctx, "hash1")
+	assert.ErrorIs(t, err, sherr.ErrNotFound)
+	got, err = repo.SelectSession(ctx, "hash2")
+	require.NoError(t, err)
+	assert.Equal(t, prolonged, got.ExpiresAt)
+	assert.Equal(t, session.UserID, got.UserID)
+
+	// revoked session can't be rotated
+	before := time.Now().Add(-time.Second)
+	require.NoError(t, repo.RevokeSession(ctx, session.ID))
+	assert.ErrorIs(t, repo.RevokeSession(ctx, uuid.NewV4().String()), sherr.ErrNotFound)
+	assert.ErrorIs(t, repo.RotateSession(ctx, session.ID, "hash2", "hash3", prolonged), sherr.ErrNotFound)
+	got, err = repo.SelectSession(ctx, "hash2")
+	require.NoError(t, err)
+	assert.NotNil(t, got.RevokedAt)
+
+	ids, err := repo.SelectRevokedSessions(ctx, before)
+	require.NoError(t, err)
+	assert.Equal(t, []string{session.ID}, ids)
+	ids, err = repo.SelectRevokedSessions(ctx, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+
+	// revoked session is purged, active one is kept until it expires
+	require.NoError(t, repo.PurgeSessions(ctx, time.Now().Add(time.Second)))
+	_, err = repo.SelectSession(ctx, "hash2")
+	assert.ErrorIs(t, err, sherr.ErrNotFound)
+	_, err = repo.SelectSession(ctx, "other")
+	require.NoError(t, err)
+	require.NoError(t, repo.PurgeSessions(ctx, expires.Add(time.Second)))
+	_, err = repo.SelectSession(ctx, "other")
+	assert.ErrorIs(t, err, sherr.ErrNotFound)
+}
+
+func testAccounts(t *testing.T, repo api.Storager) {
+	ctx := context.Background()
+	account := authenticator.Account{UserID: uuid.NewV4(), Username: "alice", CreatedAt: time.Date(2024, time.March, 1, 10, 0, 0, 0, time.UTC)}
+	require.NoError(t, repo.InsertAccount(ctx, account, "hash"))
+
+	// username and user id belong to one account
+	taken := authenticator.Account{UserID: uuid.NewV4(), Username: "alice", CreatedAt: account.CreatedAt}
+	assert.ErrorIs(t, repo.InsertAccount(ctx, taken, "other hash"), sherr.ErrUsernameTaken)
+	second := authenticator.Account{UserID: account.UserID, Username: "bob", CreatedAt: account.CreatedAt}
+	assert.ErrorIs(t, repo.InsertAccount(ctx, second, "other hash"), sherr.ErrUsernameTaken)
+
+	got, hash, err := repo.SelectAccount(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, account, got)
+	assert.Equal(t, "hash", hash)
+	_, _, err = repo.SelectAccount(ctx, "bob")
+	assert.ErrorIs(t, err, sherr.ErrNotFound)
+
+	got, err = repo.SelectUserAccount(ctx, account.UserID)
+	require.NoError(t, err)
+	assert.Equal(t, account, got)
+	_, err = repo.SelectUserAccount(ctx, uuid.NewV4())
+	assert.ErrorIs(t, err, sherr.ErrNotFound)
+}
+
+func testMergeUsers(t *testing.T, repo api.Storager) {
+	ctx := context.Background()
+	anonymous, registered := uuid.NewV4(), uuid.NewV4()
+
+	require.NoError(t, repo.Insert(ctx, registered, "own", "http://site.ru/own", api.LinkOptions{}))
+	require.NoError(t, repo.Insert(ctx, anonymous, "short1", "http://site.ru/1", api.LinkOptions{}))
+	require.NoError(t, repo.Insert(ctx, anonymous, "short2", "http://site.ru/2", api.LinkOptions{}))
+	_, err := repo.DeleteRecords(ctx, []api.DeleteItem{{UserID: anonymous, IDs: []string{"short2"}}})
+	require.NoError(t, err)
+	key := authenticator.APIKey{ID: uuid.NewV4().String(), Scopes: []string{"read"}, CreatedAt: time.Now().UTC().Truncate(time.Second), UserID: anonymous}
+	require.NoError(t, repo.InsertAPIKey(ctx, key, "hash"))
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	session1 := authenticator.Session{ID: uuid.NewV4().String(), UserID: anonymous, ExpiresAt: expires}
+	session2 := authenticator.Session{ID: uuid.NewV4().String(), UserID: anonymous, ExpiresAt: expires}
+	own := authenticator.Session{ID: uuid.NewV4().String(), UserID: registered, ExpiresAt: expires}
+	require.NoError(t, repo.InsertSession(ctx, session1, "session1"))
+	require.NoError(t, repo.InsertSession(ctx, session2, "session2"))
+	require.NoError(t, repo.InsertSession(ctx, own, "own"))
+
+	n, err := repo.MergeUsers(ctx, anonymous, registered)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	// deleted shortening stays deleted and is restored by new owner
+	_, err = repo.Select(ctx, "short2")
+	assert.ErrorIs(t, err, sherr.ErrDBRecordDeleted)
+	restored, err := repo.RestoreRecords(ctx, []api.DeleteItem{{UserID: registered, IDs: []string{"short2"}}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"short2"}, restored[0].IDs)
+
+	records, err := repo.SelectUserAll(ctx, registered)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []api.BatchElement{
+		{OriginalURL: "http://site.ru/own", ShortURL: "own"},
+		{OriginalURL: "http://site.ru/1", ShortURL: "short1"},
+		{OriginalURL: "http://site.ru/2", ShortURL: "short2"},
+	}, records)
+	records, err = repo.SelectUserAll(ctx, anonymous)
+	require.NoError(t, err)
+	assert.Empty(t, records)
+
+	got, err := repo.SelectAPIKey(ctx, "hash")
+	require.NoError(t, err)
+	assert.Equal(t, registered, got.UserID)
+
+	// all sessions of merged user are revoked, sessions of account stay active
+	for _, hash := range []string{"session1", "session2"} {
+		session, err := repo.SelectSession(ctx, hash)
+		require.NoError(t, err)
+		assert.NotNil(t, session.RevokedAt, hash)
+	}
+	session, err := repo.SelectSession(ctx, "own")
+	require.NoError(t, err)
+	assert.Nil(t, session.RevokedAt)
+	ids, err := repo.SelectRevokedSessions(ctx, time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{session1.ID, session2.ID}, ids)
+
+	n, err = repo.MergeUsers(ctx, anonymous, registered)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func testCanceledContext(t *testing.T, repo api.Storager) {
+	require.NoError(t, repo.Insert(context.Background(), uuid.NewV4(), "short1", "http://site.ru/1", api.LinkOptions{}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.ErrorIs(t, repo.Insert(ctx, uuid.NewV4(), "short2", "http://site.ru/2", api.LinkOptions{}), context.Canceled)
+
+	_, err := repo.Select(ctx, "short1")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = repo.SelectUserAll(ctx, uuid.NewV4())
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = repo.Select(context.Background(), "short2")
+	assert.Error(t, err)
+}
+
+func testConcurrentAccess(t *testing.T, repo api.Storager) {
+	ctx := context.Background()
+	user := uuid.NewV4()
+
+	const workers = 8
+	const perWorker = 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*perWorker*2)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				key := "short" + strconv.Itoa(w) + "x" + strconv.Itoa(i)
+				url := "http://site.ru/" + key
+				if err := repo.Insert(ctx, user, key, url, api.LinkOptions{}); err != nil {
+					errs <- err
+					continue
+				}
+				longURL, err := repo.Select(ctx, key)
+				if err != nil {
+					errs <- err
+					continue
+				}
+				if longURL.OriginalURL != url {
+					errs <- errors.New("got " + longURL.OriginalURL + " instead of " + url)
+				}
+			}
+			if _, err := repo.DeleteRecords(ctx, []api.DeleteItem{{UserID: user, IDs: []string{"short" + strconv.Itoa(w) + "x0"}}}); err != nil {
+				errs <- err
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+
+	records, err := repo.SelectUserAll(ctx, user)
+	require.NoError(t, err)
+	assert.Len(t, records, workers*perWorker)
+}
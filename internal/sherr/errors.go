@@ -25,11 +25,87 @@ func NewAlreadyExistError(originalURL, shortURL string) error {
 	}
 }
 
+// CollisionError defines error in case of saving shortening which is already used for another URL.
+type CollisionError struct {
+	ShortURL string
+}
+
+// Error gives string representation of error in output.
+func (ex *CollisionError) Error() string {
+	return fmt.Sprintf("shortening %s is already used", ex.ShortURL)
+}
+
+// NewCollisionError creates CollisionError.
+func NewCollisionError(shortURL string) error {
+	return &CollisionError{ShortURL: shortURL}
+}
+
+// ErrNoFreeShortening defines error in case of every generated shortening collides with existing one.
+var ErrNoFreeShortening = errors.New("can't generate unique shortening")
+
 // ErrNoUserIDInToken defines error in case of empty user ID in JWT.
 var ErrNoUserIDInToken = errors.New("no user ID in JWT")
 
 // ErrTokenInvalid defines error in case of invalid JWT.
 var ErrTokenInvalid = errors.New("token is not valid")
 
+// ErrNotFound defines error in case of requesting shortening which is not in data storage.
+var ErrNotFound = errors.New("can't find value of key")
+
 // ErrDBRecordDeleted defines error in case of requesting deleted shortening.
 var ErrDBRecordDeleted = errors.New("shortening is deleted")
+
+// ErrUnknownSchemaVersion defines error in case of database schema which is newer than service knows.
+var ErrUnknownSchemaVersion = errors.New("unknown database schema version")
+
+// ErrInvalidAlias defines error in case of custom alias which doesn't match allowed pattern or is reserved.
+var ErrInvalidAlias = errors.New("invalid alias")
+
+// ErrAliasTaken defines error in case of custom alias which is already used by another shortening.
+var ErrAliasTaken = errors.New("alias is already taken")
+
+// ErrLinkExpired defines error in case of requesting shortening which expiration time has passed.
+var ErrLinkExpired = errors.New("shortening is expired")
+
+// ErrInvalidExpiration defines error in case of expiration time in the past or invalid time to live.
+var ErrInvalidExpiration = errors.New("invalid expiration")
+
+// ErrInvalidRedirect defines error in case of HTTP status of redirect which can't be used for shortening.
+var ErrInvalidRedirect = errors.New("invalid redirect code")
+
+// ErrAPIKeyInvalid defines error in case of unknown or revoked API key.
+var ErrAPIKeyInvalid = errors.New("API key is not valid")
+
+// ErrInvalidScope defines error in case of unknown scope of API key.
+var ErrInvalidScope = errors.New("invalid scope of API key")
+
+// ErrScopeDenied defines error in case of request which scope isn't granted to API key.
+var ErrScopeDenied = errors.New("API key has no scope of request")
+
+// ErrTokenExpired defines error in case of JWT which is valid but expired.
+var ErrTokenExpired = errors.New("token is expired")
+
+// ErrSessionInvalid defines error in case of unknown or expired refresh token.
+var ErrSessionInvalid = errors.New("session is not valid")
+
+// ErrSessionRevoked defines error in case of refresh token of revoked session.
+var ErrSessionRevoked = errors.New("session is revoked")
+
+// ErrSessionConflict defines error in case of refresh token which was used by concurrent refresh.
+// Request can be retried with tokens issued by that refresh.
+var ErrSessionConflict = errors.New("session is refreshed by concurrent request")
+
+// ErrInvalidUsername defines error in case of username which doesn't meet requirements.
+var ErrInvalidUsername = errors.New("username must be 3 to 64 letters, digits, dots, dashes or underscores")
+
+// ErrInvalidPassword defines error in case of password which doesn't meet requirements.
+var ErrInvalidPassword = errors.New("password must be 8 to 72 bytes long")
+
+// ErrUsernameTaken defines error in case of registration with username of another account.
+var ErrUsernameTaken = errors.New("username is already taken")
+
+// ErrAlreadyRegistered defines error in case of registration of user who already has account.
+var ErrAlreadyRegistered = errors.New("user is already registered")
+
+// ErrInvalidCredentials defines error in case of login with unknown username or wrong password.
+var ErrInvalidCredentials = errors.New("invalid username or password")
@@ -4,6 +4,7 @@ package shortener
 
 import (
 	"context"
+	"expvar"
 	"net/http"
 	"net/http/pprof"
 	"os"
@@ -28,6 +29,14 @@ type Handler interface {
 	PingDB(res http.ResponseWriter, req *http.Request)
 	GetUserAllShortenings(res http.ResponseWriter, req *http.Request)
 	DeleteRecordJSON(res http.ResponseWriter, req *http.Request)
+	RestoreRecordJSON(res http.ResponseWriter, req *http.Request)
+	GetDeleteJob(res http.ResponseWriter, req *http.Request)
+	GetShorteningStats(res http.ResponseWriter, req *http.Request)
+	UpdateShortening(res http.ResponseWriter, req *http.Request)
+	GetShorteningHistory(res http.ResponseWriter, req *http.Request)
+	CreateAPIKey(res http.ResponseWriter, req *http.Request)
+	GetUserAPIKeys(res http.ResponseWriter, req *http.Request)
+	RevokeAPIKey(res http.ResponseWriter, req *http.Request)
 	Shutdown()
 }
 
@@ -50,16 +59,47 @@ func newRouter(hi Handler) chi.Router {
 	r.Get("/debug/pprof/", pprof.Index)
 	r.Get("/debug/pprof/profile", pprof.Profile)
 	r.Get("/debug/pprof/heap", pprof.Handler("heap").ServeHTTP)
+	r.Get("/debug/vars", expvar.Handler().ServeHTTP)
+
+	// tokens are refreshed and issued by login without AuthMiddleware, so that expired access token doesn't block them
+	r.Group(func(r chi.Router) {
+		r.Use(logger.LogMiddleware)
+		r.Post("/api/auth/refresh", authenticator.Refresh)
+		r.Post("/api/auth/logout", authenticator.Logout)
+		r.Post("/api/auth/login", authenticator.Login)
+	})
 
 	r.Group(func(r chi.Router) {
 		r.Use(compress.GzipMiddleware, logger.LogMiddleware, authenticator.AuthMiddleware)
 
-		r.Post("/", hi.CreateShortening)
-		// r.Get("/{id}", hi.GetFullString)
-		r.Get("/api/user/urls", hi.GetUserAllShortenings)
-		r.Post("/api/shorten", hi.CreateShorteningJSON)
-		r.Post("/api/shorten/batch", hi.CreateShorteningJSONBatch)
-		r.Delete("/api/user/urls", hi.DeleteRecordJSON)
+		// requests authenticated by API key are limited by its scopes
+		r.Group(func(r chi.Router) {
+			r.Use(authenticator.RequireScope(authenticator.ScopeCreate))
+			r.Post("/", hi.CreateShortening)
+			r.Patch("/api/user/urls/{id}", hi.UpdateShortening)
+			r.Post("/api/shorten", hi.CreateShorteningJSON)
+			r.Post("/api/shorten/batch", hi.CreateShorteningJSONBatch)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(authenticator.RequireScope(authenticator.ScopeRead))
+			// r.Get("/{id}", hi.GetFullString)
+			r.Get("/api/user/urls", hi.GetUserAllShortenings)
+			r.Get("/api/user/urls/{id}/stats", hi.GetShorteningStats)
+			r.Get("/api/user/urls/{id}/history", hi.GetShorteningHistory)
+			r.Get("/api/user/urls/delete-jobs/{id}", hi.GetDeleteJob)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(authenticator.RequireScope(authenticator.ScopeDelete))
+			r.Delete("/api/user/urls", hi.DeleteRecordJSON)
+			r.Post("/api/user/urls/restore", hi.RestoreRecordJSON)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(authenticator.RequireCookie)
+			r.Post("/api/user/keys", hi.CreateAPIKey)
+			r.Get("/api/user/keys", hi.GetUserAPIKeys)
+			r.Delete("/api/user/keys/{id}", hi.RevokeAPIKey)
+			r.Post("/api/auth/register", authenticator.Register)
+		})
 	})
 
 	return r